@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/default23/protofake/mapper"
+)
+
+// maxMappingsBodySize limits the size of the mappings, registered by a single request.
+const maxMappingsBodySize = 10 << 20
+
+// mappingView is the registered mapping with its origin.
+type mappingView struct {
+	*mapper.Mapping
+	Origin mapper.Origin `json:"origin"`
+	// Source is the file, the mapping is loaded from.
+	Source string `json:"source,omitempty"`
+}
+
+func newMappingView(m *mapper.Mapping) mappingView {
+	return mappingView{Mapping: m, Origin: m.Origin, Source: m.Location()}
+}
+
+// handleListMappings returns all the registered mappings, the mappings of the most preferred origin first.
+func (s *Server) handleListMappings(w http.ResponseWriter, _ *http.Request) {
+	mappings := s.mocks.Mappings()
+	views := make([]mappingView, 0, len(mappings))
+	for _, m := range mappings {
+		views = append(views, newMappingView(m))
+	}
+
+	writeJSON(w, http.StatusOK, views)
+}
+
+// handleAddMappings registers the mapping or the array of mappings with the "api" origin,
+// the API mappings with the same ids are replaced. The mappings are persisted, if it is enabled by the configuration.
+func (s *Server) handleAddMappings(w http.ResponseWriter, r *http.Request) {
+	content, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxMappingsBodySize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("read request body: %w", err))
+		return
+	}
+
+	mappings, err := decodeMappings(content)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// the valid mappings are persisted before they are registered, so they are not registered, if persisting fails
+	var persistErr error
+	var save func([]*mapper.Mapping) error
+	if s.config.PersistMappings {
+		save = func(valid []*mapper.Mapping) error {
+			persistErr = s.persistMappings(valid)
+			return persistErr
+		}
+	}
+	if err = s.mocks.AddMappingsWith(mapper.OriginAPI, mappings, save); err != nil {
+		if persistErr != nil {
+			writeError(w, http.StatusInternalServerError, fmt.Errorf("mappings are not registered, failed to persist them: %w", err))
+			return
+		}
+
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	views := make([]mappingView, 0, len(mappings))
+	for _, m := range mappings {
+		views = append(views, newMappingView(m))
+	}
+
+	writeJSON(w, http.StatusCreated, views)
+}
+
+// handleDeleteMapping removes the API mapping by id, the persisted mapping file is removed as well.
+func (s *Server) handleDeleteMapping(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	found := s.mocks.DeleteMapping(mapper.OriginAPI, id)
+	if s.config.PersistMappings {
+		removed, err := s.removePersistedMapping(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		found = found || removed
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, fmt.Errorf("mapping %s is not registered via API", id))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeMappings decodes the single mapping or the array of mappings in the same format as the mapping files.
+func decodeMappings(content []byte) ([]*mapper.Mapping, error) {
+	var mappings []*mapper.Mapping
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(content, &mappings); err != nil {
+			return nil, fmt.Errorf("decode mappings: %w", err)
+		}
+	} else {
+		m := new(mapper.Mapping)
+		if err := json.Unmarshal(content, m); err != nil {
+			return nil, fmt.Errorf("decode mapping: %w", err)
+		}
+		mappings = append(mappings, m)
+	}
+
+	for i, m := range mappings {
+		if m == nil {
+			return nil, fmt.Errorf("mapping #%d is null", i)
+		}
+		if m.Endpoint != "" && !strings.HasPrefix(m.Endpoint, "/") {
+			m.Endpoint = "/" + m.Endpoint
+		}
+	}
+
+	return mappings, nil
+}
@@ -0,0 +1,99 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/default23/protofake/config"
+	"github.com/default23/protofake/mapper"
+)
+
+func TestServer_Mappings(t *testing.T) {
+	mocks := newTestMocks(t)
+	fileMapping := &mapper.Mapping{ID: "hello", Endpoint: "/protofake.test.Greeter/SayHello", Source: "mappings/hello.json"}
+	if err := mocks.SetMappings(mapper.OriginFile, []*mapper.Mapping{fileMapping}); err != nil {
+		t.Fatalf("SetMappings() error = %v", err)
+	}
+	s := New(config.Admin{}, mocks, "")
+
+	rec := serve(s, http.MethodPost, "/api/mappings",
+		`{"id": "hello", "endpoint": "protofake.test.Greeter/SayHello", "response": {"body": {"message": "api"}}}`)
+	assertStatus(t, rec, http.StatusCreated)
+	if got := decodeViews(t, rec.Body.Bytes()); len(got) != 1 || got[0].Origin != mapper.OriginAPI || got[0].Endpoint != "/protofake.test.Greeter/SayHello" {
+		t.Errorf("added mappings = %+v", got)
+	}
+
+	// the API mappings are listed first by the default precedence, the source is the file with the position
+	rec = serve(s, http.MethodGet, "/api/mappings", "")
+	assertStatus(t, rec, http.StatusOK)
+	views := decodeViews(t, rec.Body.Bytes())
+	var got []string
+	for _, v := range views {
+		got = append(got, string(v.Origin)+":"+v.ID+":"+v.Source)
+	}
+	if want := "api:hello: file:hello:mappings/hello.json"; strings.Join(got, " ") != want {
+		t.Errorf("listed mappings = %v, want %s", got, want)
+	}
+
+	// the file mapping with the same id is not deleted
+	assertStatus(t, serve(s, http.MethodDelete, "/api/mappings/hello", ""), http.StatusNoContent)
+	assertStatus(t, serve(s, http.MethodDelete, "/api/mappings/hello", ""), http.StatusNotFound)
+	if m := mocks.Mappings(); len(m) != 1 || m[0] != fileMapping {
+		t.Errorf("Mappings() after delete = %v, want the file mapping", m)
+	}
+
+	rec = serve(s, http.MethodGet, "/api/mappings", "")
+	assertStatus(t, rec, http.StatusOK)
+	if views = decodeViews(t, rec.Body.Bytes()); len(views) != 1 || views[0].Origin != mapper.OriginFile {
+		t.Errorf("listed mappings after delete = %+v", views)
+	}
+}
+
+func TestServer_AddMappings__BadInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{"invalid JSON", `{"id": "hello",`, http.StatusBadRequest, "decode mapping"},
+		{"invalid list", `[{"id": "hello"}, 1]`, http.StatusBadRequest, "decode mappings"},
+		{"null mapping", `[{"id": "hello", "endpoint": "/protofake.test.Greeter/SayHello"}, null]`, http.StatusBadRequest, "mapping #1 is null"},
+		{"unknown endpoint", `{"id": "hello", "endpoint": "/protofake.test.Greeter/Unknown"}`, http.StatusBadRequest, "not implemented"},
+		{"unknown response field", `{"id": "hello", "endpoint": "/protofake.test.Greeter/SayHello", "response": {"body": {"mesage": "hi"}}}`, http.StatusBadRequest, "mesage"},
+		{"too large body", `{"id": "` + strings.Repeat("a", maxMappingsBodySize) + `"}`, http.StatusBadRequest, "read request body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mocks := newTestMocks(t)
+			rec := serve(New(config.Admin{}, mocks, ""), http.MethodPost, "/api/mappings", tt.body)
+			assertStatus(t, rec, tt.wantCode)
+
+			var resp errorResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode error response: %v", err)
+			}
+			if !strings.Contains(resp.Error, tt.wantErr) {
+				t.Errorf("error = %q, want %q", resp.Error, tt.wantErr)
+			}
+			if m := mocks.Mappings(); len(m) != 0 {
+				t.Errorf("Mappings() = %v, want none of the bad input registered", m)
+			}
+		})
+	}
+}
+
+// decodeViews decodes the listed mappings.
+func decodeViews(t *testing.T, content []byte) []mappingView {
+	t.Helper()
+
+	var views []mappingView
+	if err := json.Unmarshal(content, &views); err != nil {
+		t.Fatalf("decode mappings: %v, content: %s", err, content)
+	}
+
+	return views
+}
@@ -0,0 +1,166 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/default23/protofake/mapper"
+)
+
+// persistedMappingExtension is the extension of the persisted mapping files,
+// they are loaded as the API mappings on start.
+const persistedMappingExtension = ".json"
+
+// PersistedMappingsDir is the subdirectory of the mappings directory, the API mappings are persisted to.
+// It is excluded from the mapping files, when the persisting is enabled, so the persisted mappings keep the "api" origin.
+const PersistedMappingsDir = "api"
+
+// LoadPersistedMappings registers the persisted mappings with the "api" origin, returns the count of the mappings.
+// It is called on start, the missing persist directory is not an error.
+func (s *Server) LoadPersistedMappings() (int, error) {
+	entries, err := os.ReadDir(s.persistDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("read persisted mappings directory: %w", err)
+	}
+
+	var mappings []*mapper.Mapping
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != persistedMappingExtension {
+			continue
+		}
+
+		path := filepath.Join(s.persistDir, entry.Name())
+		content, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return 0, fmt.Errorf("read persisted mapping file: %w", readErr)
+		}
+
+		decoded, decodeErr := decodeMappings(content)
+		if decodeErr != nil {
+			return 0, fmt.Errorf("%s: %w", path, decodeErr)
+		}
+		for _, m := range decoded {
+			m.Source = path
+		}
+		mappings = append(mappings, decoded...)
+	}
+
+	if err = s.mocks.SetMappings(mapper.OriginAPI, mappings); err != nil {
+		return 0, err
+	}
+
+	return len(mappings), nil
+}
+
+// persistedFile is the mapping file, written by persistMappings, with its previous content to restore.
+type persistedFile struct {
+	path string
+	// previous is the content of the replaced file, nil if the file did not exist.
+	previous []byte
+}
+
+// persistMappings writes each mapping into its own file in the persist directory, the file is replaced atomically.
+// If any of the mappings is not written, the already written files are restored, so the directory is not changed.
+func (s *Server) persistMappings(mappings []*mapper.Mapping) error {
+	if err := os.MkdirAll(s.persistDir, 0o755); err != nil {
+		return fmt.Errorf("create persisted mappings directory: %w", err)
+	}
+
+	written := make([]persistedFile, 0, len(mappings))
+	for _, m := range mappings {
+		if err := s.persistMapping(m, &written); err != nil {
+			restorePersistedFiles(written)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// persistMapping writes the mapping file and records it into the written files.
+func (s *Server) persistMapping(m *mapper.Mapping, written *[]persistedFile) error {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal mapping %s: %w", m.ID, err)
+	}
+
+	file := persistedFile{path: s.persistedMappingPath(m.ID)}
+	if file.previous, err = os.ReadFile(file.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("read mapping %s file: %w", m.ID, err)
+	}
+	if err = writeFileAtomic(file.path, append(content, '\n')); err != nil {
+		return fmt.Errorf("write mapping %s: %w", m.ID, err)
+	}
+	*written = append(*written, file)
+
+	return nil
+}
+
+// restorePersistedFiles brings back the previous content of the written files, the new files are removed.
+func restorePersistedFiles(written []persistedFile) {
+	for _, file := range written {
+		if file.previous == nil {
+			_ = os.Remove(file.path)
+			continue
+		}
+		_ = writeFileAtomic(file.path, file.previous)
+	}
+}
+
+// removePersistedMapping removes the file of the mapping, reports whether the file existed.
+func (s *Server) removePersistedMapping(id string) (bool, error) {
+	err := os.Remove(s.persistedMappingPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("remove mapping %s file: %w", id, err)
+	}
+
+	return true, nil
+}
+
+// persistedMappingPath returns the path of the mapping file, named after the mapping id.
+// The bytes of the id, which are not safe for the file name, are percent-encoded, e.g. "a/b" is saved as "a%2Fb.json",
+// so the different ids never share the file and the file is never written outside the persist directory.
+func (s *Server) persistedMappingPath(id string) string {
+	var name strings.Builder
+	for i := range len(id) {
+		c := id[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+			name.WriteByte(c)
+		default:
+			fmt.Fprintf(&name, "%%%02X", c)
+		}
+	}
+
+	return filepath.Join(s.persistDir, name.String()+persistedMappingExtension)
+}
+
+// writeFileAtomic writes the content into the temporary file and renames it, so the readers never see
+// the partially written file. The temporary file has no mapping extension, so it is not loaded by the watcher.
+func writeFileAtomic(path string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //nolint:errcheck
+
+	if _, err = tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
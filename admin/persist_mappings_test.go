@@ -0,0 +1,139 @@
+package admin
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/default23/protofake/config"
+	"github.com/default23/protofake/mapper"
+)
+
+func TestServer_PersistMappings(t *testing.T) {
+	persistDir := filepath.Join(t.TempDir(), "mappings", PersistedMappingsDir)
+	conf := config.Admin{PersistMappings: true}
+	s := New(conf, newTestMocks(t), persistDir)
+
+	rec := serve(s, http.MethodPost, "/api/mappings", `[
+  {"id": "users/get", "endpoint": "protofake.test.Greeter/SayHello", "response": {"body": {"message": "users"}}},
+  {"id": "hello", "endpoint": "/protofake.test.Greeter/SayHello", "response": {"body": {"message": "v1"}}}
+]`)
+	assertStatus(t, rec, http.StatusCreated)
+	assertPersistedFiles(t, persistDir, "hello.json", "users%2Fget.json")
+
+	// the invalid mappings are neither registered nor saved
+	rec = serve(s, http.MethodPost, "/api/mappings", `{"id": "broken", "endpoint": "/protofake.test.Greeter/Unknown"}`)
+	assertStatus(t, rec, http.StatusBadRequest)
+	assertPersistedFiles(t, persistDir, "hello.json", "users%2Fget.json")
+
+	// the mapping with the same id replaces the file
+	rec = serve(s, http.MethodPost, "/api/mappings", `{"id": "hello", "endpoint": "/protofake.test.Greeter/SayHello", "response": {"body": {"message": "v2"}}}`)
+	assertStatus(t, rec, http.StatusCreated)
+	content, err := os.ReadFile(filepath.Join(persistDir, "hello.json"))
+	if err != nil {
+		t.Fatalf("read persisted mapping: %v", err)
+	}
+	saved, err := decodeMappings(content)
+	if err != nil || len(saved) != 1 || saved[0].Response.Body["message"] != "v2" {
+		t.Fatalf("persisted mapping = %v, %v, want the replaced one", saved, err)
+	}
+
+	assertStatus(t, serve(s, http.MethodDelete, "/api/mappings/hello", ""), http.StatusNoContent)
+	assertPersistedFiles(t, persistDir, "users%2Fget.json")
+	assertStatus(t, serve(s, http.MethodDelete, "/api/mappings/hello", ""), http.StatusNotFound)
+
+	// the persisted mappings are loaded on the restart with the api origin
+	mocks := newTestMocks(t)
+	restarted := New(conf, mocks, persistDir)
+	count, err := restarted.LoadPersistedMappings()
+	if err != nil {
+		t.Fatalf("LoadPersistedMappings() error = %v", err)
+	}
+	if count != 1 {
+		t.Errorf("LoadPersistedMappings() count = %d, want 1", count)
+	}
+
+	mappings := mocks.Mappings()
+	if len(mappings) != 1 {
+		t.Fatalf("Mappings() = %v, want the persisted mapping", mappings)
+	}
+	m := mappings[0]
+	if m.ID != "users/get" || m.Origin != mapper.OriginAPI || m.Endpoint != "/protofake.test.Greeter/SayHello" {
+		t.Errorf("loaded mapping = (id=%s origin=%s endpoint=%s)", m.ID, m.Origin, m.Endpoint)
+	}
+	if want := filepath.Join(persistDir, "users%2Fget.json"); m.Source != want {
+		t.Errorf("loaded mapping source = %s, want %s", m.Source, want)
+	}
+
+	// the loaded mapping is deleted with its file
+	assertStatus(t, serve(restarted, http.MethodDelete, "/api/mappings/users%2Fget", ""), http.StatusNoContent)
+	assertPersistedFiles(t, persistDir)
+}
+
+func TestServer_LoadPersistedMappings(t *testing.T) {
+	tests := []struct {
+		name      string
+		files     map[string]string
+		wantCount int
+		wantErr   bool
+	}{
+		{name: "missing directory", wantCount: 0},
+		{
+			name: "other files are skipped",
+			files: map[string]string{
+				"hello.json":                "{\"id\": \"hello\", \"endpoint\": \"/protofake.test.Greeter/SayHello\"}\n",
+				".hello.json.tmp-1":         "{",
+				"notes.txt":                 "not a mapping",
+				"nested/hello.schema.json":  "{",
+				"nested/deeper/nested.json": "{",
+			},
+			wantCount: 1,
+		},
+		{name: "corrupt file", files: map[string]string{"hello.json": `{"id": "hello",`}, wantErr: true},
+		{name: "invalid mapping", files: map[string]string{"hello.json": `{"id": "hello", "endpoint": "/protofake.test.Greeter/Unknown"}`}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			persistDir := filepath.Join(t.TempDir(), PersistedMappingsDir)
+			for name, content := range tt.files {
+				path := filepath.Join(persistDir, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+					t.Fatalf("create dir: %v", err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					t.Fatalf("write %s: %v", name, err)
+				}
+			}
+
+			mocks := newTestMocks(t)
+			count, err := New(config.Admin{PersistMappings: true}, mocks, persistDir).LoadPersistedMappings()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadPersistedMappings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if count != tt.wantCount || len(mocks.Mappings()) != tt.wantCount {
+				t.Errorf("LoadPersistedMappings() count = %d, registered %d, want %d", count, len(mocks.Mappings()), tt.wantCount)
+			}
+		})
+	}
+}
+
+// assertPersistedFiles checks the names of the files in the persist directory.
+func assertPersistedFiles(t *testing.T, dir string, want ...string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("read persist dir: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("persisted files = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"sync"
+	"time"
+)
+
+// ReloadState is the result of the reloads of the watched directory.
+type ReloadState struct {
+	Dir string `json:"dir"`
+	// Reloads is the count of the reloads, both succeeded and failed.
+	Reloads       int        `json:"reloads"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	// LastError is the error of the last reload, empty if the last reload succeeded.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// ReloadStatus tracks the reloads of the watched directory, it is safe for concurrent use.
+type ReloadStatus struct {
+	mu    sync.RWMutex
+	state ReloadState
+}
+
+// Succeeded records the successful reload.
+func (s *ReloadStatus) Succeeded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.state.Reloads++
+	s.state.LastSuccessAt = &now
+	s.state.LastError = ""
+}
+
+// Failed records the failed reload.
+func (s *ReloadStatus) Failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.state.Reloads++
+	s.state.LastErrorAt = &now
+	s.state.LastError = err.Error()
+}
+
+// State returns the copy of the current state.
+func (s *ReloadStatus) State() ReloadState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
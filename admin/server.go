@@ -0,0 +1,147 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/default23/protofake/config"
+	"github.com/default23/protofake/server"
+)
+
+// shutdownTimeout is the time to complete the pending requests on Close.
+const shutdownTimeout = 5 * time.Second
+
+// Server is the admin HTTP API of the protofake.
+type Server struct {
+	config     config.Admin
+	httpServer *http.Server
+	mocks      *server.Server
+	// persistDir is the directory, the API mappings are persisted to, see LoadPersistedMappings.
+	persistDir string
+
+	mu      sync.RWMutex
+	reloads map[string]*ReloadStatus
+}
+
+// New - creates a new admin API server, which manages the mappings of the gRPC mocking server.
+// The API mappings are persisted to the persistDir, if it is enabled by the configuration.
+// The port is not bound until Run is called.
+func New(conf config.Admin, mocks *server.Server, persistDir string) *Server {
+	s := &Server{
+		config:     conf,
+		mocks:      mocks,
+		persistDir: persistDir,
+		reloads:    make(map[string]*ReloadStatus),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/status", s.handleStatus)
+	mux.HandleFunc("GET /api/mappings", s.handleListMappings)
+	mux.HandleFunc("POST /api/mappings", s.handleAddMappings)
+	mux.HandleFunc("DELETE /api/mappings/{id}", s.handleDeleteMapping)
+	mux.HandleFunc("GET /api/unknown-calls", s.handleListUnknownCalls)
+	mux.HandleFunc("DELETE /api/unknown-calls", s.handleClearUnknownCalls)
+	s.httpServer = &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	return s
+}
+
+// TrackReload returns the reload status of the watched directory, which is exposed by the API under the name.
+func (s *Server) TrackReload(name, dir string) *ReloadStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := &ReloadStatus{state: ReloadState{Dir: dir}}
+	s.reloads[name] = status
+
+	return status
+}
+
+// Run - starts the admin API server, if it is enabled.
+func (s *Server) Run() error {
+	if !s.config.Enabled {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.config.Host, s.config.Port))
+	if err != nil {
+		return fmt.Errorf("listen %s:%s: %w", s.config.Host, s.config.Port, err)
+	}
+
+	slog.Info("starting admin API server at " + s.config.Host + ":" + s.config.Port)
+	go func() {
+		if err := s.httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("failed to start admin API server", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Close - gracefully shuts down the admin API server.
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown admin API server: %w", err)
+	}
+
+	return nil
+}
+
+// statusResponse is the response of the GET /api/status.
+type statusResponse struct {
+	// Reloads are the reload states of the watched directories by name, e.g. "mappings".
+	Reloads map[string]ReloadState `json:"reloads"`
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	resp := statusResponse{Reloads: make(map[string]ReloadState, len(s.reloads))}
+	for name, status := range s.reloads {
+		resp.Reloads[name] = status.State()
+	}
+	s.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleListUnknownCalls returns the journaled calls of the methods, which are not found in the descriptors.
+func (s *Server) handleListUnknownCalls(w http.ResponseWriter, _ *http.Request) {
+	calls := s.mocks.UnknownCalls()
+	if calls == nil {
+		calls = []server.UnknownCall{}
+	}
+
+	writeJSON(w, http.StatusOK, calls)
+}
+
+func (s *Server) handleClearUnknownCalls(w http.ResponseWriter, _ *http.Request) {
+	s.mocks.ClearUnknownCalls()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// errorResponse is the response of the failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, errorResponse{Error: err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to write admin API response", "error", err)
+	}
+}
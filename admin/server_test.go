@@ -0,0 +1,128 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/default23/protofake/config"
+	"github.com/default23/protofake/server"
+)
+
+const testProto = `
+name: "greeter_test.proto"
+package: "protofake.test"
+syntax: "proto3"
+message_type {
+  name: "HelloRequest"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+}
+message_type {
+  name: "HelloReply"
+  field { name: "message" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "message" }
+}
+service {
+  name: "Greeter"
+  method { name: "SayHello" input_type: ".protofake.test.HelloRequest" output_type: ".protofake.test.HelloReply" }
+}
+`
+
+// newTestMocks constructs the mocking server with the test service registered.
+func newTestMocks(t *testing.T) *server.Server {
+	t.Helper()
+
+	mocks, err := server.New(config.GRPC{
+		MappingsPrecedence:      []string{"api", "recording", "file"},
+		FallbackCode:            "FAILED_PRECONDITION",
+		UnknownCallsJournalSize: 100,
+	})
+	if err != nil {
+		t.Fatalf("server.New() error = %v", err)
+	}
+
+	fdp := new(descriptorpb.FileDescriptorProto)
+	if err = prototext.Unmarshal([]byte(testProto), fdp); err != nil {
+		t.Fatalf("unmarshal test proto: %v", err)
+	}
+	if err = mocks.Register(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fdp}}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	return mocks
+}
+
+// serve handles the request by the admin API, the body is sent as is.
+func serve(s *Server, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+
+	return rec
+}
+
+// assertStatus checks the status code of the response, the body is reported on mismatch.
+func assertStatus(t *testing.T, rec *httptest.ResponseRecorder, want int) {
+	t.Helper()
+
+	if rec.Code != want {
+		t.Fatalf("status = %d (%s), want %d, body: %s", rec.Code, http.StatusText(rec.Code), want, rec.Body.String())
+	}
+}
+
+func TestServer_Status(t *testing.T) {
+	s := New(config.Admin{}, newTestMocks(t), "")
+
+	rec := serve(s, http.MethodGet, "/api/status", "")
+	assertStatus(t, rec, http.StatusOK)
+	if got := strings.TrimSpace(rec.Body.String()); got != `{"reloads":{}}` {
+		t.Errorf("status without watchers = %s", got)
+	}
+
+	mappings := s.TrackReload("mappings", "/data/mappings")
+	descriptors := s.TrackReload("descriptors", "/data/descriptors")
+	mappings.Failed(errors.New("broken.json: invalid JSON"))
+	mappings.Succeeded()
+	descriptors.Failed(errors.New("greeter.proto:1:1: syntax error"))
+
+	rec = serve(s, http.MethodGet, "/api/status", "")
+	assertStatus(t, rec, http.StatusOK)
+
+	var resp statusResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode status: %v", err)
+	}
+
+	got := resp.Reloads["mappings"]
+	if got.Dir != "/data/mappings" || got.Reloads != 2 || got.LastError != "" || got.LastSuccessAt == nil || got.LastErrorAt == nil {
+		t.Errorf("mappings status = %+v, want the succeeded reload after the failed one", got)
+	}
+	got = resp.Reloads["descriptors"]
+	if got.Reloads != 1 || got.LastError != "greeter.proto:1:1: syntax error" || got.LastSuccessAt != nil {
+		t.Errorf("descriptors status = %+v, want the failed reload", got)
+	}
+}
+
+func TestServer_Routes(t *testing.T) {
+	s := New(config.Admin{}, newTestMocks(t), "")
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/unknown-calls", http.StatusOK},
+		{http.MethodDelete, "/api/unknown-calls", http.StatusNoContent},
+		{http.MethodPut, "/api/mappings", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/mappings/hello", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/unknown", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if rec := serve(s, tt.method, tt.path, ""); rec.Code != tt.want {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+		}
+	}
+}
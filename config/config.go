@@ -1,9 +1,12 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/caarlos0/env/v6"
 )
@@ -15,14 +18,39 @@ type LogLevel string
 type Config struct {
 	// WatchMappingsChanges is the option to watch for changes in the mappings directory.
 	// If true, the application will watch for changes in the mappings directory and reload the mappings.
-	WatchMappingsChanges bool     `env:"WATCH_MAPPINGS_CHANGES" envDefault:"false"`
-	DataDir              string   `env:"DATA_DIR" envDefault:"/data"`
-	DescriptorExtensions []string `env:"DESCRIPTOR_EXTENSIONS" envDefault:".pb"`
+	WatchMappingsChanges bool `env:"WATCH_MAPPINGS_CHANGES" envDefault:"false"`
+	// WatchDescriptorsChanges is the option to watch for changes in the descriptors directory.
+	// If true, the services are added, replaced or removed at runtime, when the descriptors are changed.
+	WatchDescriptorsChanges bool `env:"WATCH_DESCRIPTORS_CHANGES" envDefault:"false"`
+	// WatchDebounce is the delay after the last filesystem event, before the watched directory is reloaded,
+	// so the burst of events (e.g. the editor saves or the git checkout) causes the single reload.
+	WatchDebounce        time.Duration `env:"WATCH_DEBOUNCE" envDefault:"300ms"`
+	DataDir              string        `env:"DATA_DIR" envDefault:"/data"`
+	DescriptorExtensions []string      `env:"DESCRIPTOR_EXTENSIONS" envDefault:".pb,.binpb,.bin,.json"`
+	// ProtoImportPaths are the directories to resolve the imports of the .proto files from the descriptors directory.
+	// The descriptors directory itself and the well-known types are always available.
+	ProtoImportPaths []string `env:"PROTO_IMPORT_PATHS"`
+	// DescriptorReflectionAddrs are the addresses of the gRPC servers, the descriptors are downloaded from
+	// via the server reflection.
+	DescriptorReflectionAddrs   []string      `env:"DESCRIPTOR_REFLECTION_ADDRS"`
+	DescriptorReflectionTimeout time.Duration `env:"DESCRIPTOR_REFLECTION_TIMEOUT" envDefault:"10s"`
+	DescriptorReflectionTLS     ClientTLS     `envPrefix:"DESCRIPTOR_REFLECTION_TLS_"`
 
 	GRPC   GRPC   `envPrefix:"GRPC_"`
+	Admin  Admin  `envPrefix:"ADMIN_"`
 	Logger Logger `envPrefix:"LOG_"`
 }
 
+// Admin is the admin HTTP API configuration.
+type Admin struct {
+	Enabled bool   `env:"ENABLED" envDefault:"false"`
+	Host    string `env:"HOST" envDefault:"0.0.0.0"`
+	Port    string `env:"PORT" envDefault:"5676"`
+	// PersistMappings is the option to save the mappings, registered via API, into the DATA_DIR/mappings/api directory,
+	// so they are loaded with the "api" origin on the next start. The directory is not loaded as the mapping files then.
+	PersistMappings bool `env:"PERSIST_MAPPINGS" envDefault:"false"`
+}
+
 // Logger is the logger configuration.
 type Logger struct {
 	Level      LogLevel `env:"LEVEL" envDefault:"info"`
@@ -36,6 +64,88 @@ type GRPC struct {
 	ServerReflection       bool   `env:"SERVER_REFLECTION" envDefault:"false"`
 	IgnoreDuplicateService bool   `env:"IGNORE_DUPLICATE_SERVICE" envDefault:"false"`
 	DiscardUnknownFields   bool   `env:"DISCARD_UNKNOWN_FIELDS" envDefault:"false"`
+	// MappingsPrecedence is the order of the mapping origins (file, api, recording), the most preferred first.
+	// The mappings of the preferred origin are checked first, when the request is matched.
+	MappingsPrecedence []string `env:"MAPPINGS_PRECEDENCE" envDefault:"api,recording,file"`
+	// FallbackCode is the status code, returned when none of the mappings matches the request,
+	// the empty response message is returned for OK.
+	FallbackCode string `env:"FALLBACK_CODE" envDefault:"FAILED_PRECONDITION"`
+	// HandleUnknownServices is the option to accept the calls of the methods, which are not found in the descriptors.
+	// Such calls are logged, journaled and answered with the mappings of the fixed status or the raw payload.
+	HandleUnknownServices bool `env:"HANDLE_UNKNOWN_SERVICES" envDefault:"false"`
+	// UnknownCallsJournalSize is the count of the last unknown calls, kept in the journal.
+	UnknownCallsJournalSize int `env:"UNKNOWN_CALLS_JOURNAL_SIZE" envDefault:"100"`
+
+	TLS TLS `envPrefix:"TLS_"`
+	Web Web `envPrefix:"WEB_"`
+}
+
+// Web is the configuration of the HTTP listener, which serves the mocks over the gRPC-Web and the Connect protocols.
+// The TLS of the gRPC server is applied to the listener as well.
+type Web struct {
+	Enabled bool   `env:"ENABLED" envDefault:"false"`
+	Host    string `env:"HOST" envDefault:"0.0.0.0"`
+	Port    string `env:"PORT" envDefault:"5677"`
+	// AllowedOrigins are the origins, the browsers are allowed to call the mocks from (CORS), "*" allows any origin.
+	AllowedOrigins []string `env:"ALLOWED_ORIGINS" envDefault:"*"`
+}
+
+// TLS is the TLS configuration of the gRPC server, the plaintext is served if neither the certificate
+// nor the generation is configured.
+type TLS struct {
+	CertFile string `env:"CERT_FILE"`
+	KeyFile  string `env:"KEY_FILE"`
+	// ClientCAFile is the CA bundle to verify the client certificates with, enables the mutual TLS.
+	ClientCAFile string `env:"CLIENT_CA_FILE"`
+	// ClientAuth is the client certificate policy of the mutual TLS: "required" (the default) or "optional".
+	ClientAuth string `env:"CLIENT_AUTH"`
+	// Generate is the option to generate the self-signed CA and the server certificate at startup.
+	Generate bool `env:"GENERATE" envDefault:"false"`
+	// GenerateHosts are the DNS names and the IP addresses of the generated server certificate.
+	GenerateHosts []string `env:"GENERATE_HOSTS" envDefault:"localhost,127.0.0.1,::1"`
+	// GenerateDir is the directory, the generated CA is written to for the clients to trust,
+	// the CA is reused on the next start. The default is DATA_DIR/tls.
+	GenerateDir string `env:"GENERATE_DIR"`
+}
+
+// Enabled reports whether the TLS is configured.
+func (c TLS) Enabled() bool {
+	return c.CertFile != "" || c.Generate
+}
+
+// Validate checks the options are consistent, so the mutual TLS options are not ignored silently.
+func (c TLS) Validate() error {
+	if !c.Enabled() && (c.ClientCAFile != "" || c.ClientAuth != "") {
+		return errors.New("the mutual TLS requires the server certificate, set GRPC_TLS_CERT_FILE or GRPC_TLS_GENERATE")
+	}
+	if c.ClientAuth != "" && c.ClientCAFile == "" {
+		return errors.New("GRPC_TLS_CLIENT_AUTH requires GRPC_TLS_CLIENT_CA_FILE to verify the client certificates")
+	}
+
+	switch strings.ToLower(c.ClientAuth) {
+	case "", "required", "optional":
+		return nil
+	default:
+		return fmt.Errorf("unknown GRPC_TLS_CLIENT_AUTH '%s', expected 'required' or 'optional'", c.ClientAuth)
+	}
+}
+
+// ClientTLS is the TLS configuration of the connections to the other gRPC servers, the plaintext is used
+// if none of the options is set.
+type ClientTLS struct {
+	Enabled bool `env:"ENABLED" envDefault:"false"`
+	// CAFile is the CA bundle to verify the server certificate with, the system roots are used by default.
+	CAFile string `env:"CA_FILE"`
+	// CertFile and KeyFile are the client certificate, presented to the servers with the mutual TLS.
+	CertFile string `env:"CERT_FILE"`
+	KeyFile  string `env:"KEY_FILE"`
+	// InsecureSkipVerify is the option to accept any server certificate, e.g. the self-signed one.
+	InsecureSkipVerify bool `env:"INSECURE_SKIP_VERIFY" envDefault:"false"`
+}
+
+// IsEnabled reports whether the TLS is used, any of the options enables it.
+func (c ClientTLS) IsEnabled() bool {
+	return c.Enabled || c.CAFile != "" || c.CertFile != "" || c.InsecureSkipVerify
 }
 
 // Parse returns configuration, parsed from Environment variables.
@@ -54,6 +164,13 @@ func Parse() (*Config, error) {
 	}
 
 	conf.DescriptorExtensions = exts
+	if err := conf.GRPC.TLS.Validate(); err != nil {
+		return nil, fmt.Errorf("parse config: %w", err)
+	}
+	if conf.GRPC.TLS.GenerateDir == "" {
+		conf.GRPC.TLS.GenerateDir = filepath.Join(conf.DataDir, "tls")
+	}
+
 	return conf, nil
 }
 
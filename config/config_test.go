@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTLS_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    TLS
+		wantErr string
+	}{
+		{name: "plaintext", conf: TLS{}},
+		{name: "server certificate", conf: TLS{CertFile: "cert.pem", KeyFile: "key.pem"}},
+		{name: "mutual TLS", conf: TLS{CertFile: "cert.pem", ClientCAFile: "ca.pem"}},
+		{name: "optional client auth", conf: TLS{Generate: true, ClientCAFile: "ca.pem", ClientAuth: "Optional"}},
+		{name: "client CA without certificate", conf: TLS{ClientCAFile: "ca.pem"}, wantErr: "requires the server certificate"},
+		{name: "client auth without certificate", conf: TLS{ClientAuth: "required"}, wantErr: "requires the server certificate"},
+		{name: "client auth without client CA", conf: TLS{Generate: true, ClientAuth: "optional"}, wantErr: "requires GRPC_TLS_CLIENT_CA_FILE"},
+		{name: "unknown client auth", conf: TLS{Generate: true, ClientCAFile: "ca.pem", ClientAuth: "sometimes"}, wantErr: "unknown GRPC_TLS_CLIENT_AUTH"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.conf.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParse__TLS(t *testing.T) {
+	t.Setenv("DATA_DIR", "/srv/data")
+
+	conf, err := Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if conf.GRPC.TLS.Enabled() || conf.GRPC.TLS.ClientAuth != "" || conf.GRPC.TLS.GenerateDir != "/srv/data/tls" {
+		t.Errorf("Parse() TLS = %+v, want the plaintext with the default generate dir", conf.GRPC.TLS)
+	}
+
+	t.Setenv("GRPC_TLS_CLIENT_CA_FILE", "/srv/ca.pem")
+	if _, err = Parse(); err == nil {
+		t.Fatalf("Parse() with the client CA without the server certificate, expected error")
+	}
+
+	t.Setenv("GRPC_TLS_GENERATE", "true")
+	if conf, err = Parse(); err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if conf.GRPC.TLS.ClientCAFile != "/srv/ca.pem" || !conf.GRPC.TLS.Enabled() {
+		t.Errorf("Parse() TLS = %+v, want the mutual TLS", conf.GRPC.TLS)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/default23/protofake/config"
+)
+
+// reflectionStream is the server reflection stream of any supported version.
+// The v1alpha messages are wire-compatible with v1, so the v1 messages are used for both.
+type reflectionStream interface {
+	Send(req *reflectionv1.ServerReflectionRequest) error
+	Recv() (*reflectionv1.ServerReflectionResponse, error)
+	CloseSend() error
+}
+
+// reflectionV1AlphaStream converts the v1 messages to v1alpha and back.
+type reflectionV1AlphaStream struct {
+	stream reflectionv1alpha.ServerReflection_ServerReflectionInfoClient
+}
+
+func (s *reflectionV1AlphaStream) Send(req *reflectionv1.ServerReflectionRequest) error {
+	alphaReq := new(reflectionv1alpha.ServerReflectionRequest)
+	if err := convertMessage(req, alphaReq); err != nil {
+		return err
+	}
+
+	return s.stream.Send(alphaReq)
+}
+
+func (s *reflectionV1AlphaStream) Recv() (*reflectionv1.ServerReflectionResponse, error) {
+	alphaResp, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(reflectionv1.ServerReflectionResponse)
+	if err = convertMessage(alphaResp, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (s *reflectionV1AlphaStream) CloseSend() error {
+	return s.stream.CloseSend()
+}
+
+// convertMessage converts the message into the wire-compatible one.
+func convertMessage(from, to proto.Message) error {
+	content, err := proto.Marshal(from)
+	if err != nil {
+		return fmt.Errorf("marshal %s: %w", from.ProtoReflect().Descriptor().FullName(), err)
+	}
+	if err = proto.Unmarshal(content, to); err != nil {
+		return fmt.Errorf("unmarshal %s: %w", to.ProtoReflect().Descriptor().FullName(), err)
+	}
+
+	return nil
+}
+
+// reflectionCredentials constructs the transport credentials of the server reflection connections,
+// the insecure ones are returned if the TLS is not configured.
+func reflectionCredentials(conf config.ClientTLS) (credentials.TransportCredentials, error) {
+	if !conf.IsEnabled() {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: conf.InsecureSkipVerify, //nolint:gosec // explicitly configured
+	}
+	if conf.CAFile != "" {
+		content, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", conf.CAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+	if conf.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConf), nil
+}
+
+// fetchReflectionDescriptors downloads the descriptors of all the services, exposed by the server reflection
+// at the given address, with all their imports. The v1 reflection is used, v1alpha is the fallback.
+func fetchReflectionDescriptors(
+	ctx context.Context, addr string, creds credentials.TransportCredentials,
+) (*descriptorpb.FileDescriptorSet, error) {
+	logger := slog.With("reflection_addr", addr)
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	set, err := fetchDescriptors(ctx, func() (reflectionStream, error) {
+		return reflectionv1.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+	})
+	if status.Code(err) == codes.Unimplemented {
+		logger.Debug("server reflection v1 is not implemented, trying v1alpha")
+		set, err = fetchDescriptors(ctx, func() (reflectionStream, error) {
+			stream, alphaErr := reflectionv1alpha.NewServerReflectionClient(conn).ServerReflectionInfo(ctx)
+			if alphaErr != nil {
+				return nil, alphaErr
+			}
+
+			return &reflectionV1AlphaStream{stream: stream}, nil
+		})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fetch descriptors from %s: %w", addr, err)
+	}
+
+	logger.Debug("fetched descriptors via server reflection", "pb_files_count", len(set.GetFile()))
+	return set, nil
+}
+
+func fetchDescriptors(ctx context.Context, open func() (reflectionStream, error)) (*descriptorpb.FileDescriptorSet, error) {
+	stream, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer stream.CloseSend() //nolint:errcheck
+
+	resp, err := reflectionCall(stream, &reflectionv1.ServerReflectionRequest{
+		MessageRequest: &reflectionv1.ServerReflectionRequest_ListServices{},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+
+	files := make(map[string]*descriptorpb.FileDescriptorProto)
+	// order keeps the files in the order they are received, so the result is stable.
+	var order []string
+	addFiles := func(resp *reflectionv1.ServerReflectionResponse) error {
+		for _, content := range resp.GetFileDescriptorResponse().GetFileDescriptorProto() {
+			fd := new(descriptorpb.FileDescriptorProto)
+			if err = proto.Unmarshal(content, fd); err != nil {
+				return fmt.Errorf("unmarshal file descriptor: %w", err)
+			}
+			if _, ok := files[fd.GetName()]; ok {
+				continue
+			}
+
+			files[fd.GetName()] = fd
+			order = append(order, fd.GetName())
+		}
+
+		return nil
+	}
+
+	for _, service := range resp.GetListServicesResponse().GetService() {
+		if strings.HasPrefix(service.GetName(), "grpc.reflection.") {
+			continue // the reflection service is served by protofake itself
+		}
+
+		resp, err = reflectionCall(stream, &reflectionv1.ServerReflectionRequest{
+			MessageRequest: &reflectionv1.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: service.GetName()},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("get file containing service %s: %w", service.GetName(), err)
+		}
+		if err = addFiles(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	// the server may return the requested file only, so the missing imports are requested one by one
+	for i := 0; i < len(order); i++ {
+		for _, dep := range files[order[i]].GetDependency() {
+			if _, ok := files[dep]; ok {
+				continue
+			}
+
+			resp, err = reflectionCall(stream, &reflectionv1.ServerReflectionRequest{
+				MessageRequest: &reflectionv1.ServerReflectionRequest_FileByFilename{FileByFilename: dep},
+			})
+			if err != nil {
+				return nil, fmt.Errorf("get file %s: %w", dep, err)
+			}
+			if err = addFiles(resp); err != nil {
+				return nil, err
+			}
+		}
+
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	for _, name := range order {
+		set.File = append(set.File, files[name])
+	}
+
+	return set, nil
+}
+
+// reflectionCall sends the request and waits for the response, the error response is converted to the status error.
+func reflectionCall(stream reflectionStream, req *reflectionv1.ServerReflectionRequest) (*reflectionv1.ServerReflectionResponse, error) {
+	if err := stream.Send(req); err != nil {
+		if errors.Is(err, io.EOF) {
+			_, err = stream.Recv() // the stream is closed by server, the status is returned by Recv
+		}
+
+		return nil, err
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	if errResp := resp.GetErrorResponse(); errResp != nil {
+		return nil, status.Error(codes.Code(errResp.GetErrorCode()), errResp.GetErrorMessage()) //nolint:gosec
+	}
+
+	return resp, nil
+}
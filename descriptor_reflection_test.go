@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/default23/protofake/config"
+)
+
+// testServices lists the services for the reflection server.
+type testServices []string
+
+func (s testServices) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := make(map[string]grpc.ServiceInfo, len(s))
+	for _, name := range s {
+		info[name] = grpc.ServiceInfo{}
+	}
+
+	return info
+}
+
+// fileOnlyReflectionServer answers with the requested file only, without its imports.
+type fileOnlyReflectionServer struct {
+	reflectionv1.UnimplementedServerReflectionServer
+
+	files *protoregistry.Files
+}
+
+func (s *fileOnlyReflectionServer) ServerReflectionInfo(stream reflectionv1.ServerReflection_ServerReflectionInfoServer) error {
+	for {
+		req, err := stream.Recv()
+		if err != nil {
+			return nil
+		}
+
+		resp := &reflectionv1.ServerReflectionResponse{OriginalRequest: req}
+		var name string
+		switch r := req.GetMessageRequest().(type) {
+		case *reflectionv1.ServerReflectionRequest_ListServices:
+			resp.MessageResponse = &reflectionv1.ServerReflectionResponse_ListServicesResponse{
+				ListServicesResponse: &reflectionv1.ListServiceResponse{Service: []*reflectionv1.ServiceResponse{
+					{Name: "protofake.test.Greeter"},
+					{Name: "grpc.reflection.v1.ServerReflection"},
+				}},
+			}
+		case *reflectionv1.ServerReflectionRequest_FileContainingSymbol:
+			desc, findErr := s.files.FindDescriptorByName("protofake.test.Greeter")
+			if findErr != nil || r.FileContainingSymbol != "protofake.test.Greeter" {
+				return status.Errorf(codes.Internal, "unexpected symbol %s", r.FileContainingSymbol)
+			}
+			name = desc.ParentFile().Path()
+		case *reflectionv1.ServerReflectionRequest_FileByFilename:
+			name = r.FileByFilename
+		}
+
+		if name != "" {
+			fd, findErr := s.files.FindFileByPath(name)
+			if findErr != nil {
+				return status.Errorf(codes.NotFound, "file %s: %v", name, findErr)
+			}
+
+			content, marshalErr := proto.Marshal(protodesc.ToFileDescriptorProto(fd))
+			if marshalErr != nil {
+				return marshalErr
+			}
+			resp.MessageResponse = &reflectionv1.ServerReflectionResponse_FileDescriptorResponse{
+				FileDescriptorResponse: &reflectionv1.FileDescriptorResponse{FileDescriptorProto: [][]byte{content}},
+			}
+		}
+
+		if err = stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// testReflectionFiles compiles the test .proto files into the registry.
+func testReflectionFiles(t *testing.T) *protoregistry.Files {
+	t.Helper()
+
+	importPaths := []string{filepath.Join("testdata", "proto"), filepath.Join("testdata", "proto_imports")}
+	set, err := compileProtoFiles(context.Background(), importPaths, []string{"greeter.proto"})
+	if err != nil {
+		t.Fatalf("compile test protos: %v", err)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		t.Fatalf("create test files registry: %v", err)
+	}
+
+	return files
+}
+
+// startReflectionServer starts the gRPC server on the loopback address, the register function registers
+// the reflection services.
+func startReflectionServer(t *testing.T, creds credentials.TransportCredentials, register func(*grpc.Server)) string {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	srv := grpc.NewServer(grpc.Creds(creds))
+	register(srv)
+	go srv.Serve(lis) //nolint:errcheck
+	t.Cleanup(srv.Stop)
+
+	return lis.Addr().String()
+}
+
+func TestFetchReflectionDescriptors(t *testing.T) {
+	files := testReflectionFiles(t)
+	opts := reflection.ServerOptions{
+		Services:           testServices{"protofake.test.Greeter", "grpc.reflection.v1.ServerReflection"},
+		DescriptorResolver: files,
+	}
+
+	tests := []struct {
+		name     string
+		register func(*grpc.Server)
+	}{
+		{
+			name: "v1",
+			register: func(s *grpc.Server) {
+				reflectionv1.RegisterServerReflectionServer(s, reflection.NewServerV1(opts))
+			},
+		},
+		{
+			name: "v1alpha fallback",
+			register: func(s *grpc.Server) {
+				reflectionv1alpha.RegisterServerReflectionServer(s, reflection.NewServer(opts))
+			},
+		},
+		{
+			name: "imports requested one by one",
+			register: func(s *grpc.Server) {
+				reflectionv1.RegisterServerReflectionServer(s, &fileOnlyReflectionServer{files: files})
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := startReflectionServer(t, insecure.NewCredentials(), tt.register)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			set, err := fetchReflectionDescriptors(ctx, addr, insecure.NewCredentials())
+			if err != nil {
+				t.Fatalf("fetchReflectionDescriptors() error = %v", err)
+			}
+
+			got := descriptorSetFiles(set)
+			slices.Sort(got)
+			want := []string{"acme/tenant.proto", "google/protobuf/timestamp.proto", "greeter.proto", "sender.proto"}
+			if !slices.Equal(got, want) {
+				t.Fatalf("fetchReflectionDescriptors() files = %v, want %v", got, want)
+			}
+			if _, err = protodesc.NewFiles(set); err != nil {
+				t.Errorf("fetched descriptors are not complete: %v", err)
+			}
+		})
+	}
+}
+
+func TestFetchReflectionDescriptors__Unimplemented(t *testing.T) {
+	addr := startReflectionServer(t, insecure.NewCredentials(), func(*grpc.Server) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := fetchReflectionDescriptors(ctx, addr, insecure.NewCredentials())
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("fetchReflectionDescriptors() error = %v, want Unimplemented", err)
+	}
+}
+
+func TestFetchReflectionDescriptors__TLS(t *testing.T) {
+	dir := t.TempDir()
+	caFile, cert := writeTestCertificate(t, dir)
+
+	files := testReflectionFiles(t)
+	serverCreds := credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12})
+	addr := startReflectionServer(t, serverCreds, func(s *grpc.Server) {
+		reflectionv1.RegisterServerReflectionServer(s, reflection.NewServerV1(reflection.ServerOptions{
+			Services:           testServices{"protofake.test.Greeter"},
+			DescriptorResolver: files,
+		}))
+	})
+
+	tests := []struct {
+		name    string
+		conf    config.ClientTLS
+		wantErr bool
+	}{
+		{name: "plaintext", conf: config.ClientTLS{}, wantErr: true},
+		{name: "system roots", conf: config.ClientTLS{Enabled: true}, wantErr: true},
+		{name: "CA file", conf: config.ClientTLS{CAFile: caFile}},
+		{name: "skip verify", conf: config.ClientTLS{InsecureSkipVerify: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creds, err := reflectionCredentials(tt.conf)
+			if err != nil {
+				t.Fatalf("reflectionCredentials() error = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			set, err := fetchReflectionDescriptors(ctx, addr, creds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fetchReflectionDescriptors() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(set.GetFile()) != 4 {
+				t.Errorf("fetchReflectionDescriptors() files = %v", descriptorSetFiles(set))
+			}
+		})
+	}
+
+	t.Run("invalid CA file", func(t *testing.T) {
+		if _, err := reflectionCredentials(config.ClientTLS{CAFile: filepath.Join(dir, "missing.pem")}); err == nil {
+			t.Errorf("reflectionCredentials() error = nil, want the read error")
+		}
+	})
+}
+
+// writeTestCertificate writes the self-signed certificate of the loopback address to the dir,
+// returns the path of the certificate file.
+func writeTestCertificate(t *testing.T, dir string) (string, tls.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "protofake test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+
+	path := filepath.Join(dir, "cert.pem")
+	if err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("write certificate: %v", err)
+	}
+
+	return path, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
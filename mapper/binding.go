@@ -0,0 +1,412 @@
+package mapper
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// fieldBinding is the protobuf field, the matcher json path points to.
+type fieldBinding struct {
+	field protoreflect.FieldDescriptor
+	// list is true, when the path points to the whole repeated field, not to the single element.
+	list bool
+}
+
+// resolveField finds the field of the message by the json path.
+// Returns nil if the path could not be resolved, e.g. it contains the gjson modifiers.
+func resolveField(md protoreflect.MessageDescriptor, path string) *fieldBinding {
+	if md == nil || path == "" || strings.ContainsAny(path, `@|*?\`) {
+		return nil
+	}
+
+	segments := strings.Split(path, ".")
+	var binding *fieldBinding
+	// each is true, when the "#" segment selects the next field of each list element.
+	var each bool
+	for i, segment := range segments {
+		if binding != nil {
+			fd := binding.field
+			switch {
+			case binding.list && isIndex(segment):
+				binding = binding.element()
+				each = false
+				continue
+			case binding.list && segment == "#":
+				if i == len(segments)-1 || each {
+					return nil // the length of the list or nested projection
+				}
+				each = true
+				continue
+			case fd.IsMap():
+				binding = &fieldBinding{field: fd.MapValue(), list: each}
+				continue
+			case fd.Message() == nil || (binding.list && !each):
+				return nil
+			}
+
+			md = fd.Message()
+		}
+
+		fd := md.Fields().ByName(protoreflect.Name(segment))
+		if fd == nil {
+			fd = md.Fields().ByJSONName(segment)
+		}
+		if fd == nil || (each && (fd.IsList() || fd.IsMap())) {
+			return nil
+		}
+
+		binding = &fieldBinding{field: fd, list: fd.IsList() || each}
+	}
+
+	return binding
+}
+
+// bind binds the matcher to the field, the expected value is normalized by the field type.
+func (m *ValueMatcher) bind(b *fieldBinding) error {
+	switch m.Rule { //nolint:exhaustive
+	case MatchingRuleEqual, MatchingRuleGreater, MatchingRuleGreaterOrEqual, MatchingRuleLess, MatchingRuleLessOrEqual:
+		expected, err := b.normalize(m.Value)
+		if err != nil {
+			return fmt.Errorf("the value %s is not valid for field '%s': %w", formatValue(m.Value), b.field.FullName(), err)
+		}
+
+		m.binding, m.expected = b, expected
+	case MatchingRuleContains:
+		if !b.list {
+			return nil
+		}
+		expected, err := b.element().normalize(m.Value)
+		if err != nil {
+			return fmt.Errorf("the value %s is not valid for element of field '%s': %w", formatValue(m.Value), b.field.FullName(), err)
+		}
+
+		m.binding, m.expected = b, expected
+	case MatchingRuleIn, MatchingRuleBetween:
+		if b.list {
+			return nil
+		}
+		expected, err := (&fieldBinding{field: b.field, list: true}).normalize(m.Value)
+		if err != nil {
+			return fmt.Errorf("the value %s is not valid for field '%s': %w", formatValue(m.Value), b.field.FullName(), err)
+		}
+
+		m.binding, m.expected = b, expected
+	case MatchingRuleNot:
+		nested, err := asValueMatcher(m.Value)
+		if err != nil {
+			return err
+		}
+
+		return nested.bind(b)
+	case MatchingRuleAllOf, MatchingRuleAnyOf, MatchingRuleNoneOf:
+		nested, err := asValueMatchers(m.Value)
+		if err != nil {
+			return err
+		}
+		for i, n := range nested {
+			if err = n.bind(b); err != nil {
+				return fmt.Errorf("matcher at index %d: %w", i, err)
+			}
+		}
+
+		m.Value = nested
+	case MatchingRuleAnyElement, MatchingRuleEveryElement, MatchingRuleNoElement:
+		if !b.list {
+			return nil
+		}
+		nested, err := asElementMatchers(m.Value)
+		if err != nil {
+			return err
+		}
+
+		bound := make(map[string]ValueMatcher, len(nested))
+		for k, n := range nested {
+			var eb *fieldBinding
+			switch {
+			case k == "@this":
+				eb = b.element()
+			case b.field.Message() != nil:
+				eb = resolveField(b.field.Message(), k)
+			}
+			if eb != nil {
+				if err = n.bind(eb); err != nil {
+					return fmt.Errorf("element matcher for key '%s': %w", k, err)
+				}
+			}
+
+			bound[k] = n
+		}
+
+		m.Value = bound
+	}
+
+	return nil
+}
+
+// expectedValue returns the matcher value, normalized by the bound field type.
+func (m *ValueMatcher) expectedValue() any {
+	if m.binding != nil {
+		return m.expected
+	}
+
+	return m.Value
+}
+
+// zeroValue returns the value of the field, which is omitted by protojson, when it is not set:
+// the default value of the scalar field without presence and the empty list of the repeated field.
+// The fields with presence, e.g. the messages, the oneof members and the proto3 optional fields, have no zero value.
+func (b *fieldBinding) zeroValue() (any, bool) {
+	fd := b.field
+	switch {
+	case b.list:
+		return []any{}, true
+	case fd.IsMap() || fd.HasPresence():
+		return nil, false
+	}
+
+	switch fd.Kind() { //nolint:exhaustive
+	case protoreflect.BoolKind:
+		return false, true
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return "", true
+	case protoreflect.EnumKind:
+		zero, err := toEnumName(fd.Enum(), int64(fd.Default().Enum()))
+		return zero, err == nil
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return nil, false
+	default:
+		return 0.0, true
+	}
+}
+
+// isIndex reports whether the path segment is the list index, "-1" is the sjson index to append the element.
+func isIndex(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 64)
+	return err == nil || s == "-1"
+}
+
+// element returns the binding of the single list element.
+func (b *fieldBinding) element() *fieldBinding {
+	return &fieldBinding{field: b.field}
+}
+
+// normalize converts the JSON value into the canonical representation of the field type,
+// so the values, encoded by protojson, could be compared with the values from the mapping:
+//   - 64-bit integers (encoded as strings) are converted to int64/uint64;
+//   - enums are represented by the value name;
+//   - bytes are represented by the standard base64 encoding;
+//   - google.protobuf.Timestamp is represented by the RFC3339 string in UTC;
+//   - google.protobuf.Duration is represented by the number of seconds.
+func (b *fieldBinding) normalize(val any) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	if b.list {
+		list, ok := val.([]any)
+		if !ok {
+			return nil, fmt.Errorf("expected the list value for repeated field '%s', got %T", b.field.FullName(), val)
+		}
+
+		out := make([]any, 0, len(list))
+		for _, item := range list {
+			v, err := normalizeScalar(b.field, item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+
+		return out, nil
+	}
+
+	return normalizeScalar(b.field, val)
+}
+
+func normalizeScalar(fd protoreflect.FieldDescriptor, val any) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	switch fd.Kind() {
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return toInt64(val)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind, protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return toUint64(val)
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		return toFloat(val)
+	case protoreflect.EnumKind:
+		return toEnumName(fd.Enum(), val)
+	case protoreflect.BytesKind:
+		return toBase64(val)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return normalizeWellKnown(fd.Message(), val)
+	default:
+		return val, nil
+	}
+}
+
+func normalizeWellKnown(md protoreflect.MessageDescriptor, val any) (any, error) {
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		str, ok := val.(string)
+		if !ok {
+			return nil, fmt.Errorf("expected RFC3339 timestamp string, got %T", val)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return nil, fmt.Errorf("expected RFC3339 timestamp: %w", err)
+		}
+
+		return ts.UTC().Format(time.RFC3339Nano), nil
+	case "google.protobuf.Duration":
+		switch v := val.(type) {
+		case string:
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("expected duration string, e.g. \"1.5s\": %w", err)
+			}
+
+			return d.Seconds(), nil
+		default:
+			return toFloat(val) // already normalized value
+		}
+	case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+		"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+		"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+		"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+		return normalizeScalar(md.Fields().ByName("value"), val)
+	default:
+		return val, nil
+	}
+}
+
+func toInt64(val any) (any, error) {
+	switch v := val.(type) {
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected integer value, got %q", v)
+		}
+
+		return i, nil
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v > math.MaxInt64 {
+			return nil, fmt.Errorf("expected integer value, got %v", v)
+		}
+
+		return int64(v), nil
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil, fmt.Errorf("integer value %v overflows int64", v)
+		}
+
+		return int64(v), nil
+	default:
+		return nil, fmt.Errorf("expected integer value, got %T", val)
+	}
+}
+
+func toUint64(val any) (any, error) {
+	switch v := val.(type) {
+	case string:
+		i, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected unsigned integer value, got %q", v)
+		}
+
+		return i, nil
+	case float64:
+		if v != math.Trunc(v) || v < 0 || v > math.MaxUint64 {
+			return nil, fmt.Errorf("expected unsigned integer value, got %v", v)
+		}
+
+		return uint64(v), nil
+	case int:
+		if v < 0 {
+			return nil, fmt.Errorf("expected unsigned integer value, got %v", v)
+		}
+
+		return uint64(v), nil
+	case int64:
+		if v < 0 {
+			return nil, fmt.Errorf("expected unsigned integer value, got %v", v)
+		}
+
+		return uint64(v), nil
+	case uint64:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("expected unsigned integer value, got %T", val)
+	}
+}
+
+func toFloat(val any) (any, error) {
+	switch v := val.(type) {
+	case float64:
+		return v, nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case string: // protojson encodes the special values as strings
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected number value, got %q", v)
+		}
+
+		return f, nil
+	default:
+		return nil, fmt.Errorf("expected number value, got %T", val)
+	}
+}
+
+func toEnumName(ed protoreflect.EnumDescriptor, val any) (any, error) {
+	switch v := val.(type) {
+	case string:
+		if ed.Values().ByName(protoreflect.Name(v)) == nil {
+			return nil, fmt.Errorf("unknown value %q of enum '%s'", v, ed.FullName())
+		}
+
+		return v, nil
+	default:
+		num, err := toInt64(val)
+		if err != nil {
+			return nil, fmt.Errorf("expected enum value name or number: %w", err)
+		}
+		ev := ed.Values().ByNumber(protoreflect.EnumNumber(num.(int64))) //nolint:gosec
+		if ev == nil {
+			return num, nil // protojson encodes the unknown enum values as numbers
+		}
+
+		return string(ev.Name()), nil
+	}
+}
+
+func toBase64(val any) (any, error) {
+	str, ok := val.(string)
+	if !ok {
+		return nil, fmt.Errorf("expected base64 encoded string, got %T", val)
+	}
+
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if b, err := enc.DecodeString(str); err == nil {
+			return base64.StdEncoding.EncodeToString(b), nil
+		}
+	}
+
+	return nil, fmt.Errorf("expected base64 encoded string, got %q", str)
+}
@@ -0,0 +1,220 @@
+package mapper
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+
+	_ "google.golang.org/protobuf/types/known/durationpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	_ "google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testProto = `
+name: "binding_test.proto"
+package: "protofake.test"
+dependency: ["google/protobuf/timestamp.proto", "google/protobuf/duration.proto", "google/protobuf/wrappers.proto"]
+syntax: "proto3"
+enum_type {
+  name: "Status"
+  value { name: "STATUS_UNSPECIFIED" number: 0 }
+  value { name: "STATUS_ACTIVE" number: 1 }
+  value { name: "STATUS_DELETED" number: 2 }
+}
+message_type {
+  name: "Item"
+  field { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_INT64 json_name: "id" }
+  field { name: "status" number: 2 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".protofake.test.Status" json_name: "status" }
+}
+message_type {
+  name: "Request"
+  field { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_INT64 json_name: "id" }
+  field { name: "count" number: 2 label: LABEL_OPTIONAL type: TYPE_UINT64 json_name: "count" }
+  field { name: "status" number: 3 label: LABEL_OPTIONAL type: TYPE_ENUM type_name: ".protofake.test.Status" json_name: "status" }
+  field { name: "payload" number: 4 label: LABEL_OPTIONAL type: TYPE_BYTES json_name: "payload" }
+  field { name: "created_at" number: 5 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Timestamp" json_name: "createdAt" }
+  field { name: "ttl" number: 6 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Duration" json_name: "ttl" }
+  field { name: "ids" number: 7 label: LABEL_REPEATED type: TYPE_INT64 json_name: "ids" }
+  field { name: "limit" number: 8 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Int64Value" json_name: "limit" }
+  field { name: "items" number: 9 label: LABEL_REPEATED type: TYPE_MESSAGE type_name: ".protofake.test.Item" json_name: "items" }
+  field { name: "name" number: 10 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" oneof_index: 0 }
+  field { name: "email" number: 11 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "email" oneof_index: 0 }
+  oneof_decl { name: "filter" }
+}
+`
+
+func testMessageDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	fdp := new(descriptorpb.FileDescriptorProto)
+	if err := prototext.Unmarshal([]byte(testProto), fdp); err != nil {
+		t.Fatalf("unmarshal test proto: %v", err)
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatalf("construct test proto file: %v", err)
+	}
+
+	return fd.Messages().ByName("Request")
+}
+
+func TestMapping_Bind(t *testing.T) {
+	md := testMessageDescriptor(t)
+
+	msg := dynamicpb.NewMessage(md)
+	err := protojson.Unmarshal([]byte(`{
+		"id": "9007199254740993",
+		"count": "42",
+		"status": "STATUS_ACTIVE",
+		"payload": "aGVsbG8=",
+		"created_at": "2025-04-27T03:00:00+03:00",
+		"ttl": "90s",
+		"ids": ["1", "2", "3"],
+		"limit": "100",
+		"items": [{"id": "5", "status": "STATUS_DELETED"}]
+	}`), msg)
+	if err != nil {
+		t.Fatalf("unmarshal test message: %v", err)
+	}
+	// the same way as the request is converted in the handler
+	content, _ := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	var body map[string]any
+	if err = json.Unmarshal(content, &body); err != nil {
+		t.Fatalf("unmarshal test message json: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		matcher string
+		want    bool
+	}{
+		{"int64 equal number", `{"id": {"rule": "equal", "value": 9007199254740993}}`, true},
+		{"int64 equal string", `{"id": {"rule": "equal", "value": "9007199254740993"}}`, true},
+		{"int64 not equal precision", `{"id": {"rule": "equal", "value": "9007199254740992"}}`, false},
+		{"int64 gt precision", `{"id": {"rule": "gt", "value": 9007199254740992}}`, true},
+		{"int64 gte precision", `{"id": {"rule": "gte", "value": "9007199254740994"}}`, false},
+		{"int64 lt precision", `{"id": {"rule": "lt", "value": 9007199254740994}}`, true},
+		{"int64 between precision", `{"id": {"rule": "between", "value": [9007199254740993, 9007199254740993]}}`, true},
+		{"int64 out of range precision", `{"id": {"rule": "between", "value": [9007199254740994, 9007199254740999]}}`, false},
+		{"uint64 gt", `{"count": {"rule": "gt", "value": 41}}`, true},
+		{"int64 in", `{"count": {"rule": "in", "value": [1, 42]}}`, true},
+		{"enum by name", `{"status": {"rule": "equal", "value": "STATUS_ACTIVE"}}`, true},
+		{"enum by number", `{"status": {"rule": "equal", "value": 1}}`, true},
+		{"enum in", `{"status": {"rule": "in", "value": [2, "STATUS_ACTIVE"]}}`, true},
+		{"bytes base64", `{"payload": {"rule": "equal", "value": "aGVsbG8"}}`, true},
+		{"timestamp other offset", `{"created_at": {"rule": "equal", "value": "2025-04-27T00:00:00Z"}}`, true},
+		{"timestamp between", `{"created_at": {"rule": "between", "value": ["2025-01-01T00:00:00Z", "2025-12-31T00:00:00Z"]}}`, true},
+		{"duration", `{"ttl": {"rule": "equal", "value": "1m30s"}}`, true},
+		{"duration lt", `{"ttl": {"rule": "lt", "value": "1m"}}`, false},
+		{"repeated int64 contains", `{"ids": {"rule": "contains", "value": 2}}`, true},
+		{"wrapper int64", `{"limit": {"rule": "lte", "value": 100}}`, true},
+		{"element int64 and enum", `{"items": {"rule": "any_element", "value": {"id": {"rule": "equal", "value": 5}, "status": {"rule": "equal", "value": 2}}}}`, true},
+		{"not int64", `{"id": {"rule": "not", "value": {"rule": "equal", "value": 1}}}`, true},
+		{"regex on int64 string", `{"id": {"rule": "regex", "value": "^9007"}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var matchers map[string]ValueMatcher
+			if err := json.Unmarshal([]byte(tt.matcher), &matchers); err != nil {
+				t.Fatalf("unmarshal matchers: %v", err)
+			}
+
+			m := &Mapping{Endpoint: "/pkg.Service/Method", RequestBody: matchers}
+			if err := m.IsValid(); err != nil {
+				t.Fatalf("mapping is not valid: %v", err)
+			}
+			if errs := m.Validate(md, md, nil); len(errs) > 0 {
+				t.Fatalf("Mapping.Validate() errors = %v", errs)
+			}
+
+			if matched := m.Matches(&Request{Body: body, Message: msg}); matched != tt.want {
+				t.Errorf("%s, Mapping.Matches() = %v, want %v", tt.matcher, matched, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping_Matches__ZeroValue(t *testing.T) {
+	md := testMessageDescriptor(t)
+
+	// protojson omits the fields with the default values, the same way as the request is converted in the handler
+	msg := dynamicpb.NewMessage(md)
+	content, _ := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+	var body map[string]any
+	if err := json.Unmarshal(content, &body); err != nil {
+		t.Fatalf("unmarshal test message json: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		matcher string
+		want    bool
+	}{
+		{"int64 equal 0", `{"id": {"rule": "equal", "value": 0}}`, true},
+		{"uint64 equal string 0", `{"count": {"rule": "equal", "value": "0"}}`, true},
+		{"int64 lte 0", `{"id": {"rule": "lte", "value": 0}}`, true},
+		{"int64 in", `{"id": {"rule": "in", "value": [0, 1]}}`, true},
+		{"int64 not equal 0", `{"id": {"rule": "not", "value": {"rule": "equal", "value": 0}}}`, false},
+		{"enum zero value", `{"status": {"rule": "equal", "value": "STATUS_UNSPECIFIED"}}`, true},
+		{"enum zero number", `{"status": {"rule": "equal", "value": 0}}`, true},
+		{"bytes empty", `{"payload": {"rule": "equal", "value": ""}}`, true},
+		{"absent is kept", `{"id": {"rule": "absent"}}`, true},
+		{"oneof member has presence", `{"name": {"rule": "equal", "value": ""}}`, false},
+		{"message has presence", `{"limit": {"rule": "equal", "value": 0}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var matchers map[string]ValueMatcher
+			if err := json.Unmarshal([]byte(tt.matcher), &matchers); err != nil {
+				t.Fatalf("unmarshal matchers: %v", err)
+			}
+
+			m := &Mapping{Endpoint: "/pkg.Service/Method", RequestBody: matchers}
+			if errs := m.Validate(md, md, nil); len(errs) > 0 {
+				t.Fatalf("Mapping.Validate() errors = %v", errs)
+			}
+
+			if matched := m.Matches(&Request{Body: body, Message: msg}); matched != tt.want {
+				t.Errorf("%s, Mapping.Matches() = %v, want %v", tt.matcher, matched, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping_Validate__InvalidValue(t *testing.T) {
+	md := testMessageDescriptor(t)
+
+	tests := []string{
+		`{"id": {"rule": "equal", "value": "abc"}}`,
+		`{"id": {"rule": "equal", "value": 1.5}}`,
+		`{"count": {"rule": "gt", "value": -1}}`,
+		`{"status": {"rule": "equal", "value": "UNKNOWN_STATUS"}}`,
+		`{"created_at": {"rule": "equal", "value": "yesterday"}}`,
+		`{"ids": {"rule": "contains", "value": "one"}}`,
+		`{"items": {"rule": "every_element", "value": {"status": {"rule": "in", "value": ["STATUS_GONE"]}}}}`,
+	}
+
+	for _, tt := range tests {
+		var matchers map[string]ValueMatcher
+		if err := json.Unmarshal([]byte(tt), &matchers); err != nil {
+			t.Fatalf("unmarshal matchers: %v", err)
+		}
+
+		m := &Mapping{Endpoint: "/pkg.Service/Method", RequestBody: matchers}
+		if err := m.IsValid(); err != nil {
+			t.Fatalf("mapping is not valid: %v", err)
+		}
+		if errs := m.Validate(md, md, nil); len(errs) == 0 {
+			t.Errorf("%s, Mapping.Validate() expected errors", tt)
+		}
+	}
+}
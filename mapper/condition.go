@@ -0,0 +1,99 @@
+package mapper
+
+import "fmt"
+
+// Condition is the group of matchers, which could be composed with the other conditions.
+// All the defined parts of the condition should match the request.
+type Condition struct {
+	Metadata    map[string]ValueMatcher `json:"metadata,omitempty"`
+	RequestBody map[string]ValueMatcher `json:"request_body,omitempty"`
+	// Peer matches the client connection, see Request.PeerInfo.
+	Peer map[string]ValueMatcher `json:"peer,omitempty"`
+	// TLS matches the client certificate, see Request.TLSInfo.
+	TLS map[string]ValueMatcher `json:"tls,omitempty"`
+	// AllOf requires each of the conditions to match the request.
+	AllOf []Condition `json:"all_of,omitempty"`
+	// AnyOf requires at least one of the conditions to match the request.
+	AnyOf []Condition `json:"any_of,omitempty"`
+	// NoneOf requires none of the conditions to match the request.
+	NoneOf []Condition `json:"none_of,omitempty"`
+}
+
+// requestJSON is the JSON representation of the request parts, matched by the conditions.
+type requestJSON struct {
+	metadata []byte
+	body     []byte
+	peer     []byte
+	tls      []byte
+}
+
+func (c *Condition) matches(req *Request) bool {
+	encoded := req.encode()
+	if !match(encoded.metadata, c.Metadata, req) || !match(encoded.body, c.RequestBody, req) ||
+		!match(encoded.peer, c.Peer, req) || !match(encoded.tls, c.TLS, req) {
+		return false
+	}
+
+	for i := range c.AllOf {
+		if !c.AllOf[i].matches(req) {
+			return false
+		}
+	}
+	for i := range c.NoneOf {
+		if c.NoneOf[i].matches(req) {
+			return false
+		}
+	}
+	if len(c.AnyOf) == 0 {
+		return true
+	}
+	for i := range c.AnyOf {
+		if c.AnyOf[i].matches(req) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate checks the matchers of the condition and compiles them, e.g. the JSON schemas,
+// the relative schema file paths are resolved against the baseDir.
+// The compiled matchers replace the ones of the condition.
+func (c *Condition) validate(baseDir string) error {
+	parts := []struct {
+		name     string
+		matchers map[string]ValueMatcher
+	}{
+		{"metadata key", c.Metadata},
+		{"key", c.RequestBody},
+		{"peer key", c.Peer},
+		{"tls key", c.TLS},
+	}
+	for _, p := range parts {
+		for k, v := range p.matchers {
+			matcher, err := newValueMatcher(v.Rule, v.Value, baseDir)
+			if err != nil {
+				return fmt.Errorf("invalid value matcher for %s '%s': %w", p.name, k, err)
+			}
+			p.matchers[k] = *matcher
+		}
+	}
+
+	groups := []struct {
+		name       string
+		conditions []Condition
+	}{
+		{"all_of", c.AllOf},
+		{"any_of", c.AnyOf},
+		{"none_of", c.NoneOf},
+	}
+	for _, g := range groups {
+		for i := range g.conditions {
+			if err := g.conditions[i].validate(baseDir); err != nil {
+				return fmt.Errorf("%s[%d]: %w", g.name, i, err)
+			}
+		}
+	}
+
+	return nil
+}
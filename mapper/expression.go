@@ -0,0 +1,387 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ExpressionPrefix is the prefix of the response value, which is computed by the CEL expression.
+const ExpressionPrefix = "$cel:"
+
+// Request is the incoming request, which is matched by the Mapping.
+type Request struct {
+	Metadata metadata.MD
+	// Body is the JSON representation of the request message.
+	Body map[string]any
+	// Message is the decoded request message, it is available in the CEL expressions as `request`.
+	Message proto.Message
+	// Peer is the information about the client, sent the request.
+	Peer *peer.Peer
+
+	// encoded is the JSON representation of the request parts, built once for all the matched mappings.
+	encoded *requestJSON
+	// vars are the variables of the CEL expressions, built once for all the evaluated expressions.
+	vars map[string]any
+}
+
+// encode returns the JSON representation of the request parts, matched by the conditions.
+// It is built on the first call, the request should not be changed after that.
+func (r *Request) encode() *requestJSON {
+	if r.encoded != nil {
+		return r.encoded
+	}
+
+	md := make(map[string]any, r.Metadata.Len())
+	for k, v := range r.Metadata {
+		md[k] = strings.Join(v, ",")
+	}
+
+	r.encoded = &requestJSON{}
+	r.encoded.metadata, _ = json.Marshal(md)
+	r.encoded.body, _ = json.Marshal(r.Body)
+	r.encoded.peer, _ = json.Marshal(r.PeerInfo())
+	r.encoded.tls, _ = json.Marshal(r.TLSInfo())
+
+	return r.encoded
+}
+
+// expressionVars returns the variables, available in the mapping CEL expressions.
+// The request message is passed as is only for the typed `request` variable.
+func (r *Request) expressionVars(typed bool) map[string]any {
+	if r.vars == nil {
+		md := make(map[string]string, r.Metadata.Len())
+		for k, v := range r.Metadata {
+			md[k] = strings.Join(v, ",")
+		}
+
+		r.vars = map[string]any{
+			"metadata": md,
+			"peer":     r.PeerInfo(),
+			"tls":      r.TLSInfo(),
+		}
+	}
+
+	var msg any = r.Body
+	if typed {
+		msg = r.Message
+	}
+
+	vars := maps.Clone(r.vars)
+	vars["request"] = msg
+
+	return vars
+}
+
+// NewExpressionEnv creates the CEL environment for the mapping expressions.
+// The `request` variable is typed with the given input message descriptor,
+// if the descriptor is nil, the `request` is the JSON representation of the message.
+func NewExpressionEnv(input protoreflect.MessageDescriptor) (*cel.Env, error) {
+	requestType := cel.MapType(cel.StringType, cel.DynType)
+	opts := []cel.EnvOption{
+		cel.Variable("metadata", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("peer", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("tls", cel.MapType(cel.StringType, cel.DynType)),
+	}
+	if input != nil {
+		requestType = cel.ObjectType(string(input.FullName()))
+		opts = append(opts, cel.TypeDescs(input.ParentFile()))
+	}
+	opts = append(opts, cel.Variable("request", requestType))
+
+	return cel.NewEnv(opts...)
+}
+
+// expressions are the compiled CEL programs of the mapping.
+type expressions struct {
+	// programs is the compiled programs by expression.
+	programs map[string]cel.Program
+	// typed is true, when the programs are type-checked against the input message.
+	typed bool
+}
+
+// compileExpression compiles the CEL expression, if the output type is given, it is verified as well.
+// The dynamic output type is accepted, because it is known at evaluation time only.
+func compileExpression(env *cel.Env, expr string, output *cel.Type) (cel.Program, error) {
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("compile expression %q: %w", expr, issues.Err())
+	}
+	if output != nil && !ast.OutputType().IsExactType(output) && !ast.OutputType().IsExactType(cel.DynType) {
+		return nil, fmt.Errorf("expression %q should return %s, got %s", expr, output, ast.OutputType())
+	}
+
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("construct program for expression %q: %w", expr, err)
+	}
+
+	return prg, nil
+}
+
+// CompileExpressions compiles and type-checks the CEL expressions of the mapping
+// against the input message of the endpoint: the `when`, the cel matching rules and the computed response values.
+func (m *Mapping) CompileExpressions(input protoreflect.MessageDescriptor) error {
+	env, err := NewExpressionEnv(input)
+	if err != nil {
+		return fmt.Errorf("construct the expression environment: %w", err)
+	}
+	valueEnv, err := env.Extend(cel.Variable(valueVariable, cel.DynType))
+	if err != nil {
+		return fmt.Errorf("construct the expression environment: %w", err)
+	}
+	if err = m.condition().compileExpressions(valueEnv, input != nil); err != nil {
+		return err
+	}
+
+	programs := make(map[string]cel.Program)
+	if m.When != "" {
+		if programs[m.When], err = compileExpression(env, m.When, cel.BoolType); err != nil {
+			return fmt.Errorf("when: %w", err)
+		}
+	}
+	for k, v := range m.Response.Body {
+		str, ok := v.(string)
+		if !ok || !strings.HasPrefix(str, ExpressionPrefix) {
+			continue
+		}
+
+		expr := strings.TrimPrefix(str, ExpressionPrefix)
+		if programs[expr], err = compileExpression(env, expr, nil); err != nil {
+			return fmt.Errorf("response value %q: %w", k, err)
+		}
+	}
+
+	m.expressions = &expressions{programs: programs, typed: input != nil}
+	return nil
+}
+
+// Evaluate computes the result of the compiled mapping expression for the given request.
+func (m *Mapping) Evaluate(expr string, req *Request) (any, error) {
+	if m.expressions == nil {
+		return nil, fmt.Errorf("expression %q is not compiled", expr)
+	}
+	prg, ok := m.expressions.programs[expr]
+	if !ok {
+		return nil, fmt.Errorf("expression %q is not compiled", expr)
+	}
+
+	out, _, err := prg.Eval(req.expressionVars(m.expressions.typed))
+	if err != nil {
+		return nil, fmt.Errorf("evaluate expression %q: %w", expr, err)
+	}
+
+	value, err := nativeValue(out)
+	if err != nil {
+		return nil, fmt.Errorf("convert the result of expression %q: %w", expr, err)
+	}
+
+	return value, nil
+}
+
+// nativeValue converts the result of the expression into the JSON value. The integers are kept as int64 and uint64,
+// so the 64-bit field values are not rounded as the float JSON numbers, the other values are converted as google.protobuf.Value.
+func nativeValue(val ref.Val) (any, error) {
+	switch v := val.(type) {
+	case types.Int:
+		return int64(v), nil
+	case types.Uint:
+		return uint64(v), nil
+	case traits.Lister:
+		size, ok := v.Size().(types.Int)
+		if !ok {
+			return nil, fmt.Errorf("unexpected size of the list %v", v.Size())
+		}
+		list := make([]any, 0, int(size))
+		for i := range int64(size) {
+			el, err := nativeValue(v.Get(types.Int(i)))
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, el)
+		}
+
+		return list, nil
+	case traits.Mapper:
+		obj := make(map[string]any)
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			key := it.Next()
+			str, ok := key.(types.String)
+			if !ok {
+				return nil, fmt.Errorf("unsupported map key type %s, expected string", key.Type())
+			}
+			el, err := nativeValue(v.Get(key))
+			if err != nil {
+				return nil, err
+			}
+			obj[string(str)] = el
+		}
+
+		return obj, nil
+	}
+
+	value, err := val.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, err
+	}
+
+	return value.(*structpb.Value).AsInterface(), nil
+}
+
+func (m *Mapping) matchesWhen(req *Request) bool {
+	if m.When == "" {
+		return true
+	}
+
+	result, err := m.Evaluate(m.When, req)
+	if err != nil {
+		return false
+	}
+
+	matched, ok := result.(bool)
+	return ok && matched
+}
+
+// valueVariable is the variable of the cel matching rule, the matched value is available as.
+const valueVariable = "value"
+
+// untypedValueEnv is the CEL environment of the cel matching rule, which is not bound to the input message.
+var untypedValueEnv = sync.OnceValues(func() (*cel.Env, error) {
+	env, err := NewExpressionEnv(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Extend(cel.Variable(valueVariable, cel.DynType))
+})
+
+// compiledExpression is the compiled program of the cel matching rule.
+type compiledExpression struct {
+	program cel.Program
+	// typed is true, when the program is type-checked against the input message.
+	typed bool
+}
+
+// compileExpressions compiles the cel rules of the condition matchers, including the nested ones.
+// The compiled matchers replace the ones of the condition.
+func (c *Condition) compileExpressions(env *cel.Env, typed bool) error {
+	parts := []struct {
+		name     string
+		matchers map[string]ValueMatcher
+	}{
+		{"metadata key", c.Metadata},
+		{"key", c.RequestBody},
+		{"peer key", c.Peer},
+		{"tls key", c.TLS},
+	}
+	for _, p := range parts {
+		for k, v := range p.matchers {
+			if err := v.compileExpressions(env, typed); err != nil {
+				return fmt.Errorf("value matcher for %s '%s': %w", p.name, k, err)
+			}
+			p.matchers[k] = v
+		}
+	}
+
+	groups := []struct {
+		name       string
+		conditions []Condition
+	}{
+		{"all_of", c.AllOf},
+		{"any_of", c.AnyOf},
+		{"none_of", c.NoneOf},
+	}
+	for _, g := range groups {
+		for i := range g.conditions {
+			if err := g.conditions[i].compileExpressions(env, typed); err != nil {
+				return fmt.Errorf("%s[%d]: %w", g.name, i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// compileExpressions compiles the expression of the cel rule in the env, where the matched value is `value`.
+// The nested matchers of the composite rules are compiled as well.
+func (m *ValueMatcher) compileExpressions(env *cel.Env, typed bool) error {
+	switch m.Rule { //nolint:exhaustive
+	case MatchingRuleCEL:
+		expr, ok := m.Value.(string)
+		if !ok {
+			return fmt.Errorf("the rule %s: expected the CEL expression string, got %T", m.Rule, m.Value)
+		}
+		prg, err := compileExpression(env, expr, cel.BoolType)
+		if err != nil {
+			return fmt.Errorf("the rule %s: %w", m.Rule, err)
+		}
+
+		m.expression = &compiledExpression{program: prg, typed: typed}
+	case MatchingRuleNot, MatchingRuleLength:
+		nested, err := asValueMatcher(m.Value)
+		if err != nil {
+			return err
+		}
+
+		return nested.compileExpressions(env, typed)
+	case MatchingRuleAllOf, MatchingRuleAnyOf, MatchingRuleNoneOf:
+		nested, err := asValueMatchers(m.Value)
+		if err != nil {
+			return err
+		}
+		for _, n := range nested {
+			if err = n.compileExpressions(env, typed); err != nil {
+				return err
+			}
+		}
+	case MatchingRuleAnyElement, MatchingRuleEveryElement, MatchingRuleNoElement:
+		nested, err := asElementMatchers(m.Value)
+		if err != nil {
+			return err
+		}
+		for k, n := range nested {
+			if err = n.compileExpressions(env, typed); err != nil {
+				return fmt.Errorf("element matcher for key '%s': %w", k, err)
+			}
+			nested[k] = n
+		}
+		m.Value = nested
+	}
+
+	return nil
+}
+
+// matchesExpression evaluates the cel rule with the matched value and the variables of the request,
+// only the `value` is available, if the request is nil.
+func (m *ValueMatcher) matchesExpression(val any, req *Request) bool {
+	if _, isMissing := val.(missingValue); isMissing || m.expression == nil {
+		return false
+	}
+
+	vars := map[string]any{}
+	if req != nil {
+		vars = req.expressionVars(m.expression.typed)
+	}
+	vars[valueVariable] = val
+
+	out, _, err := m.expression.program.Eval(vars)
+	if err != nil {
+		return false
+	}
+
+	matched, ok := out.Value().(bool)
+	return ok && matched
+}
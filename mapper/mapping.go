@@ -3,12 +3,15 @@ package mapper
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/gobwas/glob"
 	"github.com/google/uuid"
 	"github.com/tidwall/gjson"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
 )
 
 var StrToCode = map[string]codes.Code{
@@ -37,7 +40,136 @@ type Mapping struct {
 	Endpoint    string                  `json:"endpoint"`
 	Metadata    map[string]ValueMatcher `json:"metadata"`
 	RequestBody map[string]ValueMatcher `json:"request_body"`
-	Response    Response                `json:"response"`
+	// Peer matches the client connection, e.g. the "ip", see Request.PeerInfo.
+	Peer map[string]ValueMatcher `json:"peer,omitempty"`
+	// TLS matches the client certificate, e.g. the "subject" or the "sans", see Request.TLSInfo.
+	TLS map[string]ValueMatcher `json:"tls,omitempty"`
+	// AllOf requires each of the conditions to match the request.
+	AllOf []Condition `json:"all_of,omitempty"`
+	// AnyOf requires at least one of the conditions to match the request.
+	AnyOf []Condition `json:"any_of,omitempty"`
+	// NoneOf requires none of the conditions to match the request.
+	NoneOf []Condition `json:"none_of,omitempty"`
+	// When is the CEL expression, which should evaluate to true for the matched request.
+	When string `json:"when,omitempty"`
+	// Fallback marks the mapping, which is used only when none of the regular mappings of the method
+	// matches the request, e.g. the default response of the service with the endpoint pattern.
+	Fallback bool     `json:"fallback,omitempty"`
+	Response Response `json:"response"`
+	// Origin is the way the mapping is registered, it defines the precedence over the mappings of other origins.
+	Origin Origin `json:"-"`
+	// Source is the file, the mapping is loaded from, empty for the mappings registered in runtime.
+	Source string `json:"-"`
+	// Position is the location of the mapping in the Source file.
+	Position Position `json:"-"`
+	// Positions are the locations of the mapping keys in the Source file by path,
+	// e.g. "request_body.id" or "any_of[0].metadata.x-user-id".
+	Positions map[string]Position `json:"-"`
+
+	expressions *expressions
+	// endpointPattern is the compiled Endpoint, if it is the glob pattern.
+	endpointPattern glob.Glob
+}
+
+// endpointPatternChars are the characters, which make the Endpoint the glob pattern.
+const endpointPatternChars = "*?[{"
+
+// Origin is the way the mapping is registered.
+type Origin string
+
+const (
+	// OriginFile is the origin of the mappings, loaded from the mappings directory.
+	OriginFile Origin = "file"
+	// OriginAPI is the origin of the mappings, registered via the admin API.
+	OriginAPI Origin = "api"
+	// OriginRecording is the origin of the mappings, recorded from the responses of the real services.
+	OriginRecording Origin = "recording"
+)
+
+// Origins are all the known origins of the mappings.
+var Origins = []Origin{OriginFile, OriginAPI, OriginRecording}
+
+// Position is the line and the column in the mapping source file, both are 1-based.
+// The column is zero, when only the line is known.
+type Position struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// IsValid reports whether the position is known.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if p.Column == 0 {
+		return strconv.Itoa(p.Line)
+	}
+
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// Location returns the source location of the mapping in the "file:line:column" format,
+// empty for the mappings registered in runtime.
+func (m *Mapping) Location() string {
+	if m.Source == "" || !m.Position.IsValid() {
+		return m.Source
+	}
+
+	return m.Source + ":" + m.Position.String()
+}
+
+// PositionOf returns the position of the key by its path inside the mapping.
+// If the key position is unknown, the position of the closest parent key is returned, the mapping position at last.
+func (m *Mapping) PositionOf(path string) Position {
+	for path != "" {
+		if pos, ok := m.Positions[path]; ok {
+			return pos
+		}
+
+		i := strings.LastIndexAny(path, ".[")
+		if i < 0 {
+			break
+		}
+		path = path[:i]
+	}
+
+	return m.Position
+}
+
+// IsPattern reports whether the Endpoint is the glob pattern, e.g. "/acme.billing.v1.*/*" or "/pkg.Service/List*".
+// The pattern mapping is applied to each matched method.
+func (m *Mapping) IsPattern() bool {
+	return strings.ContainsAny(m.Endpoint, endpointPatternChars)
+}
+
+// EndpointMatches reports whether the mapping is applied to the method, the full method name is expected
+// (e.g. "/package.Service/Method"). The mapping should be valid, see IsValid.
+func (m *Mapping) EndpointMatches(fullMethodName string) bool {
+	if m.endpointPattern != nil {
+		return m.endpointPattern.Match(fullMethodName)
+	}
+
+	return m.Endpoint == fullMethodName
+}
+
+// Clone returns the deep copy of the mapping with the source location, the copy is not bound to any descriptor,
+// so it should be validated before it is used for matching.
+func (m *Mapping) Clone() (*Mapping, error) {
+	content, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("marshal mapping %s: %w", m.ID, err)
+	}
+
+	clone := new(Mapping)
+	if err = json.Unmarshal(content, clone); err != nil {
+		return nil, fmt.Errorf("unmarshal mapping %s: %w", m.ID, err)
+	}
+
+	clone.Origin, clone.Source = m.Origin, m.Source
+	clone.Position, clone.Positions = m.Position, maps.Clone(m.Positions)
+
+	return clone, nil
 }
 
 // Response is the output values.
@@ -46,24 +178,34 @@ type Response struct {
 	Body map[string]any `json:"body"`
 	// ErrorMessage is applied when the Code is not codes.OK.
 	ErrorMessage string `json:"error_message"`
+	// Generate fills the fields of the response message, which are not set by the Body, with the sample values.
+	Generate bool `json:"generate,omitempty"`
+	// Payload is the raw protobuf response message, base64-encoded in JSON.
+	// It is used for the methods without descriptors only, see Mapping.ValidateRaw.
+	Payload []byte `json:"payload,omitempty"`
 }
 
 // Matches checks if the given request can be processed by Mapping.
-func (m *Mapping) Matches(md metadata.MD, body map[string]any) bool {
-	if !m.matchesMetadata(md) {
+// The JSON representation of the request is built on the first match and reused by the other mappings.
+func (m *Mapping) Matches(req *Request) bool {
+	if !m.condition().matches(req) {
 		return false
 	}
 
-	return match(body, m.RequestBody)
+	return m.matchesWhen(req)
 }
 
-func (m *Mapping) matchesMetadata(md metadata.MD) bool {
-	mdobj := make(map[string]any, md.Len())
-	for k, v := range md {
-		mdobj[k] = strings.Join(v, ",")
+// condition returns the matching rules of the mapping as a single Condition.
+func (m *Mapping) condition() *Condition {
+	return &Condition{
+		Metadata:    m.Metadata,
+		RequestBody: m.RequestBody,
+		Peer:        m.Peer,
+		TLS:         m.TLS,
+		AllOf:       m.AllOf,
+		AnyOf:       m.AnyOf,
+		NoneOf:      m.NoneOf,
 	}
-
-	return match(mdobj, m.Metadata)
 }
 
 // IsValid checks if the mapping is valid, if not it returns an error.
@@ -86,15 +228,20 @@ func (m *Mapping) IsValid() error {
 	if len(endpointParts) != 2 {
 		return fmt.Errorf("mapping endpoint '%s' should be in the format 'package.service/method'", m.Endpoint)
 	}
-
-	for k, v := range m.Metadata {
-		if _, err := NewValueMatcher(v.Rule, v.Value); err != nil {
-			return fmt.Errorf("invalid value matcher for key '%s' in mapping '%s': %w", k, m.Endpoint, err)
+	if m.IsPattern() {
+		pattern, err := glob.Compile(m.Endpoint, '/')
+		if err != nil {
+			return fmt.Errorf("mapping endpoint '%s' is not a valid glob pattern: %w", m.Endpoint, err)
 		}
+		m.endpointPattern = pattern
 	}
-	for k, v := range m.RequestBody {
-		if _, err := NewValueMatcher(v.Rule, v.Value); err != nil {
-			return fmt.Errorf("invalid value matcher for key '%s' in mapping '%s': %w", k, m.Endpoint, err)
+
+	if err := m.condition().validate(m.schemaDir()); err != nil {
+		return fmt.Errorf("mapping '%s': %w", m.Endpoint, err)
+	}
+	if m.expressions == nil {
+		if err := m.CompileExpressions(nil); err != nil {
+			return fmt.Errorf("mapping '%s': %w", m.Endpoint, err)
 		}
 	}
 
@@ -105,16 +252,24 @@ func (m *Mapping) IsValid() error {
 	return nil
 }
 
-func match(target map[string]any, mappings map[string]ValueMatcher) bool {
-	jsonBody, _ := json.Marshal(target)
+// schemaDir returns the directory, the relative schema file paths of the mapping are resolved against,
+// empty for the mappings registered in runtime.
+func (m *Mapping) schemaDir() string {
+	if m.Source == "" {
+		return ""
+	}
 
+	return filepath.Dir(m.Source)
+}
+
+func match(jsonBody []byte, mappings map[string]ValueMatcher, req *Request) bool {
 	for key, matcher := range mappings {
-		data := gjson.GetBytes(jsonBody, key)
-		if !data.Exists() {
-			return false
+		var value any = missing
+		if data := gjson.GetBytes(jsonBody, key); data.Exists() {
+			value = data.Value()
 		}
 
-		if !matcher.Matches(data.Value()) {
+		if !matcher.matches(value, req) {
 			return false
 		}
 	}
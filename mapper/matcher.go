@@ -1,12 +1,16 @@
 package mapper
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/gobwas/glob"
+	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
 // MatchingRule is the rule, defining how the value should be matched.
@@ -24,6 +28,51 @@ const (
 	// MatchingRuleGlob is the rule, defining the value should match the given glob pattern.
 	// Glob is a wildcard pattern, where * is a wildcard for any character, and ? is a wildcard for one character.
 	MatchingRuleGlob MatchingRule = "glob"
+	// MatchingRuleGreater is the rule, defining the value should be greater than the given number or timestamp.
+	MatchingRuleGreater MatchingRule = "gt"
+	// MatchingRuleGreaterOrEqual is the rule, defining the value should be greater than or equal to the given number or timestamp.
+	MatchingRuleGreaterOrEqual MatchingRule = "gte"
+	// MatchingRuleLess is the rule, defining the value should be less than the given number or timestamp.
+	MatchingRuleLess MatchingRule = "lt"
+	// MatchingRuleLessOrEqual is the rule, defining the value should be less than or equal to the given number or timestamp.
+	MatchingRuleLessOrEqual MatchingRule = "lte"
+	// MatchingRuleBetween is the rule, defining the value should be within the inclusive range [min, max].
+	// The matcher value is a two-element list of numbers or RFC3339 timestamps.
+	MatchingRuleBetween MatchingRule = "between"
+	// MatchingRuleIn is the rule, defining the value should be equal to one of the given list values.
+	MatchingRuleIn MatchingRule = "in"
+	// MatchingRuleExists is the rule, defining the value should be present, the matcher value is ignored.
+	MatchingRuleExists MatchingRule = "exists"
+	// MatchingRuleAbsent is the rule, defining the value should not be present, the matcher value is ignored.
+	MatchingRuleAbsent MatchingRule = "absent"
+	// MatchingRuleEmpty is the rule, defining the value should be absent, null, empty string, empty list or empty object.
+	// The matcher value is ignored.
+	MatchingRuleEmpty MatchingRule = "empty"
+	// MatchingRuleNot is the rule, inverting the result of the nested matcher, given as the value.
+	MatchingRuleNot MatchingRule = "not"
+	// MatchingRuleAllOf is the rule, defining the value should satisfy each of the nested matchers, given as the list value.
+	MatchingRuleAllOf MatchingRule = "all_of"
+	// MatchingRuleAnyOf is the rule, defining the value should satisfy at least one of the nested matchers, given as the list value.
+	MatchingRuleAnyOf MatchingRule = "any_of"
+	// MatchingRuleNoneOf is the rule, defining the value should satisfy none of the nested matchers, given as the list value.
+	MatchingRuleNoneOf MatchingRule = "none_of"
+	// MatchingRuleAnyElement is the rule, defining at least one element of the list should satisfy the matchers,
+	// given as the object value, where the key is the json path inside the element.
+	MatchingRuleAnyElement MatchingRule = "any_element"
+	// MatchingRuleEveryElement is the rule, defining each element of the list should satisfy the matchers,
+	// given as the object value, where the key is the json path inside the element.
+	MatchingRuleEveryElement MatchingRule = "every_element"
+	// MatchingRuleNoElement is the rule, defining none of the list elements should satisfy the matchers,
+	// given as the object value, where the key is the json path inside the element.
+	MatchingRuleNoElement MatchingRule = "no_element"
+	// MatchingRuleLength is the rule, defining the length of the list, object or string should satisfy the nested matcher.
+	MatchingRuleLength MatchingRule = "length"
+	// MatchingRuleJSONSchema is the rule, defining the value should be valid against the JSON schema.
+	// The matcher value is either the inline schema object or the path to the schema file.
+	MatchingRuleJSONSchema MatchingRule = "json_schema"
+	// MatchingRuleCEL is the rule, defining the CEL expression should evaluate to true,
+	// where the matched value is available as `value` variable, along with the variables of the mapping expressions.
+	MatchingRuleCEL MatchingRule = "cel"
 )
 
 // ValueMatcher is the matching rule for the Value.
@@ -31,14 +80,262 @@ type ValueMatcher struct {
 	Rule MatchingRule `json:"rule"`
 	// Value is the value to match
 	Value any `json:"value"`
+
+	// binding is the field of the input message, the matcher is bound to.
+	binding *fieldBinding
+	// expected is the Value, normalized by the bound field type.
+	expected any
+	// schema is the compiled JSON schema of the json_schema rule.
+	schema *jsonschema.Schema
+	// expression is the compiled expression of the cel rule.
+	expression *compiledExpression
+}
+
+// UnmarshalJSON decodes the ValueMatcher, the nested matchers of the composite rules are decoded as *ValueMatcher.
+func (m *ValueMatcher) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Rule  MatchingRule    `json:"rule"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	m.Rule, m.Value = raw.Rule, nil
+	if len(raw.Value) == 0 {
+		return nil
+	}
+
+	switch raw.Rule { //nolint:exhaustive
+	case MatchingRuleNot, MatchingRuleLength:
+		nested := new(ValueMatcher)
+		if err := json.Unmarshal(raw.Value, nested); err != nil {
+			return fmt.Errorf("decode the nested matcher of rule %s: %w", raw.Rule, err)
+		}
+
+		m.Value = nested
+		return nil
+	case MatchingRuleAllOf, MatchingRuleAnyOf, MatchingRuleNoneOf:
+		var nested []*ValueMatcher
+		if err := json.Unmarshal(raw.Value, &nested); err != nil {
+			return fmt.Errorf("decode the nested matchers of rule %s: %w", raw.Rule, err)
+		}
+
+		m.Value = nested
+		return nil
+	case MatchingRuleAnyElement, MatchingRuleEveryElement, MatchingRuleNoElement:
+		var nested map[string]ValueMatcher
+		if err := json.Unmarshal(raw.Value, &nested); err != nil {
+			return fmt.Errorf("decode the element matchers of rule %s: %w", raw.Rule, err)
+		}
+
+		m.Value = nested
+		return nil
+	}
+
+	value, err := decodeValue(raw.Value)
+	if err != nil {
+		return err
+	}
+
+	m.Value = value
+	return nil
+}
+
+// decodeValue decodes the JSON value, the integer numbers are decoded as int64/uint64 to keep the precision.
+func decodeValue(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return convertNumbers(value), nil
+}
+
+func convertNumbers(val any) any {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i := range v {
+			v[i] = convertNumbers(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = convertNumbers(v[k])
+		}
+	}
+
+	return val
+}
+
+// asValueMatcher converts the matcher value of the composite rule into the ValueMatcher.
+func asValueMatcher(val any) (*ValueMatcher, error) {
+	switch v := val.(type) {
+	case *ValueMatcher:
+		if v == nil {
+			return nil, fmt.Errorf("the nested matcher is not provided")
+		}
+
+		return v, nil
+	case ValueMatcher:
+		return &v, nil
+	case map[string]any:
+		content, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode the nested matcher: %w", err)
+		}
+
+		nested := new(ValueMatcher)
+		if err = json.Unmarshal(content, nested); err != nil {
+			return nil, fmt.Errorf("decode the nested matcher: %w", err)
+		}
+
+		return nested, nil
+	default:
+		return nil, fmt.Errorf("expected the nested matcher object {\"rule\": ..., \"value\": ...}, got %T", val)
+	}
+}
+
+// asValueMatchers converts the list value of the composite rule into the ValueMatcher list.
+func asValueMatchers(val any) ([]*ValueMatcher, error) {
+	switch v := val.(type) {
+	case []*ValueMatcher:
+		return v, nil
+	case []ValueMatcher:
+		out := make([]*ValueMatcher, 0, len(v))
+		for i := range v {
+			out = append(out, &v[i])
+		}
+
+		return out, nil
+	case []any:
+		out := make([]*ValueMatcher, 0, len(v))
+		for i, item := range v {
+			nested, err := asValueMatcher(item)
+			if err != nil {
+				return nil, fmt.Errorf("matcher at index %d: %w", i, err)
+			}
+			out = append(out, nested)
+		}
+
+		return out, nil
+	default:
+		return nil, fmt.Errorf("expected the list of nested matchers, got %T", val)
+	}
 }
 
 // NewValueMatcher creates a new ValueMatcher.
+// The schema file of the json_schema rule should be given by the absolute path.
 func NewValueMatcher(rule MatchingRule, val any) (*ValueMatcher, error) {
+	return newValueMatcher(rule, val, "")
+}
+
+// newValueMatcher creates a new ValueMatcher, the relative schema file paths
+// of the json_schema rules are resolved against the baseDir.
+func newValueMatcher(rule MatchingRule, val any, baseDir string) (*ValueMatcher, error) {
 	if !rule.IsValid() {
 		return nil, fmt.Errorf("invalid matching rule: %s", rule)
 	}
 
+	switch rule { //nolint:exhaustive
+	case MatchingRuleGreater, MatchingRuleGreaterOrEqual, MatchingRuleLess, MatchingRuleLessOrEqual:
+		if _, ok := toOrdered(val); !ok {
+			return nil, fmt.Errorf("the rule %s is only valid for numbers, RFC3339 timestamps and durations, got %T", rule, val)
+		}
+
+		return &ValueMatcher{Rule: rule, Value: val}, nil
+	case MatchingRuleBetween:
+		if _, _, err := parseBounds(val); err != nil {
+			return nil, fmt.Errorf("the rule %s: %w", rule, err)
+		}
+
+		return &ValueMatcher{Rule: rule, Value: val}, nil
+	case MatchingRuleIn:
+		if err := validateList(val); err != nil {
+			return nil, fmt.Errorf("the rule %s: %w", rule, err)
+		}
+
+		return &ValueMatcher{Rule: rule, Value: val}, nil
+	case MatchingRuleExists, MatchingRuleAbsent, MatchingRuleEmpty:
+		return &ValueMatcher{Rule: rule, Value: val}, nil
+	case MatchingRuleNot, MatchingRuleLength:
+		nested, err := asValueMatcher(val)
+		if err != nil {
+			return nil, fmt.Errorf("the rule %s: %w", rule, err)
+		}
+		compiled, err := newValueMatcher(nested.Rule, nested.Value, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("the rule %s: %w", rule, err)
+		}
+
+		return &ValueMatcher{Rule: rule, Value: compiled}, nil
+	case MatchingRuleAllOf, MatchingRuleAnyOf, MatchingRuleNoneOf:
+		nested, err := asValueMatchers(val)
+		if err != nil {
+			return nil, fmt.Errorf("the rule %s: %w", rule, err)
+		}
+		if len(nested) == 0 {
+			return nil, fmt.Errorf("the rule %s: at least one nested matcher is required", rule)
+		}
+		compiled := make([]*ValueMatcher, 0, len(nested))
+		for i, n := range nested {
+			c, err := newValueMatcher(n.Rule, n.Value, baseDir)
+			if err != nil {
+				return nil, fmt.Errorf("the rule %s: matcher at index %d: %w", rule, i, err)
+			}
+			compiled = append(compiled, c)
+		}
+
+		return &ValueMatcher{Rule: rule, Value: compiled}, nil
+	case MatchingRuleAnyElement, MatchingRuleEveryElement, MatchingRuleNoElement:
+		nested, err := asElementMatchers(val)
+		if err != nil {
+			return nil, fmt.Errorf("the rule %s: %w", rule, err)
+		}
+		if len(nested) == 0 {
+			return nil, fmt.Errorf("the rule %s: at least one element matcher is required", rule)
+		}
+		compiled := make(map[string]ValueMatcher, len(nested))
+		for k, n := range nested {
+			c, err := newValueMatcher(n.Rule, n.Value, baseDir)
+			if err != nil {
+				return nil, fmt.Errorf("the rule %s: element matcher for key '%s': %w", rule, k, err)
+			}
+			compiled[k] = *c
+		}
+
+		return &ValueMatcher{Rule: rule, Value: compiled}, nil
+	case MatchingRuleJSONSchema:
+		schema, err := compileSchema(val, baseDir)
+		if err != nil {
+			return nil, fmt.Errorf("the rule %s: %w", rule, err)
+		}
+
+		return &ValueMatcher{Rule: rule, Value: val, schema: schema}, nil
+	case MatchingRuleCEL:
+		env, err := untypedValueEnv()
+		if err != nil {
+			return nil, fmt.Errorf("construct the expression environment: %w", err)
+		}
+		m := &ValueMatcher{Rule: rule, Value: val}
+		if err = m.compileExpressions(env, false); err != nil {
+			return nil, err
+		}
+
+		return m, nil
+	}
+
 	str, ok := val.(string)
 	if ok { // for the string any rule is valid
 		switch rule { //nolint:exhaustive
@@ -76,12 +373,63 @@ func NewValueMatcher(rule MatchingRule, val any) (*ValueMatcher, error) {
 }
 
 // Matches checks if the given value satisfies the rule.
+// The cel rule is evaluated with the `value` variable only, see Mapping.Matches for the other variables.
 func (m *ValueMatcher) Matches(val any) bool {
-	switch m.Rule {
+	return m.matches(val, nil)
+}
+
+// matches checks if the given value of the request satisfies the rule, the request is nil,
+// if the value is matched on its own.
+func (m *ValueMatcher) matches(val any, req *Request) bool {
+	_, isMissing := val.(missingValue)
+
+	switch m.Rule { //nolint:exhaustive
+	case MatchingRuleExists:
+		return !isMissing
+	case MatchingRuleAbsent:
+		return isMissing
+	case MatchingRuleEmpty:
+		return isMissing || isEmpty(val)
+	case MatchingRuleNot:
+		nested, err := asValueMatcher(m.Value)
+		if err != nil {
+			return false
+		}
+
+		return !nested.matches(val, req)
+	case MatchingRuleAllOf, MatchingRuleAnyOf, MatchingRuleNoneOf:
+		return m.matchesComposition(val, req)
+	case MatchingRuleAnyElement, MatchingRuleEveryElement, MatchingRuleNoElement:
+		return m.matchesElements(val, req)
+	case MatchingRuleLength:
+		return m.matchesLength(val, req)
+	case MatchingRuleJSONSchema:
+		return m.matchesSchema(val)
+	case MatchingRuleCEL:
+		return m.matchesExpression(val, req)
+	}
+	if isMissing && m.binding != nil {
+		// protojson omits the fields with the default values, they are matched by the default value
+		if zero, ok := m.binding.zeroValue(); ok {
+			val, isMissing = zero, false
+		}
+	}
+	if isMissing {
+		return false
+	}
+	if m.binding != nil {
+		normalized, err := m.binding.normalize(val)
+		if err != nil {
+			return false
+		}
+		val = normalized
+	}
+
+	switch m.Rule { //nolint:exhaustive
 	case MatchingRuleEqual:
 		return m.deepEqual(val)
 	case MatchingRuleEqualIgnoreCase:
-		a, b := reflect.ValueOf(m.Value), reflect.ValueOf(val)
+		a, b := reflect.ValueOf(m.expectedValue()), reflect.ValueOf(val)
 		if a.Kind() == reflect.String && b.Kind() == reflect.String {
 			return strings.EqualFold(a.String(), b.String())
 		}
@@ -119,6 +467,22 @@ func (m *ValueMatcher) Matches(val any) bool {
 		}
 
 		return g.Match(vval)
+	case MatchingRuleGreater:
+		c, ok := m.compare(val)
+		return ok && c > 0
+	case MatchingRuleGreaterOrEqual:
+		c, ok := m.compare(val)
+		return ok && c >= 0
+	case MatchingRuleLess:
+		c, ok := m.compare(val)
+		return ok && c < 0
+	case MatchingRuleLessOrEqual:
+		c, ok := m.compare(val)
+		return ok && c <= 0
+	case MatchingRuleBetween:
+		return m.between(val)
+	case MatchingRuleIn:
+		return m.in(val)
 	}
 
 	return false
@@ -131,7 +495,26 @@ func (mr MatchingRule) IsValid() bool {
 		MatchingRuleEqualIgnoreCase,
 		MatchingRuleContains,
 		MatchingRuleRegex,
-		MatchingRuleGlob:
+		MatchingRuleGlob,
+		MatchingRuleGreater,
+		MatchingRuleGreaterOrEqual,
+		MatchingRuleLess,
+		MatchingRuleLessOrEqual,
+		MatchingRuleBetween,
+		MatchingRuleIn,
+		MatchingRuleExists,
+		MatchingRuleAbsent,
+		MatchingRuleEmpty,
+		MatchingRuleNot,
+		MatchingRuleAllOf,
+		MatchingRuleAnyOf,
+		MatchingRuleNoneOf,
+		MatchingRuleAnyElement,
+		MatchingRuleEveryElement,
+		MatchingRuleNoElement,
+		MatchingRuleLength,
+		MatchingRuleJSONSchema,
+		MatchingRuleCEL:
 		return true
 	}
 
@@ -0,0 +1,210 @@
+package mapper
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ordered is the normalized representation of an ordered value:
+// either a number or an RFC3339 timestamp. The durations are represented by the number of seconds.
+// The integers keep the exact value as well, so the 64-bit integers are compared without the float64 precision loss.
+type ordered struct {
+	num    float64
+	ts     time.Time
+	isTime bool
+
+	// isInt is true, when the number is the integer, its exact value is in the int or in the uint, if isUint.
+	isInt  bool
+	isUint bool
+	int    int64
+	uint   uint64
+}
+
+// toOrdered converts the matcher value into the ordered value.
+// Strings are treated as RFC3339 timestamps first, as numbers then,
+// because protojson encodes 64-bit integers as strings, and as durations, e.g. "1.5s", at last.
+func toOrdered(val any) (ordered, bool) {
+	v := reflect.ValueOf(val)
+	if !v.IsValid() {
+		return ordered{}, false
+	}
+
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return ordered{num: float64(v.Int()), isInt: true, int: v.Int()}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return ordered{num: float64(v.Uint()), isInt: true, isUint: true, uint: v.Uint()}, true
+	case reflect.Float32, reflect.Float64:
+		return ordered{num: v.Float()}, true
+	}
+	if v.Kind() != reflect.String {
+		return ordered{}, false
+	}
+
+	if ts, err := time.Parse(time.RFC3339Nano, v.String()); err == nil {
+		return ordered{ts: ts, isTime: true}, true
+	}
+	if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+		return ordered{num: float64(i), isInt: true, int: i}, true
+	}
+	if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+		return ordered{num: float64(u), isInt: true, isUint: true, uint: u}, true
+	}
+	if f, err := strconv.ParseFloat(v.String(), 64); err == nil {
+		return ordered{num: f}, true
+	}
+	if d, err := time.ParseDuration(v.String()); err == nil {
+		return ordered{num: d.Seconds()}, true
+	}
+
+	return ordered{}, false
+}
+
+// cmp compares two values of the same kind, returns false if kinds differ.
+func (c ordered) cmp(other ordered) (int, bool) {
+	if c.isTime != other.isTime {
+		return 0, false
+	}
+
+	if c.isTime {
+		return c.ts.Compare(other.ts), true
+	}
+	if c.isInt && other.isInt {
+		return c.cmpInt(other), true
+	}
+
+	switch {
+	case c.num < other.num:
+		return -1, true
+	case c.num > other.num:
+		return 1, true
+	default:
+		return 0, true
+	}
+}
+
+// cmpInt compares the exact values of two integers, either of them could be signed or unsigned.
+func (c ordered) cmpInt(other ordered) int {
+	switch {
+	case !c.isUint && !other.isUint:
+		return cmp.Compare(c.int, other.int)
+	case c.isUint && other.isUint:
+		return cmp.Compare(c.uint, other.uint)
+	case c.isUint:
+		if other.int < 0 {
+			return 1
+		}
+
+		return cmp.Compare(c.uint, uint64(other.int))
+	default:
+		if c.int < 0 {
+			return -1
+		}
+
+		return cmp.Compare(uint64(c.int), other.uint)
+	}
+}
+
+// compare returns the result of comparison of val against the matcher value:
+// -1 if val is less, 0 if equal, 1 if greater.
+func (m *ValueMatcher) compare(val any) (int, bool) {
+	want, ok := toOrdered(m.expectedValue())
+	if !ok {
+		return 0, false
+	}
+	got, ok := toOrdered(val)
+	if !ok {
+		return 0, false
+	}
+
+	return got.cmp(want)
+}
+
+func (m *ValueMatcher) between(val any) bool {
+	lower, upper, err := parseBounds(m.expectedValue())
+	if err != nil {
+		return false
+	}
+	got, ok := toOrdered(val)
+	if !ok {
+		return false
+	}
+
+	c, ok := got.cmp(lower)
+	if !ok || c < 0 {
+		return false
+	}
+	c, ok = got.cmp(upper)
+
+	return ok && c <= 0
+}
+
+func (m *ValueMatcher) in(val any) bool {
+	list := reflect.ValueOf(m.expectedValue())
+	if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return false
+	}
+
+	value := reflect.ValueOf(val)
+	for i := 0; i < list.Len(); i++ {
+		if deepEqual(reflect.ValueOf(list.Index(i).Interface()), value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseBounds extracts the [min, max] range of the between rule.
+func parseBounds(val any) (lower, upper ordered, err error) {
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return lower, upper, fmt.Errorf("expected a list of two values [min, max], got %T", val)
+	}
+	if v.Len() != 2 {
+		return lower, upper, fmt.Errorf("expected a list of two values [min, max], got %d values", v.Len())
+	}
+
+	var ok bool
+	if lower, ok = toOrdered(v.Index(0).Interface()); !ok {
+		return lower, upper, fmt.Errorf("the lower bound should be a number or RFC3339 timestamp, got %v", v.Index(0).Interface())
+	}
+	if upper, ok = toOrdered(v.Index(1).Interface()); !ok {
+		return lower, upper, fmt.Errorf("the upper bound should be a number or RFC3339 timestamp, got %v", v.Index(1).Interface())
+	}
+
+	c, ok := lower.cmp(upper)
+	if !ok {
+		return lower, upper, fmt.Errorf("the bounds should be of the same type")
+	}
+	if c > 0 {
+		return lower, upper, fmt.Errorf("the lower bound is greater than the upper bound")
+	}
+
+	return lower, upper, nil
+}
+
+// validateList checks the value is a list of primitive values.
+func validateList(val any) error {
+	v := reflect.ValueOf(val)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("expected a list of values, got %T", val)
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		switch t := v.Index(i).Interface().(type) {
+		case string:
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		case float32, float64:
+		case bool:
+		case nil:
+		default:
+			return fmt.Errorf("the list should contain primitive values only, got %T at index %d", t, i)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,37 @@
+package mapper
+
+func (m *ValueMatcher) matchesComposition(val any, req *Request) bool {
+	nested, err := asValueMatchers(m.Value)
+	if err != nil {
+		return false
+	}
+
+	switch m.Rule { //nolint:exhaustive
+	case MatchingRuleAllOf:
+		for _, n := range nested {
+			if !n.matches(val, req) {
+				return false
+			}
+		}
+
+		return true
+	case MatchingRuleAnyOf:
+		for _, n := range nested {
+			if n.matches(val, req) {
+				return true
+			}
+		}
+
+		return false
+	case MatchingRuleNoneOf:
+		for _, n := range nested {
+			if n.matches(val, req) {
+				return false
+			}
+		}
+
+		return true
+	default:
+		return false
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func (m *ValueMatcher) contains(val any) bool {
-	want, value := reflect.ValueOf(m.Value), reflect.ValueOf(val)
+	want, value := reflect.ValueOf(m.expectedValue()), reflect.ValueOf(val)
 
 	switch value.Kind() { //nolint:exhaustive
 	case reflect.String:
@@ -22,7 +22,7 @@ func (m *ValueMatcher) contains(val any) bool {
 
 	case reflect.Slice:
 		for i := 0; i < value.Len(); i++ {
-			if deepEqual(value.Index(i), want) {
+			if deepEqual(reflect.ValueOf(value.Index(i).Interface()), want) {
 				return true
 			}
 		}
@@ -0,0 +1,91 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// asElementMatchers converts the object value of the element rules into the matchers by json path.
+func asElementMatchers(val any) (map[string]ValueMatcher, error) {
+	switch v := val.(type) {
+	case map[string]ValueMatcher:
+		return v, nil
+	case map[string]any:
+		content, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode the element matchers: %w", err)
+		}
+
+		var nested map[string]ValueMatcher
+		if err = json.Unmarshal(content, &nested); err != nil {
+			return nil, fmt.Errorf("decode the element matchers: %w", err)
+		}
+
+		return nested, nil
+	default:
+		return nil, fmt.Errorf("expected the object of element matchers, where the key is the json path inside the element, got %T", val)
+	}
+}
+
+// matchesElements applies the element matchers to each element of the list.
+// The absent value is considered as an empty list, because protojson omits the empty repeated fields.
+func (m *ValueMatcher) matchesElements(val any, req *Request) bool {
+	nested, err := asElementMatchers(m.Value)
+	if err != nil {
+		return false
+	}
+
+	var elements []any
+	if _, isMissing := val.(missingValue); !isMissing && val != nil {
+		list, ok := val.([]any)
+		if !ok {
+			return false
+		}
+		elements = list
+	}
+
+	var matched int
+	for _, el := range elements {
+		elJSON, err := json.Marshal(el)
+		if err != nil {
+			return false
+		}
+		if match(elJSON, nested, req) {
+			matched++
+		}
+	}
+
+	switch m.Rule { //nolint:exhaustive
+	case MatchingRuleAnyElement:
+		return matched > 0
+	case MatchingRuleEveryElement:
+		return matched == len(elements)
+	case MatchingRuleNoElement:
+		return matched == 0
+	default:
+		return false
+	}
+}
+
+// matchesLength applies the nested matcher to the length of the list, object or string.
+// The absent value has zero length.
+func (m *ValueMatcher) matchesLength(val any, req *Request) bool {
+	nested, err := asValueMatcher(m.Value)
+	if err != nil {
+		return false
+	}
+
+	var length int
+	if _, isMissing := val.(missingValue); !isMissing && val != nil {
+		v := reflect.ValueOf(val)
+		switch v.Kind() { //nolint:exhaustive
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			length = v.Len()
+		default:
+			return false
+		}
+	}
+
+	return nested.matches(length, req)
+}
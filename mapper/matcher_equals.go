@@ -3,7 +3,7 @@ package mapper
 import "reflect"
 
 func (m *ValueMatcher) deepEqual(val any) bool {
-	v1, v2 := reflect.ValueOf(m.Value), reflect.ValueOf(val)
+	v1, v2 := reflect.ValueOf(m.expectedValue()), reflect.ValueOf(val)
 	return deepEqual(v1, v2)
 }
 
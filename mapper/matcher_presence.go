@@ -0,0 +1,25 @@
+package mapper
+
+import "reflect"
+
+// missingValue is the marker of the value, which is not present in the matched object.
+type missingValue struct{}
+
+// missing is passed to the ValueMatcher.Matches when the json path does not exist.
+var missing = missingValue{}
+
+func isEmpty(val any) bool {
+	v := reflect.ValueOf(val)
+	if !v.IsValid() {
+		return true
+	}
+
+	switch v.Kind() { //nolint:exhaustive
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	default:
+		return false
+	}
+}
@@ -0,0 +1,61 @@
+package mapper
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// compileSchema compiles the JSON schema of the json_schema rule.
+// The value is either the inline schema object or the path to the schema file,
+// the relative path is resolved against the baseDir, e.g. the directory of the mapping file.
+func compileSchema(val any, baseDir string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+
+	var location string
+	switch v := val.(type) {
+	case string:
+		location = v
+		if !filepath.IsAbs(location) {
+			if baseDir == "" {
+				return nil, fmt.Errorf("the relative schema file path '%s' is only supported in the mapping files, use the absolute path", v)
+			}
+			location = filepath.Join(baseDir, location)
+		}
+	case map[string]any, bool:
+		content, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("encode inline schema: %w", err)
+		}
+		doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("decode inline schema: %w", err)
+		}
+
+		location = "inline.json"
+		if err = compiler.AddResource(location, doc); err != nil {
+			return nil, fmt.Errorf("add inline schema: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("expected the inline schema object or the path to the schema file, got %T", val)
+	}
+
+	schema, err := compiler.Compile(location)
+	if err != nil {
+		return nil, fmt.Errorf("compile schema: %w", err)
+	}
+
+	return schema, nil
+}
+
+// matchesSchema validates the value against the schema, compiled with the matcher, see newValueMatcher.
+func (m *ValueMatcher) matchesSchema(val any) bool {
+	if _, isMissing := val.(missingValue); isMissing || m.schema == nil {
+		return false
+	}
+
+	return m.schema.Validate(val) == nil
+}
@@ -1,6 +1,24 @@
 package mapper
 
-import "testing"
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
 
 func TestValueMatcher_Matches__RuleEqual(t *testing.T) {
 	tests := []struct {
@@ -137,3 +155,550 @@ func TestValueMatcher_Matches__RuleContains(t *testing.T) {
 		})
 	}
 }
+
+func TestValueMatcher_Matches__RuleCompare(t *testing.T) {
+	tests := []struct {
+		name  string
+		rule  MatchingRule
+		value any
+		input any
+		want  bool
+	}{
+		{"gt number", MatchingRuleGreater, 10, 11.0, true},
+		{"gt equal number", MatchingRuleGreater, 10, 10.0, false},
+		{"gte equal number", MatchingRuleGreaterOrEqual, 10, 10.0, true},
+		{"lt number", MatchingRuleLess, 10, 9.5, true},
+		{"lte number", MatchingRuleLessOrEqual, 10, 11, false},
+		{"gt int64 as string", MatchingRuleGreater, 100, "101", true},
+		{"gt int64 precision", MatchingRuleGreater, int64(9007199254740992), "9007199254740993", true},
+		{"gt uint64 against negative", MatchingRuleGreater, int64(-1), uint64(18446744073709551615), true},
+		{"gt timestamp", MatchingRuleGreater, "2025-01-01T00:00:00Z", "2025-01-02T00:00:00Z", true},
+		{"lt timestamp", MatchingRuleLess, "2025-01-01T00:00:00Z", "2025-01-02T00:00:00Z", false},
+		{"timestamp against number", MatchingRuleGreater, "2025-01-01T00:00:00Z", 10, false},
+		{"not a number", MatchingRuleGreater, 10, "abc", false},
+		{"nil", MatchingRuleLess, 10, nil, false},
+
+		{"between number", MatchingRuleBetween, []any{1, 10}, 5.0, true},
+		{"between lower bound", MatchingRuleBetween, []any{1, 10}, 1, true},
+		{"between upper bound", MatchingRuleBetween, []any{1, 10}, 10, true},
+		{"out of range", MatchingRuleBetween, []any{1, 10}, 11, false},
+		{"between timestamps", MatchingRuleBetween, []any{"2025-01-01T00:00:00Z", "2025-12-31T23:59:59Z"}, "2025-06-01T12:00:00Z", true},
+
+		{"in numbers", MatchingRuleIn, []any{1, 2, 3}, 2.0, true},
+		{"not in numbers", MatchingRuleIn, []any{1, 2, 3}, 4.0, false},
+		{"in strings", MatchingRuleIn, []any{"a", "b"}, "b", true},
+		{"not a list", MatchingRuleIn, "a", "a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher := &ValueMatcher{Rule: tt.rule, Value: tt.value}
+
+			if matched := matcher.Matches(tt.input); matched != tt.want {
+				t.Errorf("%v %s %v,  ValueMatcher.Matches() = %v, want %v", tt.input, tt.rule, tt.value, matched, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewValueMatcher__RuleCompare(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    MatchingRule
+		value   any
+		wantErr bool
+	}{
+		{"gt number", MatchingRuleGreater, 10, false},
+		{"gt timestamp", MatchingRuleGreater, "2025-01-01T00:00:00Z", false},
+		{"gt bool", MatchingRuleGreater, true, true},
+		{"gt string", MatchingRuleGreater, "abc", true},
+		{"between", MatchingRuleBetween, []any{1, 2}, false},
+		{"between single value", MatchingRuleBetween, []any{1}, true},
+		{"between reversed", MatchingRuleBetween, []any{2, 1}, true},
+		{"between mixed", MatchingRuleBetween, []any{1, "2025-01-01T00:00:00Z"}, true},
+		{"in", MatchingRuleIn, []any{1, "a", true, nil}, false},
+		{"in not a list", MatchingRuleIn, 1, true},
+		{"in nested list", MatchingRuleIn, []any{[]any{1}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewValueMatcher(tt.rule, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewValueMatcher(%s, %v) error = %v, wantErr %v", tt.rule, tt.value, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMapping_Matches__Presence(t *testing.T) {
+	body := map[string]any{
+		"id":    "1",
+		"name":  "",
+		"tags":  []any{},
+		"owner": map[string]any{"name": "john"},
+	}
+
+	tests := []struct {
+		name    string
+		matcher string
+		want    bool
+	}{
+		{"exists", `{"id": {"rule": "exists"}}`, true},
+		{"exists nested", `{"owner.name": {"rule": "exists"}}`, true},
+		{"exists missing", `{"page_token": {"rule": "exists"}}`, false},
+		{"absent", `{"page_token": {"rule": "absent"}}`, true},
+		{"absent present", `{"id": {"rule": "absent"}}`, false},
+		{"empty missing", `{"page_token": {"rule": "empty"}}`, true},
+		{"empty string", `{"name": {"rule": "empty"}}`, true},
+		{"empty list", `{"tags": {"rule": "empty"}}`, true},
+		{"empty non-empty", `{"owner": {"rule": "empty"}}`, false},
+		{"not glob", `{"owner.name": {"rule": "not", "value": {"rule": "glob", "value": "jo*"}}}`, false},
+		{"not glob mismatch", `{"owner.name": {"rule": "not", "value": {"rule": "glob", "value": "bob*"}}}`, true},
+		{"not equal missing", `{"page_token": {"rule": "not", "value": {"rule": "equal", "value": "abc"}}}`, true},
+		{"not exists", `{"page_token": {"rule": "not", "value": {"rule": "exists"}}}`, true},
+		{"equal missing", `{"page_token": {"rule": "equal", "value": null}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var matchers map[string]ValueMatcher
+			if err := json.Unmarshal([]byte(tt.matcher), &matchers); err != nil {
+				t.Fatalf("unmarshal matchers: %v", err)
+			}
+
+			m := &Mapping{Endpoint: "/pkg.Service/Method", RequestBody: matchers}
+			if err := m.IsValid(); err != nil {
+				t.Fatalf("mapping is not valid: %v", err)
+			}
+
+			if matched := m.Matches(&Request{Body: body}); matched != tt.want {
+				t.Errorf("%s, Mapping.Matches() = %v, want %v", tt.matcher, matched, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping_Matches__Composition(t *testing.T) {
+	mapping := `{
+		"endpoint": "/pkg.Service/Method",
+		"request_body": {
+			"id": {"rule": "any_of", "value": [
+				{"rule": "in", "value": [1, 2]},
+				{"rule": "glob", "value": "test-*"}
+			]}
+		},
+		"none_of": [
+			{"metadata": {"user-agent": {"rule": "glob", "value": "curl*"}}}
+		],
+		"any_of": [
+			{"request_body": {"page_size": {"rule": "gt", "value": 10}}},
+			{"request_body": {"page_size": {"rule": "absent"}}}
+		]
+	}`
+
+	tests := []struct {
+		name string
+		md   metadata.MD
+		body map[string]any
+		want bool
+	}{
+		{"id in list", nil, map[string]any{"id": 1.0}, true},
+		{"id glob", nil, map[string]any{"id": "test-1"}, true},
+		{"id not matched", nil, map[string]any{"id": 3.0}, false},
+		{"page size matched", nil, map[string]any{"id": 2.0, "page_size": 20.0}, true},
+		{"page size not matched", nil, map[string]any{"id": 2.0, "page_size": 5.0}, false},
+		{"excluded user agent", metadata.Pairs("user-agent", "curl/8.0"), map[string]any{"id": 1.0}, false},
+		{"other user agent", metadata.Pairs("user-agent", "grpc-go"), map[string]any{"id": 1.0}, true},
+	}
+
+	m := new(Mapping)
+	if err := json.Unmarshal([]byte(mapping), m); err != nil {
+		t.Fatalf("unmarshal mapping: %v", err)
+	}
+	if err := m.IsValid(); err != nil {
+		t.Fatalf("mapping is not valid: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if matched := m.Matches(&Request{Metadata: tt.md, Body: tt.body}); matched != tt.want {
+				t.Errorf("Mapping.Matches(%v, %v) = %v, want %v", tt.md, tt.body, matched, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping_Matches__Elements(t *testing.T) {
+	body := map[string]any{
+		"tags": []any{"prod-eu", "beta"},
+		"labels": []any{
+			map[string]any{"name": "env", "value": "prod-eu"},
+			map[string]any{"name": "team", "value": "billing"},
+		},
+		"metadata": map[string]any{"a": "1", "b": "2"},
+	}
+
+	tests := []struct {
+		name    string
+		matcher string
+		want    bool
+	}{
+		{"any label", `{"labels": {"rule": "any_element", "value": {"name": {"rule": "equal", "value": "env"}, "value": {"rule": "glob", "value": "prod*"}}}}`, true},
+		{"any label mismatch", `{"labels": {"rule": "any_element", "value": {"name": {"rule": "equal", "value": "env"}, "value": {"rule": "glob", "value": "dev*"}}}}`, false},
+		{"every label", `{"labels": {"rule": "every_element", "value": {"value": {"rule": "exists"}}}}`, true},
+		{"every label mismatch", `{"labels": {"rule": "every_element", "value": {"name": {"rule": "equal", "value": "env"}}}}`, false},
+		{"no label", `{"labels": {"rule": "no_element", "value": {"name": {"rule": "equal", "value": "owner"}}}}`, true},
+		{"any scalar", `{"tags": {"rule": "any_element", "value": {"@this": {"rule": "glob", "value": "prod*"}}}}`, true},
+		{"any missing list", `{"items": {"rule": "any_element", "value": {"@this": {"rule": "exists"}}}}`, false},
+		{"every missing list", `{"items": {"rule": "every_element", "value": {"@this": {"rule": "exists"}}}}`, true},
+		{"list length", `{"tags": {"rule": "length", "value": {"rule": "equal", "value": 2}}}`, true},
+		{"map length", `{"metadata": {"rule": "length", "value": {"rule": "gte", "value": 3}}}`, false},
+		{"missing list length", `{"items": {"rule": "length", "value": {"rule": "equal", "value": 0}}}`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var matchers map[string]ValueMatcher
+			if err := json.Unmarshal([]byte(tt.matcher), &matchers); err != nil {
+				t.Fatalf("unmarshal matchers: %v", err)
+			}
+
+			m := &Mapping{Endpoint: "/pkg.Service/Method", RequestBody: matchers}
+			if err := m.IsValid(); err != nil {
+				t.Fatalf("mapping is not valid: %v", err)
+			}
+
+			if matched := m.Matches(&Request{Body: body}); matched != tt.want {
+				t.Errorf("%s, Mapping.Matches() = %v, want %v", tt.matcher, matched, tt.want)
+			}
+		})
+	}
+}
+
+func TestValueMatcher_Matches__RuleJSONSchema(t *testing.T) {
+	schemaFile := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(schemaFile, []byte(`{"type": "array", "minItems": 2, "items": {"type": "string"}}`), 0o600); err != nil {
+		t.Fatalf("write schema file: %v", err)
+	}
+
+	inline := map[string]any{
+		"type":     "object",
+		"required": []any{"name"},
+		"properties": map[string]any{
+			"name": map[string]any{"type": "string", "pattern": "^[a-z]+$"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		schema any
+		value  any
+		want   bool
+	}{
+		{"inline valid", inline, map[string]any{"name": "john"}, true},
+		{"inline invalid pattern", inline, map[string]any{"name": "John"}, false},
+		{"inline missing required", inline, map[string]any{"age": 10.0}, false},
+		{"file valid", schemaFile, []any{"a", "b"}, true},
+		{"file invalid", schemaFile, []any{"a"}, false},
+		{"missing value", inline, missing, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matcher, err := NewValueMatcher(MatchingRuleJSONSchema, tt.schema)
+			if err != nil {
+				t.Fatalf("NewValueMatcher() error = %v", err)
+			}
+
+			if matched := matcher.Matches(tt.value); matched != tt.want {
+				t.Errorf("ValueMatcher.Matches(%v) = %v, want %v", tt.value, matched, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewValueMatcher(MatchingRuleJSONSchema, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Errorf("NewValueMatcher() with missing schema file, expected error")
+	}
+}
+
+func TestMapping_IsValid__RelativeSchemaPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tags.schema.json"), []byte(`{"type": "array", "minItems": 2}`), 0o600); err != nil {
+		t.Fatalf("write schema file: %v", err)
+	}
+
+	newMapping := func(source string) *Mapping {
+		return &Mapping{
+			Endpoint: "/pkg.Service/Method",
+			Source:   source,
+			RequestBody: map[string]ValueMatcher{
+				"tags": {Rule: MatchingRuleNot, Value: &ValueMatcher{Rule: MatchingRuleJSONSchema, Value: "tags.schema.json"}},
+			},
+		}
+	}
+
+	m := newMapping(filepath.Join(dir, "mapping.json"))
+	if err := m.IsValid(); err != nil {
+		t.Fatalf("IsValid() error = %v", err)
+	}
+	if !m.Matches(&Request{Body: map[string]any{"tags": []any{"a"}}}) {
+		t.Errorf("Matches() = false for the value, which is not valid against the schema")
+	}
+	if m.Matches(&Request{Body: map[string]any{"tags": []any{"a", "b"}}}) {
+		t.Errorf("Matches() = true for the value, which is valid against the schema")
+	}
+
+	if err := newMapping("").IsValid(); err == nil {
+		t.Errorf("IsValid() of the runtime mapping with the relative schema path, expected error")
+	}
+	if err := newMapping(filepath.Join(t.TempDir(), "mapping.json")).IsValid(); err == nil {
+		t.Errorf("IsValid() with the schema file missing next to the mapping, expected error")
+	}
+}
+
+func TestMapping_Matches__Expression(t *testing.T) {
+	req := &Request{
+		Metadata: metadata.Pairs("x-tenant", "acme"),
+		Body:     map[string]any{"negative_int_value": "-100", "double_value": 5.0},
+		Message:  &descriptorpb.UninterpretedOption{NegativeIntValue: proto.Int64(-100), DoubleValue: proto.Float64(5)},
+	}
+
+	tests := []struct {
+		name  string
+		when  string
+		typed bool
+		want  bool
+	}{
+		{"typed int64 field", "request.negative_int_value < -99 && metadata['x-tenant'] == 'acme'", true, true},
+		{"typed mismatch", "request.double_value == 6.0", true, false},
+		{"untyped json field", "request.double_value == 5.0", false, true},
+		{"untyped int64 as string", "request.negative_int_value == '-100'", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Mapping{Endpoint: "/pkg.Service/Method", When: tt.when}
+			if err := m.IsValid(); err != nil {
+				t.Fatalf("mapping is not valid: %v", err)
+			}
+			if tt.typed {
+				if err := m.CompileExpressions(req.Message.ProtoReflect().Descriptor()); err != nil {
+					t.Fatalf("compile expressions: %v", err)
+				}
+			}
+
+			if matched := m.Matches(req); matched != tt.want {
+				t.Errorf("when %q, Mapping.Matches() = %v, want %v", tt.when, matched, tt.want)
+			}
+		})
+	}
+
+	m := &Mapping{Endpoint: "/pkg.Service/Method", When: "request.unknown == 1"}
+	if err := m.CompileExpressions(req.Message.ProtoReflect().Descriptor()); err == nil {
+		t.Errorf("CompileExpressions() with unknown field, expected error")
+	}
+
+	m = &Mapping{Endpoint: "/pkg.Service/Method", When: "request.negative_int_value + 1"}
+	if err := m.CompileExpressions(req.Message.ProtoReflect().Descriptor()); err == nil {
+		t.Errorf("CompileExpressions() with non-bool expression, expected error")
+	}
+
+	m = &Mapping{Endpoint: "/pkg.Service/Method", RequestBody: map[string]ValueMatcher{
+		"identifier_value": {Rule: MatchingRuleCEL, Value: "request.unknown == value"},
+	}}
+	if err := m.IsValid(); err != nil {
+		t.Fatalf("mapping is not valid: %v", err)
+	}
+	if err := m.CompileExpressions(req.Message.ProtoReflect().Descriptor()); err == nil {
+		t.Errorf("CompileExpressions() with the unknown field in the cel rule, expected error")
+	}
+
+	matcher, err := NewValueMatcher(MatchingRuleCEL, "value.startsWith('abc') && size(value) > 3")
+	if err != nil {
+		t.Fatalf("NewValueMatcher() error = %v", err)
+	}
+	if !matcher.Matches("abcd") || matcher.Matches("abc") || matcher.Matches(missing) {
+		t.Errorf("cel rule ValueMatcher.Matches() returned unexpected result")
+	}
+}
+
+func TestMapping_Matches__ExpressionRule(t *testing.T) {
+	req := &Request{
+		Metadata: metadata.Pairs("x-tenant", "acme"),
+		Body:     map[string]any{"negative_int_value": "-100", "double_value": 5.0},
+		Message:  &descriptorpb.UninterpretedOption{NegativeIntValue: proto.Int64(-100), DoubleValue: proto.Float64(5)},
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		typed bool
+		want  bool
+	}{
+		{"typed request and metadata", "value == 5.0 && request.negative_int_value == -100 && metadata['x-tenant'] == 'acme'", true, true},
+		{"typed mismatch", "value > request.double_value", true, false},
+		{"untyped request", "value == request.double_value", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Mapping{Endpoint: "/pkg.Service/Method", AnyOf: []Condition{{
+				RequestBody: map[string]ValueMatcher{
+					"double_value": {Rule: MatchingRuleNot, Value: &ValueMatcher{Rule: MatchingRuleCEL, Value: "!(" + tt.rule + ")"}},
+				},
+			}}}
+			if err := m.IsValid(); err != nil {
+				t.Fatalf("mapping is not valid: %v", err)
+			}
+			if tt.typed {
+				if err := m.CompileExpressions(req.Message.ProtoReflect().Descriptor()); err != nil {
+					t.Fatalf("compile expressions: %v", err)
+				}
+			}
+
+			if matched := m.Matches(req); matched != tt.want {
+				t.Errorf("cel rule %q, Mapping.Matches() = %v, want %v", tt.rule, matched, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping_Evaluate(t *testing.T) {
+	req := &Request{Message: &descriptorpb.UninterpretedOption{
+		NegativeIntValue: proto.Int64(-9007199254740993),
+		PositiveIntValue: proto.Uint64(18446744073709551615),
+		DoubleValue:      proto.Float64(1.5),
+	}}
+
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{"request.negative_int_value", int64(-9007199254740993)},
+		{"request.positive_int_value", uint64(18446744073709551615)},
+		{"request.double_value * 2.0", 3.0},
+		{"[request.negative_int_value, 1]", []any{int64(-9007199254740993), int64(1)}},
+		{"{'id': request.positive_int_value, 'name': 'x'}", map[string]any{"id": uint64(18446744073709551615), "name": "x"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			m := &Mapping{Endpoint: "/pkg.Service/Method", Response: Response{Body: map[string]any{"value": ExpressionPrefix + tt.expr}}}
+			if err := m.CompileExpressions(req.Message.ProtoReflect().Descriptor()); err != nil {
+				t.Fatalf("compile expressions: %v", err)
+			}
+
+			got, err := m.Evaluate(tt.expr, req)
+			if err != nil {
+				t.Fatalf("Evaluate() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping_Matches__Peer(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://acme/svc-a")
+	cert := &x509.Certificate{
+		Subject:      pkix.Name{CommonName: "svc-a", Organization: []string{"acme"}},
+		Issuer:       pkix.Name{CommonName: "acme CA"},
+		SerialNumber: big.NewInt(42),
+		DNSNames:     []string{"svc-a.internal"},
+		URIs:         []*url.URL{spiffe},
+	}
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.7"), Port: 50123}
+	mtls := &Request{Peer: &peer.Peer{
+		Addr:     addr,
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}},
+	}}
+	plain := &Request{Peer: &peer.Peer{Addr: addr}}
+
+	tests := []struct {
+		name    string
+		mapping *Mapping
+		req     *Request
+		want    bool
+	}{
+		{
+			name:    "peer ip",
+			mapping: &Mapping{Peer: map[string]ValueMatcher{"ip": {Rule: MatchingRuleGlob, Value: "10.0.*"}}},
+			req:     plain,
+			want:    true,
+		},
+		{
+			name:    "tls common name",
+			mapping: &Mapping{TLS: map[string]ValueMatcher{"common_name": {Rule: MatchingRuleEqual, Value: "svc-a"}}},
+			req:     mtls,
+			want:    true,
+		},
+		{
+			name:    "tls sans",
+			mapping: &Mapping{TLS: map[string]ValueMatcher{"sans": {Rule: MatchingRuleContains, Value: "spiffe://acme/svc-a"}}},
+			req:     mtls,
+			want:    true,
+		},
+		{
+			name:    "tls subject without client certificate",
+			mapping: &Mapping{TLS: map[string]ValueMatcher{"subject": {Rule: MatchingRuleExists}}},
+			req:     plain,
+			want:    false,
+		},
+		{
+			name: "tls in composition",
+			mapping: &Mapping{AnyOf: []Condition{
+				{TLS: map[string]ValueMatcher{"dns_names": {Rule: MatchingRuleContains, Value: "svc-b.internal"}}},
+				{TLS: map[string]ValueMatcher{"subject": {Rule: MatchingRuleEqual, Value: "CN=svc-a,O=acme"}}},
+			}},
+			req:  mtls,
+			want: true,
+		},
+		{
+			name:    "tls expression",
+			mapping: &Mapping{When: "tls.common_name == 'svc-a' && peer.ip == '10.0.0.7' && 'svc-a.internal' in tls.sans"},
+			req:     mtls,
+			want:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.mapping.Endpoint = "/pkg.Service/Method"
+			if err := tt.mapping.IsValid(); err != nil {
+				t.Fatalf("mapping is not valid: %v", err)
+			}
+
+			if matched := tt.mapping.Matches(tt.req); matched != tt.want {
+				t.Errorf("Mapping.Matches() = %v, want %v", matched, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping_Matches__EncodesRequestOnce(t *testing.T) {
+	req := &Request{Metadata: metadata.Pairs("x-tenant", "acme"), Body: map[string]any{"id": "1"}}
+
+	first := &Mapping{Endpoint: "/pkg.Service/Method", RequestBody: map[string]ValueMatcher{"id": {Rule: MatchingRuleEqual, Value: "2"}}}
+	second := &Mapping{Endpoint: "/pkg.Service/Method", Metadata: map[string]ValueMatcher{"x-tenant": {Rule: MatchingRuleEqual, Value: "acme"}}}
+	for _, m := range []*Mapping{first, second} {
+		if err := m.IsValid(); err != nil {
+			t.Fatalf("mapping is not valid: %v", err)
+		}
+	}
+
+	if first.Matches(req) {
+		t.Errorf("first Mapping.Matches() = true, want false")
+	}
+	encoded := req.encoded
+	if encoded == nil {
+		t.Fatalf("request is not encoded after the match")
+	}
+	if !second.Matches(req) {
+		t.Errorf("second Mapping.Matches() = false, want true")
+	}
+	if req.encoded != encoded {
+		t.Errorf("request is encoded again for the second mapping")
+	}
+}
@@ -0,0 +1,126 @@
+package mapper
+
+import (
+	"crypto/x509"
+	"net"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	requestPeerGetterPrefix = "$req.peer."
+	requestTLSGetterPrefix  = "$req.tls."
+)
+
+// peerFields are the keys of the PeerInfo with the kinds of their values.
+var peerFields = map[string]jsonKind{
+	"address": jsonString,
+	"ip":      jsonString,
+}
+
+// tlsFields are the keys of the TLSInfo with the kinds of their values.
+var tlsFields = map[string]jsonKind{
+	"subject":         jsonString,
+	"common_name":     jsonString,
+	"issuer":          jsonString,
+	"serial_number":   jsonString,
+	"dns_names":       jsonList,
+	"uris":            jsonList,
+	"email_addresses": jsonList,
+	"ip_addresses":    jsonList,
+	"sans":            jsonList,
+}
+
+// PeerInfo returns the information about the client, sent the request: the "address" (host:port)
+// and the "ip" of the connection. The info is matched by the `peer` matchers, returned by the `$req.peer.` value getters
+// and available in the CEL expressions as `peer`.
+func (r *Request) PeerInfo() map[string]any {
+	info := map[string]any{"address": "", "ip": ""}
+	if r.Peer == nil || r.Peer.Addr == nil {
+		return info
+	}
+
+	info["address"] = r.Peer.Addr.String()
+	if tcp, ok := r.Peer.Addr.(*net.TCPAddr); ok {
+		info["ip"] = tcp.IP.String()
+	} else if host, _, err := net.SplitHostPort(r.Peer.Addr.String()); err == nil {
+		info["ip"] = host
+	}
+
+	return info
+}
+
+// TLSInfo returns the information about the verified client certificate: the "subject", the "common_name",
+// the "issuer" and the "serial_number", the subject alternative names as the "dns_names", "uris",
+// "email_addresses", "ip_addresses" and all of them as the "sans". The info is empty, if the client
+// is not connected over TLS or has not provided the certificate. The info is matched by the `tls` matchers,
+// returned by the `$req.tls.` value getters and available in the CEL expressions as `tls`.
+func (r *Request) TLSInfo() map[string]any {
+	cert := r.clientCertificate()
+	if cert == nil {
+		return map[string]any{}
+	}
+
+	uris := make([]string, 0, len(cert.URIs))
+	for _, u := range cert.URIs {
+		uris = append(uris, u.String())
+	}
+	ips := make([]string, 0, len(cert.IPAddresses))
+	for _, ip := range cert.IPAddresses {
+		ips = append(ips, ip.String())
+	}
+	dnsNames := nonNil(slices.Clone(cert.DNSNames))
+	emails := nonNil(slices.Clone(cert.EmailAddresses))
+
+	return map[string]any{
+		"subject":         cert.Subject.String(),
+		"common_name":     cert.Subject.CommonName,
+		"issuer":          cert.Issuer.String(),
+		"serial_number":   cert.SerialNumber.String(),
+		"dns_names":       dnsNames,
+		"uris":            uris,
+		"email_addresses": emails,
+		"ip_addresses":    ips,
+		"sans":            slices.Concat(dnsNames, uris, emails, ips),
+	}
+}
+
+// clientCertificate returns the leaf certificate of the client, nil if it is not provided.
+func (r *Request) clientCertificate() *x509.Certificate {
+	if r.Peer == nil {
+		return nil
+	}
+
+	info, ok := r.Peer.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return info.State.PeerCertificates[0]
+}
+
+// nonNil returns the empty slice instead of nil, so the value is encoded as the empty list.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+
+	return values
+}
+
+// infoFieldKind returns the kind of the info field, the key (json path) points to,
+// the key is not known, if ok is false.
+func infoFieldKind(fields map[string]jsonKind, key string) (kind jsonKind, ok bool) {
+	name, rest, nested := strings.Cut(key, ".")
+	kind, ok = fields[name]
+	if !ok || !nested {
+		return kind, ok
+	}
+	if kind == jsonList && isIndex(rest) {
+		return jsonString, true
+	}
+
+	return jsonAny, true
+}
@@ -0,0 +1,442 @@
+package mapper
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/tidwall/sjson"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	requestBodyGetterPrefix     = "$req.body."
+	requestMetadataGetterPrefix = "$req.metadata."
+)
+
+// ValidationError is the problem of the mapping, found by Mapping.Validate.
+type ValidationError struct {
+	MappingID string
+	Endpoint  string
+	// Source is the file, the mapping is loaded from.
+	Source string
+	// Position is the location of the problem in the Source file.
+	Position Position
+	// Path is the location of the problem inside the mapping, e.g. "request_body.id".
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	var sb strings.Builder
+	if e.Source != "" {
+		sb.WriteString(e.Source)
+		if e.Position.IsValid() {
+			sb.WriteString(":" + e.Position.String())
+		}
+		sb.WriteString(": ")
+	}
+
+	fmt.Fprintf(&sb, "mapping (id=%s endpoint=%s)", e.MappingID, e.Endpoint)
+	if e.Path != "" {
+		sb.WriteString(" " + e.Path)
+	}
+	sb.WriteString(": " + e.Message)
+
+	return sb.String()
+}
+
+// TypeResolver resolves the message types of the google.protobuf.Any values, e.g. dynamicpb.Types.
+type TypeResolver interface {
+	protoregistry.MessageTypeResolver
+	protoregistry.ExtensionTypeResolver
+}
+
+// validator collects the problems of the single mapping.
+type validator struct {
+	mapping  *Mapping
+	input    protoreflect.MessageDescriptor
+	output   protoreflect.MessageDescriptor
+	resolver TypeResolver
+	errs     []error
+}
+
+func (v *validator) addf(path, format string, args ...any) {
+	v.errs = append(v.errs, &ValidationError{
+		MappingID: v.mapping.ID,
+		Endpoint:  v.mapping.Endpoint,
+		Source:    v.mapping.Source,
+		Position:  v.mapping.PositionOf(path),
+		Path:      path,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Validate checks the mapping against the input and output messages of the endpoint and returns all the found problems:
+// the unknown field paths, the values of the wrong type, the unknown enum values, the oneof conflicts
+// and the value getters, referencing the unknown request fields.
+// The request body matchers of the valid mapping are bound to the input message fields,
+// so the values are compared by the real field type, see fieldBinding.normalize.
+// The resolver is used to check the google.protobuf.Any values, protoregistry.GlobalTypes is used if it is nil.
+func (m *Mapping) Validate(input, output protoreflect.MessageDescriptor, resolver TypeResolver) []error {
+	if resolver == nil {
+		resolver = protoregistry.GlobalTypes
+	}
+	v := &validator{mapping: m, input: input, output: output, resolver: resolver}
+	if err := m.IsValid(); err != nil {
+		v.addf("", "%v", err)
+		return v.errs
+	}
+
+	v.validateCondition("", m.condition())
+	if err := m.CompileExpressions(input); err != nil {
+		v.addf("", "%v", err)
+	}
+	v.validateResponse()
+
+	return v.errs
+}
+
+// ValidateRaw checks the mapping of the method, which has no descriptor (e.g. the call of the unknown service),
+// and returns all the found problems. The request body of such a method can't be decoded,
+// so only the metadata, peer and tls matchers and the fixed response (the code, the error message and the raw payload) are supported.
+func (m *Mapping) ValidateRaw() []error {
+	v := &validator{mapping: m}
+	if err := m.IsValid(); err != nil {
+		v.addf("", "%v", err)
+		return v.errs
+	}
+
+	v.validateRawCondition("", m.condition())
+	if m.When != "" {
+		v.addf("when", "the expressions are not supported for the method without descriptor")
+	}
+	if len(m.Response.Body) > 0 {
+		v.addf("response.body", "the response body is not supported for the method without descriptor, use the response payload")
+	}
+	if m.Response.Generate {
+		v.addf("response.generate", "the response generation is not supported for the method without descriptor, use the response payload")
+	}
+
+	return v.errs
+}
+
+func (v *validator) validateRawCondition(prefix string, c *Condition) {
+	if len(c.RequestBody) > 0 {
+		v.addf(prefix+"request_body", "the request body matching is not supported for the method without descriptor")
+	}
+	v.validateConnectionKeys(prefix, c)
+
+	groups := []struct {
+		name       string
+		conditions []Condition
+	}{
+		{"all_of", c.AllOf},
+		{"any_of", c.AnyOf},
+		{"none_of", c.NoneOf},
+	}
+	for _, g := range groups {
+		for i := range g.conditions {
+			v.validateRawCondition(fmt.Sprintf("%s%s[%d].", prefix, g.name, i), &g.conditions[i])
+		}
+	}
+}
+
+func (v *validator) validateCondition(prefix string, c *Condition) {
+	var present []string
+	for _, key := range slices.Sorted(maps.Keys(c.RequestBody)) {
+		matcher := c.RequestBody[key]
+		path := prefix + "request_body." + key
+
+		b := resolveField(v.input, key)
+		if b == nil {
+			if isPlainPath(key) {
+				v.addf(path, "the field is not found in INPUT message %s", v.input.FullName())
+			}
+			continue
+		}
+		if err := matcher.bind(b); err != nil {
+			v.addf(path, "%v", err)
+			continue
+		}
+
+		c.RequestBody[key] = matcher
+		if requiresPresence(&matcher) {
+			present = append(present, key)
+		}
+	}
+	v.checkOneofConflicts(prefix+"request_body", v.input, present)
+	v.validateConnectionKeys(prefix, c)
+
+	groups := []struct {
+		name       string
+		conditions []Condition
+	}{
+		{"all_of", c.AllOf},
+		{"any_of", c.AnyOf},
+		{"none_of", c.NoneOf},
+	}
+	for _, g := range groups {
+		for i := range g.conditions {
+			v.validateCondition(fmt.Sprintf("%s%s[%d].", prefix, g.name, i), &g.conditions[i])
+		}
+	}
+}
+
+// validateConnectionKeys reports the keys of the peer and tls matchers, which are not the known fields
+// of Request.PeerInfo and Request.TLSInfo.
+func (v *validator) validateConnectionKeys(prefix string, c *Condition) {
+	for _, key := range slices.Sorted(maps.Keys(c.Peer)) {
+		if _, ok := infoFieldKind(peerFields, key); !ok && isPlainPath(key) {
+			v.addf(prefix+"peer."+key, "unknown peer field, expected one of %v", slices.Sorted(maps.Keys(peerFields)))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(c.TLS)) {
+		if _, ok := infoFieldKind(tlsFields, key); !ok && isPlainPath(key) {
+			v.addf(prefix+"tls."+key, "unknown tls field, expected one of %v", slices.Sorted(maps.Keys(tlsFields)))
+		}
+	}
+}
+
+func (v *validator) validateResponse() {
+	if len(v.mapping.Response.Payload) > 0 {
+		v.addf("response.payload", "the raw payload is supported for the method without descriptor only, use the response body")
+	}
+
+	keys := make([]string, 0, len(v.mapping.Response.Body))
+	for _, key := range slices.Sorted(maps.Keys(v.mapping.Response.Body)) {
+		value := v.mapping.Response.Body[key]
+		path := "response.body." + key
+
+		b := resolveField(v.output, key)
+		if b == nil {
+			v.addf(path, "the field is not found in OUTPUT message %s", v.output.FullName())
+			continue
+		}
+		keys = append(keys, key)
+
+		str, _ := value.(string)
+		switch {
+		case strings.HasPrefix(str, requestBodyGetterPrefix):
+			source := strings.TrimPrefix(str, requestBodyGetterPrefix)
+			sb := resolveField(v.input, source)
+			if sb == nil {
+				if isPlainPath(source) {
+					v.addf(path, "the value getter %q references the field, which is not found in INPUT message %s", str, v.input.FullName())
+				}
+				continue
+			}
+			if !jsonKindOf(b).accepts(jsonKindOf(sb)) {
+				v.addf(path, "the value getter %q references the field of type %s, which can't be assigned to the field of type %s", str, describeField(sb), describeField(b))
+			}
+		case strings.HasPrefix(str, requestMetadataGetterPrefix):
+			if !jsonKindOf(b).accepts(jsonString) {
+				v.addf(path, "the value getter %q returns string, which can't be assigned to the field of type %s", str, describeField(b))
+			}
+		case strings.HasPrefix(str, requestPeerGetterPrefix):
+			v.checkInfoGetter(path, b, str, requestPeerGetterPrefix, peerFields)
+		case strings.HasPrefix(str, requestTLSGetterPrefix):
+			v.checkInfoGetter(path, b, str, requestTLSGetterPrefix, tlsFields)
+		case strings.HasPrefix(str, ExpressionPrefix):
+			// compiled and type-checked with the other mapping expressions
+		default:
+			if err := v.checkOutputValue(key, value); err != nil {
+				v.addf(path, "%v", err)
+			}
+		}
+	}
+
+	v.checkOneofConflicts("response.body", v.output, keys)
+}
+
+// checkInfoGetter verifies the value getter of the peer or tls info references the known field,
+// which could be assigned to the output field.
+func (v *validator) checkInfoGetter(path string, b *fieldBinding, getter, prefix string, fields map[string]jsonKind) {
+	key := strings.TrimPrefix(getter, prefix)
+	kind, ok := infoFieldKind(fields, key)
+	switch {
+	case !ok:
+		if isPlainPath(key) {
+			v.addf(path, "the value getter %q references the unknown field, expected one of %v", getter, slices.Sorted(maps.Keys(fields)))
+		}
+	case !jsonKindOf(b).accepts(kind):
+		v.addf(path, "the value getter %q returns %s, which can't be assigned to the field of type %s", getter, kindName(kind), describeField(b))
+	}
+}
+
+// checkOneofConflicts reports the paths, which refer to the different fields of the same oneof.
+func (v *validator) checkOneofConflicts(path string, md protoreflect.MessageDescriptor, keys []string) {
+	seen := make(map[string]string)
+	for _, key := range keys {
+		b := resolveField(md, key)
+		if b == nil {
+			continue
+		}
+		oneof := b.field.ContainingOneof()
+		if oneof == nil || oneof.IsSynthetic() {
+			continue
+		}
+
+		parent := ""
+		if i := strings.LastIndex(key, "."); i >= 0 {
+			parent = key[:i]
+		}
+		id := parent + "/" + string(oneof.FullName())
+		if other, ok := seen[id]; ok && other != key {
+			v.addf(path, "the fields %q and %q belong to the same oneof %s, only one of them could be set", other, key, oneof.Name())
+			continue
+		}
+		seen[id] = key
+	}
+}
+
+// checkOutputValue verifies the value could be placed into the output message by the path.
+func (v *validator) checkOutputValue(path string, value any) error {
+	content, err := sjson.Set("{}", path, value)
+	if err != nil {
+		return fmt.Errorf("set the value: %w", err)
+	}
+
+	msg := dynamicpb.NewMessage(v.output)
+	if err = (protojson.UnmarshalOptions{Resolver: v.resolver}).Unmarshal([]byte(content), msg); err != nil {
+		return fmt.Errorf("the value %s is not valid for the field: %w", formatValue(value), err)
+	}
+
+	return nil
+}
+
+// formatValue formats the mapping value for the error messages.
+func formatValue(val any) string {
+	content, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+
+	return string(content)
+}
+
+// isPlainPath reports whether the json path is a plain field path without the gjson modifiers and wildcards.
+func isPlainPath(path string) bool {
+	return !strings.ContainsAny(path, `@|*?\`)
+}
+
+// requiresPresence reports whether the matcher could be satisfied by the present value only.
+func requiresPresence(m *ValueMatcher) bool {
+	switch m.Rule { //nolint:exhaustive
+	case MatchingRuleEqual, MatchingRuleEqualIgnoreCase:
+		return m.Value != nil
+	case MatchingRuleExists, MatchingRuleContains, MatchingRuleRegex, MatchingRuleGlob,
+		MatchingRuleGreater, MatchingRuleGreaterOrEqual, MatchingRuleLess, MatchingRuleLessOrEqual,
+		MatchingRuleBetween, MatchingRuleIn:
+		return true
+	default:
+		return false
+	}
+}
+
+// jsonKind is the kind of the JSON value, the field is represented by in protojson.
+type jsonKind int
+
+const (
+	jsonAny jsonKind = iota
+	jsonString
+	jsonNumber
+	// jsonInteger is the 64-bit integer, encoded as the string or the number.
+	jsonInteger
+	jsonBool
+	jsonEnum
+	jsonObject
+	jsonList
+)
+
+func jsonKindOf(b *fieldBinding) jsonKind {
+	if b.list {
+		return jsonList
+	}
+	if b.field.IsMap() {
+		return jsonObject
+	}
+
+	switch b.field.Kind() {
+	case protoreflect.StringKind, protoreflect.BytesKind:
+		return jsonString
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return jsonInteger
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind,
+		protoreflect.FloatKind, protoreflect.DoubleKind:
+		return jsonNumber
+	case protoreflect.BoolKind:
+		return jsonBool
+	case protoreflect.EnumKind:
+		return jsonEnum
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		switch b.field.Message().FullName() {
+		case "google.protobuf.Timestamp", "google.protobuf.Duration", "google.protobuf.FieldMask":
+			return jsonString
+		case "google.protobuf.Value", "google.protobuf.Struct", "google.protobuf.ListValue", "google.protobuf.Any":
+			return jsonAny
+		case "google.protobuf.DoubleValue", "google.protobuf.FloatValue",
+			"google.protobuf.Int64Value", "google.protobuf.UInt64Value",
+			"google.protobuf.Int32Value", "google.protobuf.UInt32Value",
+			"google.protobuf.BoolValue", "google.protobuf.StringValue", "google.protobuf.BytesValue":
+			return jsonKindOf(&fieldBinding{field: b.field.Message().Fields().ByName("value")})
+		}
+
+		return jsonObject
+	default:
+		return jsonAny
+	}
+}
+
+// accepts reports whether the value of the source kind could be assigned to the field of the target kind.
+func (k jsonKind) accepts(source jsonKind) bool {
+	if k == jsonAny || source == jsonAny || k == source {
+		return true
+	}
+
+	switch k { //nolint:exhaustive
+	case jsonInteger:
+		return source == jsonNumber
+	case jsonNumber:
+		return source == jsonInteger
+	case jsonString:
+		return source == jsonEnum || source == jsonInteger
+	case jsonEnum:
+		return source == jsonString || source == jsonInteger
+	default:
+		return false
+	}
+}
+
+// kindName returns the name of the value kind for the error messages.
+func kindName(k jsonKind) string {
+	if k == jsonList {
+		return "list of strings"
+	}
+
+	return "string"
+}
+
+func describeField(b *fieldBinding) string {
+	typ := b.field.Kind().String()
+	switch {
+	case b.field.IsMap():
+		typ = "map"
+	case b.field.Message() != nil:
+		typ = string(b.field.Message().FullName())
+	case b.field.Enum() != nil:
+		typ = string(b.field.Enum().FullName())
+	}
+	if b.list {
+		return "repeated " + typ
+	}
+
+	return typ
+}
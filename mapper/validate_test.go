@@ -0,0 +1,270 @@
+package mapper
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestMapping_Validate(t *testing.T) {
+	md := testMessageDescriptor(t)
+
+	tests := []struct {
+		name    string
+		mapping string
+		// wantErrs are the paths of the expected problems.
+		wantErrs []string
+	}{
+		{
+			name: "valid",
+			mapping: `{
+				"request_body": {"id": {"rule": "equal", "value": 1}, "items.0.status": {"rule": "in", "value": ["STATUS_ACTIVE"]}},
+				"response": {"body": {"id": "$req.body.count", "status": 2, "created_at": "2025-01-01T00:00:00Z", "items.0.id": "$req.body.id", "name": "$req.metadata.x-name"}}
+			}`,
+		},
+		{
+			name: "unknown paths",
+			mapping: `{
+				"request_body": {"unknown": {"rule": "exists"}, "@this": {"rule": "exists"}},
+				"any_of": [{"request_body": {"items.0.unknown": {"rule": "exists"}}}],
+				"response": {"body": {"items.0.unknown": 1}}
+			}`,
+			wantErrs: []string{"request_body.unknown", "any_of[0].request_body.items.0.unknown", "response.body.items.0.unknown"},
+		},
+		{
+			name:     "raw payload",
+			mapping:  `{"response": {"payload": "CAE="}}`,
+			wantErrs: []string{"response.payload"},
+		},
+		{
+			name: "value types",
+			mapping: `{
+				"request_body": {"status": {"rule": "equal", "value": "STATUS_GONE"}},
+				"response": {"body": {"id": "abc", "status": "STATUS_GONE", "ttl": "forever"}}
+			}`,
+			wantErrs: []string{"request_body.status", "response.body.id", "response.body.status", "response.body.ttl"},
+		},
+		{
+			name: "value getters",
+			mapping: `{
+				"response": {"body": {"id": "$req.body.unknown", "items": "$req.body.name", "count": "$req.metadata.x-count"}}
+			}`,
+			wantErrs: []string{"response.body.id", "response.body.items", "response.body.count"},
+		},
+		{
+			name: "peer and tls",
+			mapping: `{
+				"peer": {"ip": {"rule": "glob", "value": "10.*"}, "port": {"rule": "exists"}},
+				"tls": {"sans": {"rule": "contains", "value": "svc-a.internal"}, "subjct": {"rule": "exists"}},
+				"any_of": [{"tls": {"unknown": {"rule": "exists"}}}],
+				"response": {"body": {"name": "$req.tls.subject", "payload": "$req.peer.ip", "id": "$req.tls.common_name", "items": "$req.tls.unknown"}}
+			}`,
+			wantErrs: []string{"peer.port", "tls.subjct", "any_of[0].tls.unknown", "response.body.id", "response.body.items"},
+		},
+		{
+			name: "oneof conflict",
+			mapping: `{
+				"request_body": {"name": {"rule": "exists"}, "email": {"rule": "glob", "value": "*@example.com"}},
+				"response": {"body": {"name": "john", "email": "john@example.com"}}
+			}`,
+			wantErrs: []string{"request_body", "response.body"},
+		},
+		{
+			name: "oneof absent",
+			mapping: `{
+				"request_body": {"name": {"rule": "exists"}, "email": {"rule": "absent"}}
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Mapping{ID: "test", Endpoint: "/pkg.Service/Method", Source: "mappings/test.json"}
+			if err := json.Unmarshal([]byte(tt.mapping), m); err != nil {
+				t.Fatalf("unmarshal mapping: %v", err)
+			}
+
+			errs := m.Validate(md, md, nil)
+			if len(errs) != len(tt.wantErrs) {
+				t.Fatalf("Mapping.Validate() returned %d errors, want %d: %v", len(errs), len(tt.wantErrs), errs)
+			}
+
+			for _, path := range tt.wantErrs {
+				var found bool
+				for _, err := range errs {
+					var verr *ValidationError
+					if ok := asValidationError(err, &verr); ok && verr.Path == path {
+						found = true
+						if !strings.HasPrefix(verr.Error(), "mappings/test.json: mapping (id=test") {
+							t.Errorf("unexpected error format: %s", verr.Error())
+						}
+					}
+				}
+				if !found {
+					t.Errorf("expected problem at path %q, got: %v", path, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestMapping_ValidateRaw(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+		// wantErrs are the paths of the expected problems.
+		wantErrs []string
+	}{
+		{
+			name: "valid",
+			mapping: `{
+				"metadata": {"x-tenant": {"rule": "equal", "value": "acme"}},
+				"none_of": [{"metadata": {"user-agent": {"rule": "glob", "value": "curl*"}}}, {"tls": {"common_name": {"rule": "equal", "value": "blocked"}}}],
+				"response": {"code": "UNAVAILABLE", "error_message": "down", "payload": "CAE="}
+			}`,
+		},
+		{
+			name: "descriptor required",
+			mapping: `{
+				"request_body": {"id": {"rule": "exists"}},
+				"any_of": [{"request_body": {"name": {"rule": "exists"}}}],
+				"when": "true",
+				"response": {"body": {"id": 1}, "generate": true}
+			}`,
+			wantErrs: []string{"request_body", "any_of[0].request_body", "when", "response.body", "response.generate"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Mapping{ID: "test", Endpoint: "/pkg.Unknown/Method"}
+			if err := json.Unmarshal([]byte(tt.mapping), m); err != nil {
+				t.Fatalf("unmarshal mapping: %v", err)
+			}
+
+			var paths []string
+			for _, err := range m.ValidateRaw() {
+				var verr *ValidationError
+				if !asValidationError(err, &verr) {
+					t.Fatalf("unexpected error type: %v", err)
+				}
+				paths = append(paths, verr.Path)
+			}
+			if strings.Join(paths, ",") != strings.Join(tt.wantErrs, ",") {
+				t.Errorf("Mapping.ValidateRaw() problems at %v, want %v", paths, tt.wantErrs)
+			}
+		})
+	}
+}
+
+func asValidationError(err error, target **ValidationError) bool {
+	verr, ok := err.(*ValidationError) //nolint:errorlint
+	if ok {
+		*target = verr
+	}
+
+	return ok
+}
+
+func TestMapping_PositionOf(t *testing.T) {
+	m := &Mapping{
+		Position: Position{Line: 2, Column: 3},
+		Positions: map[string]Position{
+			"request_body":                    {Line: 4, Column: 5},
+			"response.body":                   {Line: 10, Column: 7},
+			"response.body.items.0.id":        {Line: 11, Column: 9},
+			"any_of[1].request_body.email":    {Line: 20, Column: 11},
+			"any_of[1]":                       {Line: 19, Column: 5},
+			"response.body.items.0.status.id": {Line: 12, Column: 9},
+		},
+	}
+
+	tests := []struct {
+		path string
+		want Position
+	}{
+		{path: "", want: Position{Line: 2, Column: 3}},
+		{path: "request_body", want: Position{Line: 4, Column: 5}},
+		{path: "request_body.id", want: Position{Line: 4, Column: 5}},
+		{path: "response.body.items.0.id", want: Position{Line: 11, Column: 9}},
+		{path: "response.body.items.0.name", want: Position{Line: 10, Column: 7}},
+		{path: "any_of[1].request_body.email", want: Position{Line: 20, Column: 11}},
+		{path: "any_of[1].request_body.name", want: Position{Line: 19, Column: 5}},
+		{path: "when", want: Position{Line: 2, Column: 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.PositionOf(tt.path); got != tt.want {
+				t.Errorf("Mapping.PositionOf(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapping_Clone(t *testing.T) {
+	md := testMessageDescriptor(t)
+
+	var m Mapping
+	err := json.Unmarshal([]byte(`{
+		"id": "m1",
+		"endpoint": "/test.Service/Method",
+		"request_body": {"status": {"rule": "equal", "value": "STATUS_ACTIVE"}},
+		"any_of": [{"request_body": {"items.0.id": {"rule": "not", "value": {"rule": "equal", "value": 1}}}}],
+		"response": {"body": {"id": "$req.body.id"}}
+	}`), &m)
+	if err != nil {
+		t.Fatalf("unmarshal mapping: %v", err)
+	}
+	m.Source, m.Position = "mappings/m1.json", Position{Line: 1, Column: 1}
+	m.Positions = map[string]Position{"request_body.status": {Line: 4, Column: 20}}
+	if errs := m.Validate(md, md, nil); len(errs) > 0 {
+		t.Fatalf("Mapping.Validate() errors = %v", errs)
+	}
+
+	clone, err := m.Clone()
+	if err != nil {
+		t.Fatalf("Mapping.Clone() error = %v", err)
+	}
+	if clone.Location() != m.Location() || clone.PositionOf("request_body.status") != m.PositionOf("request_body.status") {
+		t.Errorf("Mapping.Clone() location = %s, want %s", clone.Location(), m.Location())
+	}
+	if errs := clone.Validate(md, md, nil); len(errs) > 0 {
+		t.Errorf("Mapping.Validate() of the clone errors = %v", errs)
+	}
+
+	clone.Positions["request_body.status"] = Position{Line: 100}
+	clone.RequestBody["status"] = ValueMatcher{Rule: MatchingRuleExists}
+	if m.PositionOf("request_body.status").Line != 4 || m.RequestBody["status"].Rule != MatchingRuleEqual {
+		t.Errorf("Mapping.Clone() shares the state with the original mapping")
+	}
+}
+
+func TestMapping_EndpointMatches(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		method   string
+		want     bool
+	}{
+		{endpoint: "/pkg.Service/Method", method: "/pkg.Service/Method", want: true},
+		{endpoint: "/pkg.Service/Method", method: "/pkg.Service/MethodV2", want: false},
+		{endpoint: "/acme.billing.v1.*/*", method: "/acme.billing.v1.InvoiceService/Get", want: true},
+		{endpoint: "/acme.billing.v1.*/*", method: "/acme.users.v1.UserService/Get", want: false},
+		{endpoint: "/pkg.Svc/List*", method: "/pkg.Svc/ListUsers", want: true},
+		{endpoint: "/pkg.Svc/List*", method: "/pkg.Svc/GetUser", want: false},
+		{endpoint: "/pkg.*", method: "/pkg.Svc/List", want: false},
+		{endpoint: "/pkg.Svc/{Get,Delete}User", method: "/pkg.Svc/DeleteUser", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.endpoint+" "+tt.method, func(t *testing.T) {
+			m := &Mapping{Endpoint: tt.endpoint}
+			if err := m.IsValid(); err != nil && tt.want {
+				t.Fatalf("Mapping.IsValid() error = %v", err)
+			}
+			if got := m.EndpointMatches(tt.method); got != tt.want {
+				t.Errorf("Mapping.EndpointMatches(%q) = %v, want %v", tt.method, got, tt.want)
+			}
+		})
+	}
+}
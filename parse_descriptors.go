@@ -1,24 +1,89 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"slices"
+	"strings"
 
+	"github.com/bufbuild/protocompile"
+	"github.com/bufbuild/protocompile/reporter"
+	"google.golang.org/protobuf/encoding/protojson"
 	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/default23/protofake/config"
+	"github.com/default23/protofake/mapper"
 )
 
-func parseDescriptorFiles(fileExtensions []string, dir string) ([]*descriptorpb.FileDescriptorSet, error) {
+// protoSourceExtension is the extension of the protobuf source files, which are compiled in-process.
+const protoSourceExtension = ".proto"
+
+const gzipExtension = ".gz"
+
+// gzipMagic is the header of the gzip-compressed content.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// errNoDescriptors is returned when neither the descriptors directory nor the other sources provide the descriptors.
+var errNoDescriptors = errors.New("no descriptors found, protofake can't work without protobuf definitions, which should be mocked")
+
+// loadDescriptors collects the descriptors from the descriptors directory and from the server reflection
+// of the configured addresses.
+func loadDescriptors(ctx context.Context, conf *config.Config, dataDir string) ([]*descriptorpb.FileDescriptorSet, error) {
+	descriptorsDir := filepath.Join(dataDir, "descriptors")
+	descriptors, err := parseDescriptorFiles(conf.DescriptorExtensions, conf.ProtoImportPaths, descriptorsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse descriptor files: %w", err)
+	}
+	slog.Info("processed descriptors dir", "count", len(descriptors), "dir", descriptorsDir)
+
+	if len(conf.DescriptorReflectionAddrs) > 0 {
+		creds, credsErr := reflectionCredentials(conf.DescriptorReflectionTLS)
+		if credsErr != nil {
+			return nil, fmt.Errorf("failed to configure server reflection TLS: %w", credsErr)
+		}
+
+		for _, addr := range conf.DescriptorReflectionAddrs {
+			fetchCtx, cancel := context.WithTimeout(ctx, conf.DescriptorReflectionTimeout)
+			set, fetchErr := fetchReflectionDescriptors(fetchCtx, strings.TrimSpace(addr), creds)
+			cancel()
+			if fetchErr != nil {
+				return nil, fmt.Errorf("failed to load descriptors via server reflection: %w", fetchErr)
+			}
+
+			slog.Info("loaded descriptors via server reflection", "addr", addr, "pb_files_count", len(set.GetFile()))
+			descriptors = append(descriptors, set)
+		}
+	}
+
+	if len(descriptors) == 0 {
+		return nil, errNoDescriptors
+	}
+
+	return descriptors, nil
+}
+
+func parseDescriptorFiles(fileExtensions, importPaths []string, dir string) ([]*descriptorpb.FileDescriptorSet, error) {
 	logger := slog.With("descriptors_dir", dir)
 
 	logger.Debug("analyzing descriptors directory")
 	stat, err := os.Stat(dir)
 	if err != nil {
+		if os.IsNotExist(err) {
+			logger.Warn("descriptors directory not found, skipping")
+			return nil, nil
+		}
+
 		return nil, fmt.Errorf("get descriptors directory info: %w", err)
 	}
 
@@ -30,13 +95,24 @@ func parseDescriptorFiles(fileExtensions []string, dir string) ([]*descriptorpb.
 	logger.Debug("looking for descriptor files", "extensions", fileExtensions)
 
 	descriptors := make([]*descriptorpb.FileDescriptorSet, 0)
+	// sources are the .proto files, relative to the descriptors directory.
+	var sources []string
 	err = filepath.Walk(dir, func(path string, info fs.FileInfo, _ error) error {
 		if info.IsDir() {
 			return nil
 		}
 
 		ext := filepath.Ext(path)
-		if !slices.Contains(fileExtensions, ext) {
+		if ext == protoSourceExtension {
+			rel, relErr := filepath.Rel(dir, path)
+			if relErr != nil {
+				return fmt.Errorf("resolve relative path of '%s': %w", path, relErr)
+			}
+
+			sources = append(sources, filepath.ToSlash(rel))
+			return nil
+		}
+		if !matchesDescriptorExtension(fileExtensions, path) {
 			return nil
 		}
 
@@ -47,22 +123,168 @@ func parseDescriptorFiles(fileExtensions []string, dir string) ([]*descriptorpb.
 				return nil
 			}
 
-			return fmt.Errorf("read descriptor file '%s': %w", path, err)
+			return fmt.Errorf("read descriptor file '%s': %w", path, readErr)
 		}
 
 		logger.Debug("found descriptor file, parsing contents...", "path", path)
-		var fileDescriptorSet descriptorpb.FileDescriptorSet
-		if err = proto.Unmarshal(content, &fileDescriptorSet); err != nil {
-			return fmt.Errorf("unmarshal descriptor file at path '%s': %w", path, err)
+		fileDescriptorSet, decodeErr := decodeDescriptorSet(path, content)
+		if decodeErr != nil {
+			return fmt.Errorf("unmarshal descriptor file at path '%s': %w", path, decodeErr)
 		}
 
 		logger.Debug("successfully parsed descriptor file", "path", path, "pb_files_count", len(fileDescriptorSet.GetFile()))
-		descriptors = append(descriptors, &fileDescriptorSet)
+		descriptors = append(descriptors, fileDescriptorSet)
 		return nil
 	})
 	if err != nil {
 		return nil, fmt.Errorf("search for .pb files in dir '%s': %w", dir, err)
 	}
 
+	if len(sources) > 0 {
+		logger.Debug("found .proto files, compiling...", "count", len(sources), "import_paths", importPaths)
+		fileDescriptorSet, compileErr := compileProtoFiles(context.Background(), append([]string{dir}, importPaths...), sources)
+		if compileErr != nil {
+			return nil, fmt.Errorf("compile .proto files in dir '%s': %w", dir, compileErr)
+		}
+
+		logger.Debug("successfully compiled .proto files", "pb_files_count", len(fileDescriptorSet.GetFile()))
+		descriptors = append(descriptors, fileDescriptorSet)
+	}
+
 	return descriptors, nil
 }
+
+// matchesDescriptorExtension reports whether the file has one of the descriptor extensions,
+// the gzip-compressed files are matched by the extension before ".gz", e.g. "image.binpb.gz".
+func matchesDescriptorExtension(fileExtensions []string, path string) bool {
+	ext := filepath.Ext(path)
+	if slices.Contains(fileExtensions, ext) {
+		return true
+	}
+	if ext == gzipExtension {
+		return slices.Contains(fileExtensions, filepath.Ext(strings.TrimSuffix(path, gzipExtension)))
+	}
+
+	return false
+}
+
+// decodeDescriptorSet decodes the descriptor set in one of the supported formats:
+//   - the binary FileDescriptorSet, e.g. built by protoc with --descriptor_set_out;
+//   - the binary Buf image, built by "buf build -o image.binpb", it is wire-compatible with FileDescriptorSet;
+//   - the FileDescriptorSet or the Buf image in the protojson form, e.g. built by "buf build -o image.json";
+//   - any of the above, compressed with gzip.
+//
+// The format is detected by the content, the ".json" extension forces the protojson form.
+// The Buf specific extensions of the image files are discarded.
+func decodeDescriptorSet(path string, content []byte) (*descriptorpb.FileDescriptorSet, error) {
+	if bytes.HasPrefix(content, gzipMagic) {
+		zr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("open gzip content: %w", err)
+		}
+		defer zr.Close()
+
+		if content, err = io.ReadAll(zr); err != nil {
+			return nil, fmt.Errorf("decompress gzip content: %w", err)
+		}
+		path = strings.TrimSuffix(path, gzipExtension)
+	}
+
+	set := new(descriptorpb.FileDescriptorSet)
+	trimmed := bytes.TrimSpace(content)
+	if filepath.Ext(path) == ".json" || (len(trimmed) > 0 && trimmed[0] == '{') {
+		if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(content, set); err != nil {
+			return nil, fmt.Errorf("unmarshal protojson descriptor set: %w", err)
+		}
+
+		return set, nil
+	}
+
+	if err := (proto.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(content, set); err != nil {
+		return nil, fmt.Errorf("unmarshal binary descriptor set: %w", err)
+	}
+
+	return set, nil
+}
+
+// compileProtoFiles compiles the .proto files with the given import paths, the well-known types are resolved
+// even if they are not present in the import paths. Returns the set of the compiled files and all their imports,
+// all the compilation errors are reported at once.
+func compileProtoFiles(ctx context.Context, importPaths, files []string) (*descriptorpb.FileDescriptorSet, error) {
+	var errs []error
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{ImportPaths: importPaths}),
+		Reporter: reporter.NewReporter(
+			func(err reporter.ErrorWithPos) error {
+				errs = append(errs, compileError(importPaths, err))
+				return nil // continue to collect all the errors
+			},
+			func(err reporter.ErrorWithPos) {
+				slog.Warn("compile .proto file", "warning", err.Error())
+			},
+		),
+	}
+
+	compiled, err := compiler.Compile(ctx, files...)
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if err != nil {
+		// the imports, which are not found, are not passed to the reporter
+		var posErr reporter.ErrorWithPos
+		if errors.As(err, &posErr) {
+			return nil, compileError(importPaths, posErr)
+		}
+
+		return nil, err
+	}
+
+	set := new(descriptorpb.FileDescriptorSet)
+	added := make(map[string]struct{})
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if _, ok := added[fd.Path()]; ok {
+			return
+		}
+		added[fd.Path()] = struct{}{}
+
+		imports := fd.Imports()
+		for i := range imports.Len() {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, fd := range compiled {
+		add(fd)
+	}
+
+	return set, nil
+}
+
+// compileError converts the compilation error to the error with the path of the .proto file and the position.
+func compileError(importPaths []string, err reporter.ErrorWithPos) error {
+	pos := err.GetPosition()
+	cause := err.Unwrap()
+	if errors.Is(cause, fs.ErrNotExist) {
+		// the cause names the file of the last import path only
+		cause = fmt.Errorf("imported file is not found in the import paths: %s", strings.Join(importPaths, ", "))
+	}
+
+	return &sourceFileError{
+		Path:     resolveSourcePath(importPaths, pos.Filename),
+		Position: mapper.Position{Line: pos.Line, Column: pos.Col},
+		Err:      cause,
+	}
+}
+
+// resolveSourcePath returns the path of the .proto file, found in the import paths.
+func resolveSourcePath(importPaths []string, name string) string {
+	for _, dir := range importPaths {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+
+	return name
+}
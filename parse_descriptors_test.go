@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestCompileProtoFiles(t *testing.T) {
+	protoDir := filepath.Join("testdata", "proto")
+	importsDir := filepath.Join("testdata", "proto_imports")
+
+	set, err := compileProtoFiles(context.Background(), []string{protoDir, importsDir}, []string{"greeter.proto"})
+	if err != nil {
+		t.Fatalf("compileProtoFiles() error = %v", err)
+	}
+
+	// the imports precede the importing files, each file is added once
+	want := []string{"acme/tenant.proto", "google/protobuf/timestamp.proto", "sender.proto", "greeter.proto"}
+	if got := descriptorSetFiles(set); !slices.Equal(got, want) {
+		t.Fatalf("compileProtoFiles() files = %v, want %v", got, want)
+	}
+
+	greeter := set.GetFile()[3]
+	if got := greeter.GetMessageType()[1].GetField()[2].GetTypeName(); got != ".google.protobuf.Timestamp" {
+		t.Errorf("HelloReply.sent_at type = %s, want the standard import type", got)
+	}
+	if got := greeter.GetMessageType()[0].GetField()[2].GetTypeName(); got != ".acme.Tenant" {
+		t.Errorf("HelloRequest.tenant type = %s, want the type from the import path", got)
+	}
+}
+
+func TestCompileProtoFiles__Errors(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"broken.proto": `syntax = "proto3";
+
+package broken;
+
+message Request {
+  Unknown first = 1;
+  repeated Missing second = 2;
+}
+`,
+		"syntax.proto": `syntax = "proto3";
+
+message Reply {
+  string message = 1
+}
+`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		importPaths []string
+		files       []string
+		// want are the expected "path:line:column" prefixes of the reported errors.
+		want []string
+	}{
+		{
+			name:        "missing import path",
+			importPaths: []string{filepath.Join("testdata", "proto")},
+			files:       []string{"greeter.proto"},
+			want:        []string{filepath.Join("testdata", "proto", "greeter.proto") + ":5:8"},
+		},
+		{
+			name:        "all the errors are reported",
+			importPaths: []string{dir},
+			files:       []string{"broken.proto", "syntax.proto"},
+			want: []string{
+				filepath.Join(dir, "syntax.proto") + ":5:1",
+				filepath.Join(dir, "broken.proto") + ":6:3",
+				filepath.Join(dir, "broken.proto") + ":7:12",
+			},
+		},
+		{
+			name:        "invalid types",
+			importPaths: []string{dir},
+			files:       []string{"broken.proto"},
+			want: []string{
+				filepath.Join(dir, "broken.proto") + ":6:3",
+				filepath.Join(dir, "broken.proto") + ":7:12",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := compileProtoFiles(context.Background(), tt.importPaths, tt.files)
+			if err == nil {
+				t.Fatalf("compileProtoFiles() = %v, want the error", descriptorSetFiles(set))
+			}
+
+			var ferr *sourceFileError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("compileProtoFiles() error = %v, want the source file error", err)
+			}
+
+			got := strings.Split(err.Error(), "\n")
+			if len(got) != len(tt.want) {
+				t.Fatalf("compileProtoFiles() errors = %q, want %d errors", got, len(tt.want))
+			}
+			for i, prefix := range tt.want {
+				if !strings.HasPrefix(got[i], prefix+": ") {
+					t.Errorf("error #%d = %q, want the prefix %q", i, got[i], prefix)
+				}
+			}
+		})
+	}
+}
+
+func descriptorSetFiles(set *descriptorpb.FileDescriptorSet) []string {
+	var names []string
+	for _, f := range set.GetFile() {
+		names = append(names, f.GetName())
+	}
+
+	return names
+}
+
+func TestDecodeDescriptorSet(t *testing.T) {
+	set, err := compileProtoFiles(context.Background(), []string{filepath.Join("testdata", "proto_imports")}, []string{"acme/tenant.proto"})
+	if err != nil {
+		t.Fatalf("compile test protos: %v", err)
+	}
+
+	binary, err := proto.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal descriptor set: %v", err)
+	}
+	protoJSON, err := protojson.Marshal(set)
+	if err != nil {
+		t.Fatalf("marshal descriptor set to JSON: %v", err)
+	}
+	bufImageJSON, err := os.ReadFile(filepath.Join("testdata", "descriptors", "buf_image.json"))
+	if err != nil {
+		t.Fatalf("read buf image: %v", err)
+	}
+
+	// the Buf image is the FileDescriptorSet with the buf_extension (8) of each file
+	bufImage := protowire.AppendTag(nil, 1, protowire.BytesType)
+	file, err := proto.Marshal(set.GetFile()[0])
+	if err != nil {
+		t.Fatalf("marshal file descriptor: %v", err)
+	}
+	file = protowire.AppendTag(file, 8, protowire.BytesType)
+	file = protowire.AppendBytes(file, protowire.AppendVarint(protowire.AppendTag(nil, 1, protowire.VarintType), 1))
+	bufImage = protowire.AppendBytes(bufImage, file)
+
+	tests := []struct {
+		name    string
+		path    string
+		content []byte
+	}{
+		{"binary", "set.pb", binary},
+		{"gzip binary", "set.binpb.gz", gzipContent(t, binary)},
+		{"protojson", "set.json", protoJSON},
+		{"protojson detected by content", "set.bin", append([]byte("\n  "), protoJSON...)},
+		{"gzip protojson", "set.json.gz", gzipContent(t, protoJSON)},
+		{"buf image", "image.binpb", bufImage},
+		{"buf image protojson", "image.json", bufImageJSON},
+		{"gzip buf image", "image.binpb.gz", gzipContent(t, bufImage)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeDescriptorSet(tt.path, tt.content)
+			if err != nil {
+				t.Fatalf("decodeDescriptorSet() error = %v", err)
+			}
+			if names := descriptorSetFiles(got); !slices.Equal(names, []string{"acme/tenant.proto"}) {
+				t.Fatalf("decodeDescriptorSet() files = %v", names)
+			}
+			if _, err = protodesc.NewFiles(got); err != nil {
+				t.Errorf("decoded descriptor set is invalid: %v", err)
+			}
+			if len(got.GetFile()[0].ProtoReflect().GetUnknown()) != 0 {
+				t.Errorf("decodeDescriptorSet() keeps the unknown fields")
+			}
+		})
+	}
+}
+
+func TestDecodeDescriptorSet__Corrupt(t *testing.T) {
+	binary, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{{Name: proto.String("a.proto")}}})
+	if err != nil {
+		t.Fatalf("marshal descriptor set: %v", err)
+	}
+	compressed := gzipContent(t, binary)
+
+	tests := []struct {
+		name    string
+		path    string
+		content []byte
+		wantErr string
+	}{
+		{"truncated binary", "set.pb", binary[:len(binary)-2], "unmarshal binary descriptor set"},
+		{"not a descriptor set", "set.pb", []byte("not a descriptor set"), "unmarshal binary descriptor set"},
+		{"invalid JSON", "set.json", []byte(`{"file": [`), "unmarshal protojson descriptor set"},
+		{"JSON of the wrong type", "set.bin", []byte(`{"file": "a.proto"}`), "unmarshal protojson descriptor set"},
+		{"truncated gzip", "set.pb.gz", compressed[:len(compressed)-10], "decompress gzip content"},
+		{"gzip header only", "set.pb.gz", compressed[:4], "open gzip content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeDescriptorSet(tt.path, tt.content)
+			if err == nil {
+				t.Fatalf("decodeDescriptorSet() = %v, want the error", descriptorSetFiles(got))
+			}
+			if !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("decodeDescriptorSet() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func gzipContent(t *testing.T, content []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		t.Fatalf("compress content: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("compress content: %v", err)
+	}
+
+	return buf.Bytes()
+}
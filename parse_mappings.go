@@ -3,19 +3,40 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 
 	"github.com/default23/protofake/mapper"
 )
 
-func parseMappingFiles(dir string) ([]*mapper.Mapping, error) {
+// schemaFileSuffix is the suffix of the JSON schema files of the json_schema matchers, such files
+// inside the mappings directory are not parsed as mappings.
+const schemaFileSuffix = ".schema.json"
+
+// parseMappingFiles decodes the mappings of all the files in the directory, except the excluded subdirectories,
+// the error contains the problems of all the invalid files.
+func parseMappingFiles(dir string, excludedDirs ...string) ([]*mapper.Mapping, error) {
+	mappings, _, err := parseMappingFilesPartially(dir, excludedDirs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return mappings, nil
+}
+
+// parseMappingFilesPartially decodes the mappings of the files in the directory the same way as parseMappingFiles,
+// but the mappings of the valid files are returned along with the paths of the files failed to read or parse.
+// The error contains the problems of all such files, the paths are nil if the directory itself could not be read.
+func parseMappingFilesPartially(dir string, excludedDirs ...string) ([]*mapper.Mapping, []string, error) {
 	logger := slog.With("mappings_dir", dir)
 
 	logger.Debug("analyzing mappings directory")
@@ -23,83 +44,243 @@ func parseMappingFiles(dir string) ([]*mapper.Mapping, error) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			logger.Warn("mappings directory not found, skipping")
-			return nil, nil
+			return nil, nil, nil
 		}
 
-		return nil, fmt.Errorf("get descriptors directory info: %w", err)
+		return nil, nil, fmt.Errorf("get descriptors directory info: %w", err)
 	}
 	if !stat.IsDir() {
-		return nil, fmt.Errorf("mappings directory is not a directory")
+		return nil, nil, fmt.Errorf("mappings directory is not a directory")
 	}
 
-	logger.Debug("looking for .json mapping files")
+	logger.Debug("looking for .json, .yaml and .yml mapping files")
 
 	mappings := make([]*mapper.Mapping, 0)
+	// errs are the problems of all the mapping files, the walk is not stopped on the invalid file.
+	var (
+		errs   []error
+		failed []string
+	)
 	err = filepath.Walk(dir, func(path string, info fs.FileInfo, _ error) error {
-		if info == nil || info.IsDir() {
+		if info == nil {
+			return nil
+		}
+		if info.IsDir() {
+			if slices.Contains(excludedDirs, path) {
+				logger.Debug("excluded directory, skipping", "path", path)
+				return filepath.SkipDir
+			}
+
 			return nil
 		}
 
-		if ext := filepath.Ext(path); ext != ".json" {
+		if strings.HasSuffix(path, schemaFileSuffix) {
+			logger.Debug("JSON schema file, skipping", "path", path)
+			return nil
+		}
+
+		var parse func(path string, content []byte) ([]*mapper.Mapping, error)
+		switch filepath.Ext(path) {
+		case ".json":
+			parse = parseJSONMappingFile
+		case ".yaml", ".yml":
+			parse = parseYAMLMappingFile
+		default:
 			return nil
 		}
 
 		content, readErr := os.ReadFile(path)
 		if readErr != nil {
-			return fmt.Errorf("read mapping file '%s': %w", path, err)
+			errs = append(errs, fmt.Errorf("read mapping file '%s': %w", path, readErr))
+			failed = append(failed, path)
+			return nil
 		}
 
-		content = bytes.TrimSpace(content)
-		if len(content) == 0 {
+		if len(bytes.TrimSpace(content)) == 0 {
 			logger.Debug("empty mapping file, skipping", "path", path)
 			return nil
 		}
 
-		switch content[0] {
-		case '[':
-			var mm []*mapper.Mapping
-			if err = json.Unmarshal(content, &mm); err != nil {
-				return fmt.Errorf("unmarshal mapping from file '%s': %w", path, err)
-			}
-			for _, m := range mm {
-				if err = m.IsValid(); err != nil {
-					return fmt.Errorf("validate mapping '%s' from file '%s': %w", m.Endpoint, path, err)
-				}
-
-				if !strings.HasPrefix(m.Endpoint, "/") {
-					m.Endpoint = "/" + m.Endpoint
-				}
-			}
-
-			mappings = append(mappings, mm...)
-		case '{':
-			m := new(mapper.Mapping)
-			if err = json.Unmarshal(content, m); err != nil {
-				return fmt.Errorf("unmarshal mapping from file '%s': %w", path, err)
-			}
-			if err = m.IsValid(); err != nil {
-				return fmt.Errorf("validate mappings from file '%s': %w", path, err)
-			}
-
-			if !strings.HasPrefix(m.Endpoint, "/") {
-				m.Endpoint = "/" + m.Endpoint
-			}
-
-			mappings = append(mappings, m)
-		default:
-			return fmt.Errorf("mapping file '%s' does not contain a valid JSON content", path)
+		mm, parseErr := parse(path, content)
+		if parseErr != nil {
+			errs = append(errs, parseErr)
+			failed = append(failed, path)
+			return nil
 		}
 
+		mappings = append(mappings, mm...)
 		return nil
 	})
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("search for mapping files in dir '%s': %w", dir, err)
 	}
+
 	for _, m := range mappings {
 		if strings.TrimSpace(m.ID) == "" {
 			m.ID = uuid.NewString()
 		}
+		if !strings.HasPrefix(m.Endpoint, "/") {
+			m.Endpoint = "/" + m.Endpoint
+		}
+	}
+
+	return mappings, failed, errors.Join(errs...)
+}
+
+// sourceFileError is the problem of the data file, e.g. the mapping or the .proto source, at the given position.
+type sourceFileError struct {
+	Path     string
+	Position mapper.Position
+	Err      error
+}
+
+func (e *sourceFileError) Error() string {
+	if !e.Position.IsValid() {
+		return fmt.Sprintf("%s: %v", e.Path, e.Err)
+	}
+
+	return fmt.Sprintf("%s:%s: %v", e.Path, e.Position, e.Err)
+}
+
+func (e *sourceFileError) Unwrap() error {
+	return e.Err
+}
+
+// parseJSONMappingFile decodes the single mapping or the list of mappings from the JSON file content.
+// Each mapping keeps the file and the positions of the mapping and its keys.
+func parseJSONMappingFile(path string, content []byte) ([]*mapper.Mapping, error) {
+	if !json.Valid(content) {
+		err := json.Unmarshal(content, new(any))
+
+		var pos mapper.Position
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			pos = positionAt(content, max(syntaxErr.Offset-1, 0))
+		}
+
+		return nil, &sourceFileError{Path: path, Position: pos, Err: fmt.Errorf("invalid JSON content: %w", err)}
+	}
+
+	// offsets are the start offsets of the mappings in the file content.
+	var offsets []int64
+	dec := json.NewDecoder(bytes.NewReader(content))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, &sourceFileError{Path: path, Err: fmt.Errorf("invalid JSON content: %w", err)}
+	}
+	switch tok {
+	case json.Delim('['):
+		for dec.More() {
+			offsets = append(offsets, tokenStart(content, dec.InputOffset()))
+			if err = dec.Decode(new(json.RawMessage)); err != nil {
+				return nil, &sourceFileError{Path: path, Err: fmt.Errorf("invalid JSON content: %w", err)}
+			}
+		}
+	case json.Delim('{'):
+		offsets = append(offsets, tokenStart(content, 0))
+	default:
+		return nil, &sourceFileError{Path: path, Err: errors.New("the file should contain the mapping object or the list of mappings")}
+	}
+
+	mappings := make([]*mapper.Mapping, 0, len(offsets))
+	for _, offset := range offsets {
+		m := &mapper.Mapping{
+			Source:    path,
+			Position:  positionAt(content, offset),
+			Positions: jsonPositions(content, offset),
+		}
+
+		dec = json.NewDecoder(bytes.NewReader(content[offset:]))
+		if err = dec.Decode(m); err != nil {
+			pos := m.Position
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				pos = m.PositionOf(typeErr.Field)
+			}
+
+			return nil, &sourceFileError{Path: path, Position: pos, Err: fmt.Errorf("unmarshal mapping: %w", err)}
+		}
+
+		mappings = append(mappings, m)
 	}
 
 	return mappings, nil
 }
+
+// jsonPositions returns the positions of the object keys and the list elements of the JSON value,
+// which starts at the offset of the content. The keys are joined by ".", the list indexes are added as "[i]".
+func jsonPositions(content []byte, offset int64) map[string]mapper.Position {
+	positions := make(map[string]mapper.Position)
+	dec := json.NewDecoder(bytes.NewReader(content[offset:]))
+
+	var walk func(path string) error
+	walk = func(path string) error {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			for dec.More() {
+				start := tokenStart(content, offset+dec.InputOffset())
+				if tok, err = dec.Token(); err != nil {
+					return err
+				}
+
+				key, _ := tok.(string)
+				if path != "" {
+					key = path + "." + key
+				}
+				positions[key] = positionAt(content, start)
+				if err = walk(key); err != nil {
+					return err
+				}
+			}
+		case json.Delim('['):
+			for i := 0; dec.More(); i++ {
+				key := fmt.Sprintf("%s[%d]", path, i)
+				positions[key] = positionAt(content, tokenStart(content, offset+dec.InputOffset()))
+				if err = walk(key); err != nil {
+					return err
+				}
+			}
+		default:
+			return nil
+		}
+
+		_, err = dec.Token() // the closing delimiter
+		return err
+	}
+
+	if err := walk(""); err != nil {
+		slog.Debug("failed to resolve the mapping keys positions", "error", err)
+	}
+
+	return positions
+}
+
+// tokenStart returns the offset of the next JSON token, skipping the whitespaces and the separators.
+func tokenStart(content []byte, offset int64) int64 {
+	for offset < int64(len(content)) {
+		switch content[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+
+	return offset
+}
+
+// positionAt returns the line and the column of the content offset.
+func positionAt(content []byte, offset int64) mapper.Position {
+	before := content[:offset]
+	lineStart := bytes.LastIndexByte(before, '\n') + 1
+
+	return mapper.Position{
+		Line:   bytes.Count(before, []byte("\n")) + 1,
+		Column: utf8.RuneCount(before[lineStart:]) + 1,
+	}
+}
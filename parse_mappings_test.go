@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/default23/protofake/mapper"
+)
+
+func TestParseJSONMappingFile__Positions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		// want are the expected positions of the mapping keys by the mapping index.
+		want []map[string]string
+	}{
+		{
+			name: "single mapping",
+			content: `{
+  "id": "hello",
+  "request_body": {
+    "user.name": {"rule": "equal", "value": "john"}
+  }
+}`,
+			want: []map[string]string{{
+				"":                              "1:1",
+				"id":                            "2:3",
+				"request_body":                  "3:3",
+				"request_body.user.name":        "4:5",
+				"request_body.user.name.value":  "4:36",
+				"request_body.user.name.rule.x": "4:19",
+				"response.body.message":         "1:1",
+			}},
+		},
+		{
+			name: "top-level list with nested conditions",
+			content: `[
+  {"id": "first"},
+  {
+    "id": "second",
+    "any_of": [
+      {"metadata": {"x-user-id": {"rule": "exists"}}},
+      {
+        "metadata": {
+          "x-tenant": {"rule": "exists"}
+        }
+      }
+    ]
+  }
+]`,
+			want: []map[string]string{
+				{"": "2:3", "id": "2:4"},
+				{
+					"":                             "3:3",
+					"id":                           "4:5",
+					"any_of":                       "5:5",
+					"any_of[0]":                    "6:7",
+					"any_of[0].metadata.x-user-id": "6:21",
+					"any_of[1]":                    "7:7",
+					"any_of[1].metadata":           "8:9",
+					"any_of[1].metadata.x-tenant":  "9:11",
+				},
+			},
+		},
+		{
+			name:    "escaped keys",
+			content: `{"metadata": {"x\u002dtenant": {"rule": "exists"}, "say \"hi\"": {"rule": "exists"}}, "é": 1, "id": "a"}`,
+			want: []map[string]string{{
+				"metadata.x-tenant":   "1:15",
+				"metadata.say \"hi\"": "1:52",
+				"é":                   "1:87",
+				"id":                  "1:95",
+			}},
+		},
+		{
+			name:    "CRLF line endings",
+			content: "[\r\n  {\r\n    \"id\": \"crlf\",\r\n    \"response\": {\r\n      \"body\": {\"message\": \"привет\", \"ok\": true}\r\n    }\r\n  }\r\n]\r\n",
+			want: []map[string]string{{
+				"":                      "2:3",
+				"id":                    "3:5",
+				"response.body":         "5:7",
+				"response.body.message": "5:16",
+				"response.body.ok":      "5:37",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mappings, err := parseJSONMappingFile("mapping.json", []byte(tt.content))
+			if err != nil {
+				t.Fatalf("parseJSONMappingFile() error = %v", err)
+			}
+			if len(mappings) != len(tt.want) {
+				t.Fatalf("parseJSONMappingFile() count = %d, want %d", len(mappings), len(tt.want))
+			}
+
+			for i, want := range tt.want {
+				if mappings[i].Source != "mapping.json" {
+					t.Errorf("mapping #%d source = %q", i, mappings[i].Source)
+				}
+				for path, pos := range want {
+					// the unknown paths are resolved to the closest parent, the mapping at last
+					if got := mappings[i].PositionOf(path).String(); got != pos {
+						t.Errorf("mapping #%d PositionOf(%q) = %s, want %s", i, path, got, pos)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseJSONMappingFile__Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantPos string
+	}{
+		{"syntax error", "{\n  \"id\": \"a\",\n  \"endpoint\" \"b\"\n}", "3:14"},
+		{"trailing comma in list", "[\r\n  {\"id\": \"a\"},\r\n]", "3:1"},
+		{"wrong type", "[{\"id\": \"a\"},\n {\"id\": \"b\",\n  \"endpoint\": 1}]", "3:3"},
+		{"wrong nested type", "{\n  \"response\": {\n    \"code\": [\"OK\"]\n  }\n}", "3:5"},
+		{"scalar content", `"mapping"`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseJSONMappingFile("mapping.json", []byte(tt.content))
+
+			var ferr *sourceFileError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("parseJSONMappingFile() error = %v, want the source file error", err)
+			}
+			if ferr.Path != "mapping.json" {
+				t.Errorf("error path = %q", ferr.Path)
+			}
+
+			got := ""
+			if ferr.Position.IsValid() {
+				got = ferr.Position.String()
+			}
+			if got != tt.wantPos {
+				t.Errorf("error position = %q, want %q (error %v)", got, tt.wantPos, err)
+			}
+		})
+	}
+}
+
+func TestPositionAt(t *testing.T) {
+	content := []byte("ab\r\nπc\nd")
+	tests := []struct {
+		offset int64
+		want   mapper.Position
+	}{
+		{0, mapper.Position{Line: 1, Column: 1}},
+		{2, mapper.Position{Line: 1, Column: 3}},
+		{4, mapper.Position{Line: 2, Column: 1}},
+		{6, mapper.Position{Line: 2, Column: 2}},
+		{8, mapper.Position{Line: 3, Column: 1}},
+	}
+
+	for _, tt := range tests {
+		if got := positionAt(content, tt.offset); got != tt.want {
+			t.Errorf("positionAt(%d) = %s, want %s", tt.offset, got, tt.want)
+		}
+	}
+}
+
+func TestParseMappingFilesPartially(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"hello.json":                `{"id": "hello", "endpoint": "pkg.Service/Hello"}`,
+		"nested/goodbye.yaml":       "id: goodbye\nendpoint: /pkg.Service/Goodbye\n",
+		"nested/broken.yml":         "id: broken\nendpoint: [\n",
+		"broken.json":               `{"id": "broken",}`,
+		"request.schema.json":       `{"type": "object"}`,
+		"nested/notes.txt":          "not a mapping",
+		"nested/deeper/empty.json":  "  \n",
+		"nested/deeper/listed.json": `[{"endpoint": "/pkg.Service/Listed"}]`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	mappings, failed, err := parseMappingFilesPartially(dir)
+	if err == nil {
+		t.Fatalf("parseMappingFilesPartially() error = nil, want the problems of the broken files")
+	}
+
+	wantFailed := []string{filepath.Join(dir, "broken.json"), filepath.Join(dir, "nested", "broken.yml")}
+	if !slices.Equal(failed, wantFailed) {
+		t.Errorf("parseMappingFilesPartially() failed = %v, want %v", failed, wantFailed)
+	}
+	for _, path := range wantFailed {
+		if !strings.Contains(err.Error(), path) {
+			t.Errorf("parseMappingFilesPartially() error = %v, want the problem of %s", err, path)
+		}
+	}
+
+	var endpoints []string
+	for _, m := range mappings {
+		if m.ID == "" {
+			t.Errorf("mapping %s has no id", m.Endpoint)
+		}
+		endpoints = append(endpoints, m.Endpoint)
+	}
+	if want := []string{"/pkg.Service/Hello", "/pkg.Service/Listed", "/pkg.Service/Goodbye"}; !slices.Equal(endpoints, want) {
+		t.Errorf("parseMappingFilesPartially() endpoints = %v, want %v", endpoints, want)
+	}
+
+	// the strict parsing returns none of the mappings
+	if mappings, err = parseMappingFiles(dir); err == nil || mappings != nil {
+		t.Errorf("parseMappingFiles() = %v, %v, want the error only", mappings, err)
+	}
+}
+
+func TestParseMappingFiles__ExcludedDirs(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"hello.json":        `{"id": "hello", "endpoint": "/pkg.Service/Hello"}`,
+		"api/hello.json":    `{"id": "hello", "endpoint": "/pkg.Service/Persisted"}`,
+		"api/broken.json":   `{`,
+		"apis/goodbye.json": `{"id": "goodbye", "endpoint": "/pkg.Service/Goodbye"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create dir: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	mappings, err := parseMappingFiles(dir, filepath.Join(dir, "api"))
+	if err != nil {
+		t.Fatalf("parseMappingFiles() error = %v", err)
+	}
+
+	var endpoints []string
+	for _, m := range mappings {
+		endpoints = append(endpoints, m.Endpoint)
+	}
+	if want := []string{"/pkg.Service/Goodbye", "/pkg.Service/Hello"}; !slices.Equal(endpoints, want) {
+		t.Errorf("parseMappingFiles() endpoints = %v, want %v", endpoints, want)
+	}
+}
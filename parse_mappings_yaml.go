@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/default23/protofake/mapper"
+)
+
+// yamlErrorLine extracts the line number from the yaml syntax error message, e.g. "yaml: line 3: ...".
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+):`)
+
+// parseYAMLMappingFile decodes the mappings from the YAML file content.
+// The file could contain the single mapping, the list of mappings or the multiple documents of both.
+// The YAML values are converted to JSON, so the mappings are decoded exactly as the JSON mappings.
+func parseYAMLMappingFile(path string, content []byte) ([]*mapper.Mapping, error) {
+	var mappings []*mapper.Mapping
+
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	for {
+		var doc yaml.Node
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			var pos mapper.Position
+			if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+				pos.Line, _ = strconv.Atoi(m[1])
+			}
+
+			return nil, &sourceFileError{Path: path, Position: pos, Err: fmt.Errorf("invalid YAML content: %w", err)}
+		}
+		if len(doc.Content) == 0 {
+			continue // the document contains the comments only
+		}
+
+		root := resolveAlias(doc.Content[0])
+		if root.Kind == yaml.ScalarNode && root.Tag == "!!null" {
+			continue // the empty document, e.g. the comments between the separators
+		}
+		if isAnchorsDocument(root) {
+			continue // the anchors are referenced by the other documents
+		}
+
+		var nodes []*yaml.Node
+		switch root.Kind {
+		case yaml.SequenceNode:
+			nodes = root.Content
+		case yaml.MappingNode:
+			nodes = []*yaml.Node{root}
+		default:
+			return nil, &sourceFileError{
+				Path:     path,
+				Position: yamlPosition(root),
+				Err:      errors.New("the document should contain the mapping object or the list of mappings"),
+			}
+		}
+
+		for _, node := range nodes {
+			m, err := decodeYAMLMapping(path, node)
+			if err != nil {
+				return nil, err
+			}
+
+			mappings = append(mappings, m)
+		}
+	}
+
+	return mappings, nil
+}
+
+// isAnchorsDocument reports whether the document only defines the anchors for the other documents:
+// it is the object without the endpoint key, which defines the anchors.
+func isAnchorsDocument(root *yaml.Node) bool {
+	return root.Kind == yaml.MappingNode && !hasYAMLKey(root, "endpoint") && hasYAMLAnchor(root)
+}
+
+// hasYAMLKey reports whether the mapping node has the key, including the merged keys.
+func hasYAMLKey(node *yaml.Node, key string) bool {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], resolveAlias(node.Content[i+1])
+		if keyNode.Tag != "!!merge" {
+			if keyNode.Value == key {
+				return true
+			}
+			continue
+		}
+
+		merged := []*yaml.Node{valueNode}
+		if valueNode.Kind == yaml.SequenceNode {
+			merged = valueNode.Content
+		}
+		for _, m := range merged {
+			if m = resolveAlias(m); m.Kind == yaml.MappingNode && hasYAMLKey(m, key) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// hasYAMLAnchor reports whether the anchor is defined by the node or its children.
+func hasYAMLAnchor(node *yaml.Node) bool {
+	if node.Anchor != "" {
+		return true
+	}
+	if node.Kind == yaml.AliasNode {
+		return false
+	}
+
+	for _, child := range node.Content {
+		if hasYAMLAnchor(child) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func decodeYAMLMapping(path string, node *yaml.Node) (*mapper.Mapping, error) {
+	m := &mapper.Mapping{
+		Source:    path,
+		Position:  yamlPosition(node),
+		Positions: make(map[string]mapper.Position),
+	}
+
+	value, err := yamlValue(node, "", m.Positions)
+	if err != nil {
+		var ferr *sourceFileError
+		if errors.As(err, &ferr) {
+			ferr.Path = path
+			return nil, ferr
+		}
+
+		return nil, &sourceFileError{Path: path, Position: m.Position, Err: err}
+	}
+
+	content, err := json.Marshal(value)
+	if err != nil {
+		return nil, &sourceFileError{Path: path, Position: m.Position, Err: fmt.Errorf("convert mapping to JSON: %w", err)}
+	}
+	if err = json.Unmarshal(content, m); err != nil {
+		pos := m.Position
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			pos = m.PositionOf(typeErr.Field)
+		}
+
+		return nil, &sourceFileError{Path: path, Position: pos, Err: fmt.Errorf("unmarshal mapping: %w", err)}
+	}
+
+	return m, nil
+}
+
+// yamlValue converts the YAML node into the JSON compatible value and collects the positions of the keys
+// and the list elements by path, the same way as jsonPositions does.
+func yamlValue(node *yaml.Node, path string, positions map[string]mapper.Position) (any, error) {
+	node = resolveAlias(node)
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		obj := make(map[string]any, len(node.Content)/2)
+		if err := yamlMerge(node, path, positions, obj); err != nil {
+			return nil, err
+		}
+
+		return obj, nil
+	case yaml.SequenceNode:
+		list := make([]any, 0, len(node.Content))
+		for i, item := range node.Content {
+			key := fmt.Sprintf("%s[%d]", path, i)
+			positions[key] = yamlPosition(item)
+
+			value, err := yamlValue(item, key, positions)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+
+		return list, nil
+	case yaml.ScalarNode:
+		return yamlScalar(node)
+	default:
+		return nil, &sourceFileError{Position: yamlPosition(node), Err: fmt.Errorf("unsupported YAML node kind %d", node.Kind)}
+	}
+}
+
+// yamlMerge puts the key-value pairs of the mapping node into the object.
+// The keys, merged with "<<", don't override the keys, defined in the node itself.
+func yamlMerge(node *yaml.Node, path string, positions map[string]mapper.Position, obj map[string]any) error {
+	var merged []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, valueNode := node.Content[i], node.Content[i+1]
+		if keyNode.Tag == "!!merge" {
+			valueNode = resolveAlias(valueNode)
+			if valueNode.Kind == yaml.SequenceNode {
+				merged = append(merged, valueNode.Content...)
+			} else {
+				merged = append(merged, valueNode)
+			}
+			continue
+		}
+		if keyNode.Kind != yaml.ScalarNode {
+			return &sourceFileError{Position: yamlPosition(keyNode), Err: errors.New("the mapping keys should be scalar values")}
+		}
+
+		key := keyNode.Value
+		if path != "" {
+			key = path + "." + key
+		}
+		positions[key] = yamlPosition(keyNode)
+
+		value, err := yamlValue(valueNode, key, positions)
+		if err != nil {
+			return err
+		}
+		obj[keyNode.Value] = value
+	}
+
+	for _, m := range merged {
+		m = resolveAlias(m)
+		if m.Kind != yaml.MappingNode {
+			return &sourceFileError{Position: yamlPosition(m), Err: errors.New("the merged value should be a mapping")}
+		}
+
+		base := make(map[string]any)
+		basePositions := make(map[string]mapper.Position)
+		if err := yamlMerge(m, path, basePositions, base); err != nil {
+			return err
+		}
+		for k, v := range base {
+			if _, ok := obj[k]; !ok {
+				obj[k] = v
+			}
+		}
+		for k, p := range basePositions {
+			if _, ok := positions[k]; !ok {
+				positions[k] = p
+			}
+		}
+	}
+
+	return nil
+}
+
+// yamlScalar converts the scalar node by its resolved tag.
+// The timestamps and the binary values are kept as is, they are the strings in JSON mappings as well.
+func yamlScalar(node *yaml.Node) (any, error) {
+	switch node.ShortTag() {
+	case "!!null":
+		return nil, nil
+	case "!!bool", "!!int":
+		var v any
+		if err := node.Decode(&v); err != nil {
+			return nil, &sourceFileError{Position: yamlPosition(node), Err: err}
+		}
+
+		return v, nil
+	case "!!float":
+		var f float64
+		if err := node.Decode(&f); err != nil {
+			return nil, &sourceFileError{Position: yamlPosition(node), Err: err}
+		}
+
+		// protojson accepts the special float values as strings only
+		switch {
+		case math.IsNaN(f):
+			return "NaN", nil
+		case math.IsInf(f, 1):
+			return "Infinity", nil
+		case math.IsInf(f, -1):
+			return "-Infinity", nil
+		}
+
+		return f, nil
+	case "!!binary":
+		return strings.Join(strings.Fields(node.Value), ""), nil
+	default:
+		return node.Value, nil
+	}
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+
+	return node
+}
+
+func yamlPosition(node *yaml.Node) mapper.Position {
+	return mapper.Position{Line: node.Line, Column: node.Column}
+}
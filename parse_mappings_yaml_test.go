@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/default23/protofake/mapper"
+)
+
+func TestParseYAMLMappingFile(t *testing.T) {
+	type wantMapping struct {
+		id   string
+		body map[string]any
+		// positions are the expected positions of the mapping keys.
+		positions map[string]string
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    []wantMapping
+	}{
+		{
+			name: "single mapping",
+			content: `# the comment
+id: hello
+endpoint: /pkg.Service/Method
+request_body:
+  user.name: { rule: equal, value: john }
+response:
+  body:
+    message: hi
+`,
+			want: []wantMapping{{
+				id:   "hello",
+				body: map[string]any{"message": "hi"},
+				positions: map[string]string{
+					"":                             "2:1",
+					"id":                           "2:1",
+					"request_body.user.name":       "5:3",
+					"request_body.user.name.value": "5:29",
+					"response.body.message":        "8:5",
+				},
+			}},
+		},
+		{
+			name: "top-level list",
+			content: `- id: first
+  endpoint: /pkg.Service/Method
+- id: second
+  endpoint: /pkg.Service/Method
+  any_of:
+    - metadata:
+        x-tenant: { rule: exists }
+    - metadata: { x-user-id: { rule: exists } }
+`,
+			want: []wantMapping{
+				{id: "first", positions: map[string]string{"": "1:3", "endpoint": "2:3"}},
+				{id: "second", positions: map[string]string{
+					"":                             "3:3",
+					"any_of[0]":                    "6:7",
+					"any_of[0].metadata.x-tenant":  "7:9",
+					"any_of[1].metadata.x-user-id": "8:19",
+				}},
+			},
+		},
+		{
+			name: "multiple documents",
+			content: `id: first
+endpoint: /pkg.Service/Method
+---
+# the comments only
+---
+- id: second
+  endpoint: /pkg.Service/Method
+- id: third
+  endpoint: /pkg.Service/Method
+`,
+			want: []wantMapping{
+				{id: "first", positions: map[string]string{"": "1:1"}},
+				{id: "second", positions: map[string]string{"": "6:3"}},
+				{id: "third", positions: map[string]string{"": "8:3", "endpoint": "9:3"}},
+			},
+		},
+		{
+			name: "merge keys and anchors document",
+			content: `base: &base
+  endpoint: /pkg.Service/Method
+  response:
+    body: { message: base, count: 1 }
+---
+<<: *base
+id: merged
+---
+id: overridden
+<<: *base
+response:
+  body: { message: own }
+`,
+			want: []wantMapping{
+				{
+					id:        "merged",
+					body:      map[string]any{"message": "base", "count": float64(1)},
+					positions: map[string]string{"": "6:1", "id": "7:1", "endpoint": "2:3", "response.body.message": "4:13"},
+				},
+				{
+					id:        "overridden",
+					body:      map[string]any{"message": "own"},
+					positions: map[string]string{"": "9:1", "endpoint": "2:3", "response.body.message": "12:11"},
+				},
+			},
+		},
+		{
+			name: "special values",
+			content: `id: special
+endpoint: /pkg.Service/Method
+response:
+  body:
+    pos: .inf
+    neg: -.Inf
+    nan: .NaN
+    big: 9007199254740993
+    at: 2025-04-27T00:00:00Z
+    raw: !!binary |
+      aGVs
+      bG8=
+    empty: ~
+`,
+			want: []wantMapping{{
+				id: "special",
+				body: map[string]any{
+					"pos": "Infinity", "neg": "-Infinity", "nan": "NaN", "big": float64(9007199254740993),
+					"at": "2025-04-27T00:00:00Z", "raw": "aGVsbG8=", "empty": nil,
+				},
+				positions: map[string]string{"response.body.raw": "10:5", "response.body.empty": "13:5"},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mappings, err := parseYAMLMappingFile("mapping.yaml", []byte(tt.content))
+			if err != nil {
+				t.Fatalf("parseYAMLMappingFile() error = %v", err)
+			}
+			if len(mappings) != len(tt.want) {
+				t.Fatalf("parseYAMLMappingFile() count = %d, want %d", len(mappings), len(tt.want))
+			}
+
+			for i, want := range tt.want {
+				m := mappings[i]
+				if m.ID != want.id || m.Source != "mapping.yaml" || m.Endpoint != "/pkg.Service/Method" {
+					t.Errorf("mapping #%d = (id=%s endpoint=%s source=%s), want id %s", i, m.ID, m.Endpoint, m.Source, want.id)
+				}
+				if want.body != nil && !reflect.DeepEqual(m.Response.Body, want.body) {
+					t.Errorf("mapping #%d response body = %#v, want %#v", i, m.Response.Body, want.body)
+				}
+				for path, pos := range want.positions {
+					if got := m.PositionOf(path).String(); got != pos {
+						t.Errorf("mapping #%d PositionOf(%q) = %s, want %s", i, path, got, pos)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParseYAMLMappingFile__Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantPos string
+	}{
+		{"syntax error", "id: a\nendpoint: b\n  response: {}\n", "3"},
+		{"scalar document", "id: a\nendpoint: /pkg.Service/Method\n---\njust a string\n", "4:1"},
+		{"complex key", "id: a\nendpoint: /pkg.Service/Method\n? [a, b]\n: c\n", "3:3"},
+		{"merge of scalar", "id: a\nendpoint: /pkg.Service/Method\nresponse:\n  <<: scalar\n", "4:7"},
+		{"wrong type", "- id: a\n  endpoint: /pkg.Service/Method\n  response:\n    code: [OK]\n", "4:5"},
+		{"unknown alias", "id: a\nendpoint: *missing\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAMLMappingFile("mapping.yaml", []byte(tt.content))
+
+			var ferr *sourceFileError
+			if !errors.As(err, &ferr) {
+				t.Fatalf("parseYAMLMappingFile() error = %v, want the source file error", err)
+			}
+			if ferr.Path != "mapping.yaml" {
+				t.Errorf("error path = %q", ferr.Path)
+			}
+
+			got := ""
+			if ferr.Position.IsValid() {
+				got = ferr.Position.String()
+			}
+			if got != tt.wantPos {
+				t.Errorf("error position = %q, want %q (error %v)", got, tt.wantPos, err)
+			}
+		})
+	}
+}
+
+func TestParseYAMLMappingFile__WithoutEndpoint(t *testing.T) {
+	// the object without the endpoint and the anchors is the mapping, reported by the mapping validation
+	mappings, err := parseYAMLMappingFile("mapping.yaml", []byte("id: a\nresponse: { code: OK }\n"))
+	if err != nil {
+		t.Fatalf("parseYAMLMappingFile() error = %v", err)
+	}
+	if len(mappings) != 1 || mappings[0].ID != "a" {
+		t.Fatalf("parseYAMLMappingFile() = %v, want the mapping without endpoint", mappings)
+	}
+	if err := mappings[0].IsValid(); err == nil {
+		t.Errorf("IsValid() = nil, want the missing endpoint error")
+	}
+}
+
+func TestParseYAMLMappingFile__SameAsJSON(t *testing.T) {
+	const yamlContent = `id: same
+endpoint: /pkg.Service/Method
+request_body:
+  count: { rule: between, value: [1, 10] }
+  tags: { rule: any_of, value: [{ rule: equal, value: a }, { rule: exists }] }
+response:
+  code: NOT_FOUND
+  error_message: not found
+`
+	const jsonContent = `{
+  "id": "same",
+  "endpoint": "/pkg.Service/Method",
+  "request_body": {
+    "count": {"rule": "between", "value": [1, 10]},
+    "tags": {"rule": "any_of", "value": [{"rule": "equal", "value": "a"}, {"rule": "exists"}]}
+  },
+  "response": {"code": "NOT_FOUND", "error_message": "not found"}
+}`
+
+	fromYAML, err := parseYAMLMappingFile("mapping.yaml", []byte(yamlContent))
+	if err != nil {
+		t.Fatalf("parseYAMLMappingFile() error = %v", err)
+	}
+	fromJSON, err := parseJSONMappingFile("mapping.json", []byte(jsonContent))
+	if err != nil {
+		t.Fatalf("parseJSONMappingFile() error = %v", err)
+	}
+
+	for _, m := range []*mapper.Mapping{fromYAML[0], fromJSON[0]} {
+		m.Source, m.Position, m.Positions = "", mapper.Position{}, nil
+	}
+	if !reflect.DeepEqual(fromYAML[0], fromJSON[0]) {
+		t.Errorf("YAML mapping = %+v, want the same as JSON %+v", fromYAML[0], fromJSON[0])
+	}
+}
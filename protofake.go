@@ -2,17 +2,25 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
 
+	"github.com/default23/protofake/admin"
 	"github.com/default23/protofake/config"
+	"github.com/default23/protofake/mapper"
 	"github.com/default23/protofake/server"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+
 	conf, err := config.Parse()
 	if err != nil {
 		log.Fatalf("failed to parse configuration: %v", err)
@@ -20,19 +28,19 @@ func main() {
 
 	logger := NewLogger(conf.Logger)
 
-	descriptorsDir := filepath.Join(conf.DataDir, "descriptors")
-	descriptors, err := parseDescriptorFiles(conf.DescriptorExtensions, descriptorsDir)
+	descriptors, err := loadDescriptors(context.Background(), conf, conf.DataDir)
 	if err != nil {
-		log.Fatalf("failed to parse descriptor files: %v", err)
-	}
-
-	logger.Info("processed descriptors dir", "count", len(descriptors), "dir", descriptorsDir)
-	if len(descriptors) == 0 {
-		log.Fatal("no descriptors found in the directory, protofake can't work without protobuf definitions, which should be mocked")
+		log.Fatal(err)
 	}
 
 	mappingsDir := filepath.Join(conf.DataDir, "mappings")
-	mappings, err := parseMappingFiles(mappingsDir)
+	// the persisted API mappings are loaded by the admin server with the "api" origin, not as the mapping files
+	persistDir := filepath.Join(mappingsDir, admin.PersistedMappingsDir)
+	var excludedDirs []string
+	if conf.Admin.PersistMappings {
+		excludedDirs = append(excludedDirs, persistDir)
+	}
+	mappings, err := parseMappingFiles(mappingsDir, excludedDirs...)
 	if err != nil {
 		log.Fatalf("failed to parse mapping files: %v", err)
 	}
@@ -50,31 +58,75 @@ func main() {
 		}
 	}
 
-	if err = srv.SetMappings(mappings); err != nil {
+	if err = srv.SetMappings(mapper.OriginFile, mappings); err != nil {
 		log.Fatalf("can't start protofake with given mappings: %v", err)
 	}
+
+	adminSrv := admin.New(conf.Admin, srv, persistDir)
+	if conf.Admin.PersistMappings {
+		count, loadErr := adminSrv.LoadPersistedMappings()
+		if loadErr != nil {
+			log.Fatalf("can't start protofake with persisted API mappings: %v", loadErr)
+		}
+
+		logger.Info("processed persisted API mappings dir", "count", count, "dir", persistDir)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	if conf.WatchMappingsChanges {
-		err = watchChanges(ctx, mappingsDir, func() {
+		status := adminSrv.TrackReload("mappings", mappingsDir)
+		err = watchChanges(ctx, mappingsDir, excludedDirs, conf.WatchDebounce, status, func() error {
 			logger.Info("reloading mappings...")
 
-			mappings, err = parseMappingFiles(mappingsDir)
-			if err != nil {
-				logger.Error("failed to reload mappings", "error", err)
-				return
+			// the files are replaced one by one, the invalid files keep their previous mappings
+			reloaded, failed, parseErr := parseMappingFilesPartially(mappingsDir, excludedDirs...)
+			if parseErr != nil && failed == nil {
+				return fmt.Errorf("parse mapping files: %w", parseErr)
 			}
-
-			if err = srv.SetMappings(mappings); err != nil {
-				logger.Error("failed to reload mappings, unable to update mappings on server", "error", err)
+			if parseErr != nil {
+				parseErr = fmt.Errorf("parse mapping files, the previous mappings of the files are kept: %w", parseErr)
+			}
+			if reloadErr := srv.ReloadMappings(mapper.OriginFile, reloaded, failed); reloadErr != nil {
+				parseErr = errors.Join(parseErr, fmt.Errorf("update mappings on server: %w", reloadErr))
+			}
+			if parseErr != nil {
+				return parseErr
 			}
-			logger.Info("reloaded mappings", "count", len(mappings))
+
+			logger.Info("reloaded mappings", "count", len(reloaded))
+			return nil
 		})
 		if err != nil {
 			log.Fatalf("failed to configure the mapping files watching: %s", err)
 		}
 	}
+	if conf.WatchDescriptorsChanges {
+		descriptorsDir := filepath.Join(conf.DataDir, "descriptors")
+		status := adminSrv.TrackReload("descriptors", descriptorsDir)
+		err = watchChanges(ctx, descriptorsDir, nil, conf.WatchDebounce, status, func() error {
+			logger.Info("reloading descriptors...")
+
+			reloaded, reloadErr := loadDescriptors(ctx, conf, conf.DataDir)
+			if reloadErr != nil {
+				return reloadErr
+			}
+			if reloadErr = srv.SetDescriptors(reloaded); reloadErr != nil {
+				return fmt.Errorf("update services on server: %w", reloadErr)
+			}
 
-	srv.Run()
+			logger.Info("reloaded descriptors", "count", len(reloaded))
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("failed to configure the descriptor files watching: %s", err)
+		}
+	}
+
+	if err = srv.Run(); err != nil {
+		log.Fatalf("failed to start gRPC server: %s", err)
+	}
+	if err = adminSrv.Run(); err != nil {
+		log.Fatalf("failed to start admin API server: %s", err)
+	}
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
@@ -82,6 +134,9 @@ func main() {
 	cancel()
 	logger.Info("shutting down application...")
 
+	if err = adminSrv.Close(); err != nil {
+		log.Fatalf("admin API server failed to shut down: %s", err)
+	}
 	if err = srv.Close(); err != nil {
 		log.Fatalf("API Server failed to shut down: %s", err)
 	}
@@ -7,26 +7,25 @@ import (
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 
 	"github.com/default23/protofake/mapper"
 )
 
-func buildResponse(
-	resp *mapper.Response,
-	reqBody map[string]any,
-	reqMetadata metadata.MD,
-) ([]byte, error) {
+func buildResponse(mapping *mapper.Mapping, req *mapper.Request) ([]byte, error) {
 	respBody := make(map[string]any)
-	if resp.Body != nil {
-		respBody = resp.Body
+	if mapping.Response.Body != nil {
+		respBody = mapping.Response.Body
 	}
 
 	outjson := "{}"
 	for k, v := range respBody {
-		var err error
-		outjson, err = sjson.Set(outjson, k, getResponseValue(v, reqBody, reqMetadata))
+		value, err := getResponseValue(v, mapping, req)
+		if err != nil {
+			return nil, status.Error(codes.FailedPrecondition, "failed to compute property "+k+" in output message, verify the registered mappings: "+err.Error())
+		}
+
+		outjson, err = sjson.Set(outjson, k, value)
 		if err != nil {
 			return nil, status.Error(codes.FailedPrecondition, "failed to set property "+k+" in output message, verify the registered mappings: "+err.Error())
 		}
@@ -35,28 +34,49 @@ func buildResponse(
 	return []byte(outjson), nil
 }
 
-func getResponseValue(val any, reqBody map[string]any, reqMetadata map[string][]string) any {
+func getResponseValue(val any, mapping *mapper.Mapping, req *mapper.Request) (any, error) {
 	str, ok := val.(string)
 	if !ok {
-		return val
+		return val, nil
+	}
+
+	if strings.HasPrefix(str, mapper.ExpressionPrefix) {
+		return mapping.Evaluate(strings.TrimPrefix(str, mapper.ExpressionPrefix), req)
 	}
 
 	if strings.HasPrefix(str, "$req.body.") {
 		valuePath := strings.TrimPrefix(str, "$req.body.")
 
-		jsonBody, _ := json.Marshal(reqBody)
+		jsonBody, _ := json.Marshal(req.Body)
 		value := gjson.GetBytes(jsonBody, valuePath)
 		if !value.Exists() {
-			return nil
+			return nil, nil
 		}
 
-		return value.Value()
+		return value.Value(), nil
+	}
+	if strings.HasPrefix(str, "$req.peer.") {
+		return infoValue(req.PeerInfo(), strings.TrimPrefix(str, "$req.peer.")), nil
+	}
+	if strings.HasPrefix(str, "$req.tls.") {
+		return infoValue(req.TLSInfo(), strings.TrimPrefix(str, "$req.tls.")), nil
 	}
 	if strings.HasPrefix(str, "$req.metadata.") {
 		valuePath := strings.TrimPrefix(str, "$req.metadata.")
 
-		return strings.Join(reqMetadata[valuePath], " ")
+		return strings.Join(req.Metadata[valuePath], " "), nil
+	}
+
+	return val, nil
+}
+
+// infoValue returns the value of the peer or tls info by the json path, nil if it is missing.
+func infoValue(info map[string]any, valuePath string) any {
+	jsonInfo, _ := json.Marshal(info)
+	value := gjson.GetBytes(jsonInfo, valuePath)
+	if !value.Exists() {
+		return nil
 	}
 
-	return val
+	return value.Value()
 }
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// maxGenerateDepth limits the nesting of the generated messages, so the recursive messages are generated finitely.
+const maxGenerateDepth = 4
+
+// skippedGeneratedMessages are the well-known types, which are left empty, because the sample value
+// can't be generated without the knowledge of the contents.
+var skippedGeneratedMessages = map[protoreflect.FullName]struct{}{
+	"google.protobuf.Any":       {},
+	"google.protobuf.Struct":    {},
+	"google.protobuf.Value":     {},
+	"google.protobuf.ListValue": {},
+	"google.protobuf.FieldMask": {},
+}
+
+// generateMessage fills the fields of the message, which are not set yet, with the sample values:
+// the field name for strings and bytes, 1 for numbers, true for booleans, the first non-zero value for enums,
+// a single element for the repeated fields and maps. Only the first field of each oneof is set,
+// if none of them is set already, the message member, which is set, is filled as well.
+// The fields of the response body are kept as is, even the zero values.
+func generateMessage(msg protoreflect.Message, body map[string]any) {
+	generateFields(msg, newExplicitFields(body), 0)
+}
+
+func generateFields(msg protoreflect.Message, explicit explicitFields, depth int) {
+	md := msg.Descriptor()
+	if _, ok := skippedGeneratedMessages[md.FullName()]; ok {
+		return
+	}
+	if md.FullName() == "google.protobuf.Timestamp" {
+		if !msg.Has(md.Fields().ByName("seconds")) {
+			msg.Set(md.Fields().ByName("seconds"), protoreflect.ValueOfInt64(time.Now().Unix()))
+		}
+		return
+	}
+
+	fields := md.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if oneof := fd.ContainingOneof(); oneof != nil && !oneof.IsSynthetic() {
+			// the member, which is set, is filled whichever it is, otherwise the first member is generated
+			set := msg.WhichOneof(oneof)
+			if (set != nil && set != fd) || (set == nil && oneof.Fields().Get(0) != fd) {
+				continue
+			}
+		}
+		if nested, ok := explicit.field(fd); ok {
+			// only the fields of the message, which are not set by the body, are generated
+			if nested != nil && fd.Message() != nil && !fd.IsList() && !fd.IsMap() && depth < maxGenerateDepth {
+				generateFields(msg.Mutable(fd).Message(), nested, depth+1)
+			}
+			continue
+		}
+		if msg.Has(fd) {
+			if fd.Message() != nil && !fd.IsList() && !fd.IsMap() && depth < maxGenerateDepth {
+				generateFields(msg.Mutable(fd).Message(), nil, depth+1)
+			}
+			continue
+		}
+		if fd.Message() != nil && depth >= maxGenerateDepth {
+			continue
+		}
+
+		switch {
+		case fd.IsList():
+			list := msg.Mutable(fd).List()
+			list.Append(sampleValue(fd, list.NewElement, depth))
+		case fd.IsMap():
+			m := msg.Mutable(fd).Map()
+			key := sampleValue(fd.MapKey(), nil, depth).MapKey()
+			m.Set(key, sampleValue(fd.MapValue(), m.NewValue, depth))
+		default:
+			msg.Set(fd, sampleValue(fd, func() protoreflect.Value { return msg.NewField(fd) }, depth))
+		}
+	}
+}
+
+// sampleValue returns the sample value of the field, the newMessage constructs the empty message of the field.
+func sampleValue(fd protoreflect.FieldDescriptor, newMessage func() protoreflect.Value, depth int) protoreflect.Value {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(true)
+	case protoreflect.EnumKind:
+		values := fd.Enum().Values()
+		for i := range values.Len() {
+			if values.Get(i).Number() != 0 {
+				return protoreflect.ValueOfEnum(values.Get(i).Number())
+			}
+		}
+		return protoreflect.ValueOfEnum(values.Get(0).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(1)
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(1)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(1)
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(1)
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(1.5)
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(1.5)
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(string(fd.Name()))
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(fd.Name()))
+	default: // message and group
+		v := newMessage()
+		generateFields(v.Message(), nil, depth+1)
+		return v
+	}
+}
+
+// explicitFields are the fields of the message, set by the response body, by the field name (either the proto
+// or the JSON one). The nested fields are set for the message, which is set partially, e.g. by the "user.id" key
+// or the object value; nil is set for the field, which is set as a whole, e.g. the scalar, the list or the map.
+type explicitFields map[string]explicitFields
+
+// newExplicitFields returns the fields of the response message, set by the body with the json path keys.
+func newExplicitFields(body map[string]any) explicitFields {
+	explicit := make(explicitFields, len(body))
+	for k, v := range body {
+		explicit.add(strings.Split(k, "."), v)
+	}
+
+	return explicit
+}
+
+func (e explicitFields) add(path []string, value any) {
+	name := path[0]
+	nested, seen := e[name]
+	if seen && nested == nil {
+		return // the field is set as a whole
+	}
+
+	obj, isObject := value.(map[string]any)
+	if len(path) == 1 && !isObject {
+		e[name] = nil
+		return
+	}
+
+	if nested == nil {
+		nested = make(explicitFields)
+		e[name] = nested
+	}
+	if len(path) > 1 {
+		nested.add(path[1:], value)
+		return
+	}
+	for k, v := range obj {
+		nested.add([]string{k}, v)
+	}
+}
+
+// field returns the nested fields of the field, reports whether the field is set by the body.
+func (e explicitFields) field(fd protoreflect.FieldDescriptor) (explicitFields, bool) {
+	if nested, ok := e[string(fd.Name())]; ok {
+		return nested, true
+	}
+	nested, ok := e[fd.JSONName()]
+
+	return nested, ok
+}
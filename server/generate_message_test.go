@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const oneofTestProto = `
+name: "oneof_test.proto"
+package: "protofake.oneof"
+syntax: "proto3"
+message_type {
+  name: "Event"
+  field { name: "id" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "id" }
+  field { name: "note" number: 2 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "note" oneof_index: 0 }
+  field { name: "sender" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".protofake.oneof.Sender" json_name: "sender" oneof_index: 0 }
+  oneof_decl { name: "payload" }
+}
+message_type {
+  name: "Sender"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+  field { name: "age" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "age" oneof_index: 0 }
+  field { name: "origin" number: 3 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".protofake.oneof.Sender" json_name: "origin" oneof_index: 0 }
+  oneof_decl { name: "details" }
+}
+`
+
+func TestGenerateMessage__Oneof(t *testing.T) {
+	fdp := new(descriptorpb.FileDescriptorProto)
+	if err := prototext.Unmarshal([]byte(oneofTestProto), fdp); err != nil {
+		t.Fatalf("unmarshal test proto: %v", err)
+	}
+	fd, err := protodesc.NewFile(fdp, nil)
+	if err != nil {
+		t.Fatalf("create test file: %v", err)
+	}
+	event := fd.Messages().ByName("Event")
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "first member generated",
+			body: `{}`,
+			want: `{"id": "id", "note": "note"}`,
+		},
+		{
+			name: "second member filled",
+			body: `{"sender": {}}`,
+			want: `{"id": "id", "sender": {"name": "name", "age": 1}}`,
+		},
+		{
+			name: "second member filled with the body values kept",
+			body: `{"id": "", "sender": {"name": ""}}`,
+			want: `{"sender": {"age": 1}}`,
+		},
+		{
+			name: "nested second member filled",
+			body: `{"sender": {"origin": {"origin": {}}}}`,
+			want: `{"id": "id", "sender": {"name": "name", "origin": {"name": "name", "origin": {"name": "name", "age": 1}}}}`,
+		},
+		{
+			name: "set scalar member kept",
+			body: `{"sender": {"age": 0}}`,
+			want: `{"id": "id", "sender": {"name": "name", "age": 0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body map[string]any
+			if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+				t.Fatalf("unmarshal body: %v", err)
+			}
+			msg := dynamicpb.NewMessage(event)
+			if err := protojson.Unmarshal([]byte(tt.body), msg); err != nil {
+				t.Fatalf("unmarshal message: %v", err)
+			}
+
+			generateMessage(msg, body)
+
+			content, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(msg)
+			if err != nil {
+				t.Fatalf("marshal message: %v", err)
+			}
+			var got, want map[string]any
+			if err = json.Unmarshal(content, &got); err != nil {
+				t.Fatalf("unmarshal generated message: %v", err)
+			}
+			if err = json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatalf("unmarshal want: %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("generateMessage() = %s, want %s", content, tt.want)
+			}
+		})
+	}
+}
@@ -12,32 +12,34 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/types/descriptorpb"
-	"google.golang.org/protobuf/types/known/emptypb"
 
 	"github.com/default23/protofake/mapper"
 )
 
-var emptyMessage = &emptypb.Empty{}
-
-// NewMockHandler is the constructor for the gRPC method handler.
+// newMockHandler is the constructor for the gRPC method handler.
 // Handles any incoming request for registered gRPC methods and applies the configured mappings on it.
-func (s *Server) NewMockHandler(
+// The handler resolves the types from the registry of the state, it is constructed for.
+func (s *Server) newMockHandler(
+	st *descriptorState,
 	protoDescr *descriptorpb.FileDescriptorProto,
 	serviceDescr *descriptorpb.ServiceDescriptorProto,
 	methodDescr *descriptorpb.MethodDescriptorProto,
 ) (grpc.MethodHandler, error) {
 	fullMethodName := fmt.Sprintf("/%s.%s/%s", protoDescr.GetPackage(), serviceDescr.GetName(), methodDescr.GetName())
 
-	msgFactory, err := NewMessageFactory(protoDescr, methodDescr)
+	msgFactory, err := NewMessageFactory(st.registry, protoDescr, methodDescr)
 	if err != nil {
 		return nil, fmt.Errorf("construct the messages factory for method %s: %w", fullMethodName, err)
 	}
-	s.messageFactory[fullMethodName] = msgFactory
+	st.messageFactory[fullMethodName] = msgFactory
 
 	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		var err error
 		defer func() {
 			if r := recover(); r != nil {
 				slog.Error("panic in gRPC handler", "error", r)
@@ -70,7 +72,7 @@ func (s *Server) NewMockHandler(
 		}
 
 		var jv []byte
-		jv, err = protojson.MarshalOptions{UseProtoNames: true}.Marshal(in.Interface())
+		jv, err = protojson.MarshalOptions{UseProtoNames: true, Resolver: st.registry.Types()}.Marshal(in.Interface())
 		slog.Debug("marshaled input message", "input", string(jv))
 		if err != nil {
 			slog.Error("marshaling input message", "error", err)
@@ -81,63 +83,101 @@ func (s *Server) NewMockHandler(
 			return nil, status.Error(codes.InvalidArgument, fmt.Sprintf("failed to unmarshal input message: %v", err))
 		}
 
-		mappings := s.mappings[fullMethodName]
+		mappings := s.endpointMappings(fullMethodName)
 		if len(mappings) == 0 {
 			logger.Warn("no mappings registered for method")
-			return nil, status.Error(codes.FailedPrecondition, "no mappings registered for method "+fullMethodName)
+			return s.fallbackResponse(out, "no mappings registered for method "+fullMethodName)
 		}
 
-		var mapping *mapper.Mapping
-		// iterate backwards over the mappings
-		// because the last mapping is the most recent added mapping.
-		for _, m := range slices.Backward(mappings) {
-			if !m.Matches(md, msgIn) {
-				continue
-			}
-
-			mapping = m
-			break
+		req := &mapper.Request{
+			Metadata: md,
+			Body:     msgIn,
+			Message:  in.Interface(),
 		}
+		req.Peer, _ = peer.FromContext(ctx)
+
+		mapping := matchMapping(mappings, req)
 		if mapping == nil {
 			logger.Warn("no matching mapping found")
-			return nil, status.Error(codes.FailedPrecondition, "no one of registered mappings matches the request")
+			return s.fallbackResponse(out, "no one of registered mappings matches the request")
 		}
 
 		logger = logger.With("mapping_id", mapping.ID)
-		code := mapping.Response.Code
-		if code == "" {
-			code = codes.OK.String()
-		}
-
-		responseCode := mapper.StrToCode[code]
-		if responseCode != codes.OK {
-			msg := "<unknown error message>"
-			if mapping.Response.ErrorMessage != "" {
-				msg = mapping.Response.ErrorMessage
-			}
-
-			logger.Debug("returning error response", "code", code, "error", mapping.Response.ErrorMessage)
-			return nil, status.Error(responseCode, msg)
+		if location := mapping.Location(); location != "" {
+			logger = logger.With("mapping_source", location)
 		}
-		if out == nil {
-			logger.Debug("returning empty response, because the method output message is not supposed to be used")
-			return emptyMessage, nil
+		if err = responseStatus(mapping.Response); err != nil {
+			logger.Debug("returning error response", "code", mapping.Response.Code, "error", mapping.Response.ErrorMessage)
+			return nil, err
 		}
 
 		var outValue []byte
-		outValue, err = buildResponse(&mapping.Response, msgIn, md)
+		outValue, err = buildResponse(mapping, req)
 		if err != nil {
 			return nil, err
 		}
 
 		unmarshalOpts := protojson.UnmarshalOptions{
 			DiscardUnknown: s.config.DiscardUnknownFields,
+			Resolver:       st.registry.Types(),
 		}
 		if err = unmarshalOpts.Unmarshal(outValue, out.Interface()); err != nil {
 			return nil, status.Errorf(codes.FailedPrecondition, "check registered mappings for method, failed to unmarshal output message (mapping_id=%s) into %s message: %v", mapping.ID, methodDescr.GetOutputType(), err.Error())
 		}
+		if mapping.Response.Generate {
+			generateMessage(out, mapping.Response.Body)
+		}
 
 		logger.Debug("successfully mapped gRPC request", "request", msgIn, "response", string(outValue))
 		return out, nil
 	}, nil
 }
+
+// defaultErrorMessage is the status message of the error response, which has no error message in the mapping.
+const defaultErrorMessage = "<unknown error message>"
+
+// responseStatus returns the error status of the mapping response, nil for the OK code.
+func responseStatus(resp mapper.Response) error {
+	code := mapper.StrToCode[resp.Code] // the empty code is OK
+	if code == codes.OK {
+		return nil
+	}
+
+	msg := resp.ErrorMessage
+	if msg == "" {
+		msg = defaultErrorMessage
+	}
+
+	return status.Error(code, msg)
+}
+
+// matchMapping returns the latest registered mapping, which matches the request. The fallback mappings are checked
+// only if none of the regular mappings matches, the fallbacks of the exact endpoint are preferred over the patterns.
+func matchMapping(mappings []*mapper.Mapping, req *mapper.Request) *mapper.Mapping {
+	passes := []func(m *mapper.Mapping) bool{
+		func(m *mapper.Mapping) bool { return !m.Fallback },
+		func(m *mapper.Mapping) bool { return m.Fallback && !m.IsPattern() },
+		func(m *mapper.Mapping) bool { return m.Fallback && m.IsPattern() },
+	}
+	for _, pass := range passes {
+		// iterate backwards over the mappings
+		// because the last mapping is the most recent added mapping.
+		for _, m := range slices.Backward(mappings) {
+			if pass(m) && m.Matches(req) {
+				return m
+			}
+		}
+	}
+
+	return nil
+}
+
+// fallbackResponse responds with the configured fallback code, when none of the mappings matches the request.
+// The empty message is returned for the OK code.
+func (s *Server) fallbackResponse(out protoreflect.Message, msg string) (any, error) {
+	if s.fallbackCode == codes.OK {
+		return out, nil
+	}
+
+	return nil, status.Error(s.fallbackCode, msg)
+}
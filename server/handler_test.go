@@ -0,0 +1,146 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/default23/protofake/mapper"
+)
+
+func TestMatchMapping(t *testing.T) {
+	regular := func(id, scenario string) *mapper.Mapping {
+		return &mapper.Mapping{
+			ID:       id,
+			Endpoint: sayHelloMethod,
+			Metadata: map[string]mapper.ValueMatcher{"x-scenario": {Rule: mapper.MatchingRuleEqual, Value: scenario}},
+		}
+	}
+	fallback := func(id, endpoint string) *mapper.Mapping {
+		return &mapper.Mapping{ID: id, Endpoint: endpoint, Fallback: true}
+	}
+
+	tests := []struct {
+		name     string
+		mappings []*mapper.Mapping
+		scenario string
+		want     string
+	}{
+		{"regular over fallbacks", []*mapper.Mapping{regular("regular", "a"), fallback("exact", sayHelloMethod), fallback("pattern", "/protofake.test.Greeter/*")}, "a", "regular"},
+		{"latest regular", []*mapper.Mapping{regular("first", "a"), regular("second", "a")}, "a", "second"},
+		{"exact fallback over pattern", []*mapper.Mapping{fallback("exact", sayHelloMethod), fallback("pattern", "/protofake.test.Greeter/*"), regular("regular", "a")}, "b", "exact"},
+		{"pattern fallback at last", []*mapper.Mapping{fallback("pattern", "/protofake.test.*/*"), regular("regular", "a")}, "b", "pattern"},
+		{"latest pattern fallback", []*mapper.Mapping{fallback("service", "/protofake.test.Greeter/*"), fallback("package", "/protofake.test.*/*")}, "b", "package"},
+		{"no match", []*mapper.Mapping{regular("regular", "a")}, "b", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, m := range tt.mappings {
+				if err := m.IsValid(); err != nil {
+					t.Fatalf("mapping %s is not valid: %v", m.ID, err)
+				}
+			}
+
+			var got string
+			if m := matchMapping(tt.mappings, &mapper.Request{Metadata: metadata.Pairs("x-scenario", tt.scenario)}); m != nil {
+				got = m.ID
+			}
+			if got != tt.want {
+				t.Errorf("matchMapping() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServer_FallbackResponse(t *testing.T) {
+	tests := []struct {
+		name         string
+		fallbackCode string
+		mappings     []*mapper.Mapping
+		wantCode     codes.Code
+	}{
+		{"default without mappings", "FAILED_PRECONDITION", nil, codes.FailedPrecondition},
+		{"configured without mappings", "not_found", nil, codes.NotFound},
+		{"configured without match", "UNAVAILABLE", []*mapper.Mapping{{
+			Endpoint: sayHelloMethod,
+			Metadata: map[string]mapper.ValueMatcher{"x-scenario": {Rule: mapper.MatchingRuleExists}},
+		}}, codes.Unavailable},
+		{"empty message for OK", "OK", nil, codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testConfig()
+			conf.FallbackCode = tt.fallbackCode
+			s := newTestServer(t, conf)
+			if err := s.SetMappings(mapper.OriginFile, tt.mappings); err != nil {
+				t.Fatalf("SetMappings() error = %v", err)
+			}
+
+			reply, err := invoke(t, s, dialTestServer(t, s), sayHelloMethod, `{"name": "john"}`)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("call error = %v, want code %s", err, tt.wantCode)
+			}
+			if err == nil && len(reply) != 0 {
+				t.Errorf("reply = %v, want the empty message", reply)
+			}
+		})
+	}
+
+	conf := testConfig()
+	conf.FallbackCode = "NOPE"
+	if _, err := New(conf); err == nil {
+		t.Errorf("New() with the unknown fallback code, expected error")
+	}
+}
+
+func TestServer_Generate__KeepsBodyValues(t *testing.T) {
+	tests := []struct {
+		name string
+		body map[string]any
+		want map[string]any
+	}{
+		{
+			"all generated",
+			nil,
+			map[string]any{"message": "message", "count": "1", "ok": true, "sender": map[string]any{"display_name": "display_name", "age": 1.0}},
+		},
+		{
+			"explicit zero values",
+			map[string]any{"message": "", "count": 0, "ok": false},
+			map[string]any{"sender": map[string]any{"display_name": "display_name", "age": 1.0}},
+		},
+		{
+			"nested path",
+			map[string]any{"sender.age": 0, "message": "hi"},
+			map[string]any{"message": "hi", "count": "1", "ok": true, "sender": map[string]any{"display_name": "display_name"}},
+		},
+		{
+			"nested object with json name",
+			map[string]any{"sender": map[string]any{"displayName": ""}},
+			map[string]any{"message": "message", "count": "1", "ok": true, "sender": map[string]any{"age": 1.0}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig())
+			m := &mapper.Mapping{Endpoint: sayHelloMethod, Response: mapper.Response{Generate: true, Body: tt.body}}
+			if err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{m}); err != nil {
+				t.Fatalf("SetMappings() error = %v", err)
+			}
+
+			reply, err := invoke(t, s, dialTestServer(t, s), sayHelloMethod, `{}`)
+			if err != nil {
+				t.Fatalf("call error = %v", err)
+			}
+			if !reflect.DeepEqual(reply, tt.want) {
+				t.Errorf("reply = %v, want %v", reply, tt.want)
+			}
+		})
+	}
+}
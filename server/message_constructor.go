@@ -2,10 +2,10 @@ package server
 
 import (
 	"fmt"
+	"strings"
 
 	"google.golang.org/protobuf/reflect/protodesc"
 	"google.golang.org/protobuf/reflect/protoreflect"
-	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
 	"google.golang.org/protobuf/types/dynamicpb"
 )
@@ -14,32 +14,56 @@ import (
 type MessageFactory func() (in protoreflect.Message, out protoreflect.Message)
 
 // NewMessageFactory returns the constructor for the Input/Output protobuf objects
-// by given proto descriptors.
+// by given proto descriptors, the messages are resolved from the registry.
 func NewMessageFactory(
+	registry *Registry,
 	protoDescr *descriptorpb.FileDescriptorProto,
 	methodDescr *descriptorpb.MethodDescriptorProto,
 ) (MessageFactory, error) {
-	fileDesc, err := protodesc.NewFile(protoDescr, protoregistry.GlobalFiles)
+	// prefer the registered file descriptor, the messages are required to share the same descriptor
+	// with the registry, otherwise the reflection-based consumers (e.g. CEL) can't access the message fields.
+	fileDesc, err := registry.FindFileByPath(protoDescr.GetName())
 	if err != nil {
-		return nil, fmt.Errorf("construct file descriptor: %w", err)
+		fileDesc, err = protodesc.NewFile(protoDescr, registry)
+		if err != nil {
+			return nil, fmt.Errorf("construct file descriptor: %w", err)
+		}
 	}
 
-	inputName := protoreflect.FullName(methodDescr.GetInputType())
-	outputName := protoreflect.FullName(methodDescr.GetOutputType())
+	inputName := protoreflect.FullName(strings.TrimPrefix(methodDescr.GetInputType(), "."))
+	outputName := protoreflect.FullName(strings.TrimPrefix(methodDescr.GetOutputType(), "."))
 
-	inputMessageDesc := fileDesc.Messages().ByName(inputName.Name())
-	outputMessageDesc := fileDesc.Messages().ByName(outputName.Name())
-
-	var inputMsgType protoreflect.MessageType
-	var outMsg protoreflect.Message
-	if inputMessageDesc != nil {
-		inputMsgType = dynamicpb.NewMessageType(inputMessageDesc)
+	inputMessageDesc, err := findMessage(registry, fileDesc, inputName)
+	if err != nil {
+		return nil, fmt.Errorf("find input message: %w", err)
 	}
-	if outputMessageDesc != nil {
-		outMsg = dynamicpb.NewMessage(outputMessageDesc)
+	outputMessageDesc, err := findMessage(registry, fileDesc, outputName)
+	if err != nil {
+		return nil, fmt.Errorf("find output message: %w", err)
 	}
 
+	inputMsgType := dynamicpb.NewMessageType(inputMessageDesc)
+	outputMsgType := dynamicpb.NewMessageType(outputMessageDesc)
+
 	return func() (in protoreflect.Message, out protoreflect.Message) {
-		return inputMsgType.New(), outMsg
+		return inputMsgType.New(), outputMsgType.New()
 	}, nil
 }
+
+// findMessage looks for the message in the file first, then in the imported files.
+func findMessage(registry *Registry, fileDesc protoreflect.FileDescriptor, name protoreflect.FullName) (protoreflect.MessageDescriptor, error) {
+	if md := fileDesc.Messages().ByName(name.Name()); md != nil && md.FullName() == name {
+		return md, nil
+	}
+
+	d, err := registry.FindDescriptorByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %w", name, err)
+	}
+	md, ok := d.(protoreflect.MessageDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a message", name)
+	}
+
+	return md, nil
+}
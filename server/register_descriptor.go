@@ -1,13 +1,14 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 
 	"google.golang.org/grpc"
-	"google.golang.org/protobuf/reflect/protodesc"
-	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/default23/protofake/mapper"
 )
 
 // MockServer is a placeholder for the gRPC service implementation.
@@ -20,7 +21,64 @@ type ServiceDesc struct {
 }
 
 // Register - registers provided gRPC services.
+// Use SetDescriptors to replace the registered services, when the server is running.
 func (s *Server) Register(descriptor *descriptorpb.FileDescriptorSet) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.register(s.state, descriptor)
+}
+
+// SetDescriptors replaces the registered services with the services of the provided descriptor sets.
+// The current mappings are validated against the new descriptors, if any of them is not applicable,
+// the error is returned and the server keeps serving the previous services.
+func (s *Server) SetDescriptors(descriptors []*descriptorpb.FileDescriptorSet) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	st := newDescriptorState()
+	for _, d := range descriptors {
+		if err := s.register(st, d); err != nil {
+			return err
+		}
+	}
+
+	// the mappings are bound to the descriptors on validation, so the copies are validated,
+	// the current mappings are kept untouched in case of the rollback.
+	var errs []error
+	origins := make(map[mapper.Origin][]*mapper.Mapping, len(s.origins))
+	bindings := make(map[*mapper.Mapping]*binding)
+	for _, origin := range s.precedence {
+		for _, m := range s.origins[origin] {
+			clone, err := m.Clone()
+			if err != nil {
+				errs = append(errs, mappingError(m, "", "%v", err))
+				continue
+			}
+
+			b, mappingErrs := s.bindMapping(st, clone)
+			if len(mappingErrs) > 0 {
+				errs = append(errs, mappingErrs...)
+				continue
+			}
+
+			origins[origin] = append(origins[origin], clone)
+			bindings[clone] = b
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d problem(s) found in the mappings with the new descriptors:\n%w", len(errs), errors.Join(errs...))
+	}
+
+	s.setMappings(st, origins, bindings)
+	return nil
+}
+
+// register registers the services of the descriptor set in the state.
+func (s *Server) register(st *descriptorState, descriptor *descriptorpb.FileDescriptorSet) error {
 	protos := make(map[string]*descriptorpb.FileDescriptorProto)
 	for _, fd := range descriptor.File {
 		protos[fd.GetName()] = fd
@@ -34,27 +92,22 @@ func (s *Server) Register(descriptor *descriptorpb.FileDescriptorSet) error {
 		}
 		alreadyProcessed[name] = struct{}{}
 
-		proto := protos[name]
+		proto, ok := protos[name]
+		if !ok {
+			if _, err := st.registry.FindFileByPath(name); err == nil || isWellKnownFile(name) {
+				return nil // registered by another descriptor set or the well-known types file
+			}
+
+			return fmt.Errorf("dependency %s is not found in the descriptor set, build it with the imports included", name)
+		}
 		for _, dep := range proto.Dependency {
 			if err := registerProtoFile(dep); err != nil {
 				return err
 			}
 		}
 
-		f, _ := protoregistry.GlobalFiles.FindFileByPath(proto.GetName())
-		if f != nil {
-			return nil // already registered
-		}
-
-		fd, err := protodesc.NewFile(proto, protoregistry.GlobalFiles)
-		if err != nil {
-			return fmt.Errorf("create %s descriptor file: %w", name, err)
-		}
-		if err = protoregistry.GlobalFiles.RegisterFile(fd); err != nil {
-			return fmt.Errorf("register %s descriptor file: %w", name, err)
-		}
-
-		return nil
+		_, err := st.registry.RegisterFile(proto)
+		return err
 	}
 	for name := range protos {
 		if err := registerProtoFile(name); err != nil {
@@ -68,43 +121,42 @@ func (s *Server) Register(descriptor *descriptorpb.FileDescriptorSet) error {
 		}
 
 		for _, service := range proto.GetService() {
-			sd, err := s.NewServiceDesc(proto, service)
-			if err != nil {
-				return fmt.Errorf("construct service '%s' desc: %w", service.GetName(), err)
-			}
-
-			if _, ok := s.services[sd.ServiceName]; ok {
+			serviceName := fmt.Sprintf("%s.%s", proto.GetPackage(), service.GetName())
+			if _, ok := st.services[serviceName]; ok {
 				if s.config.IgnoreDuplicateService {
-					slog.Warn("service already registered, ignore_duplicate_service option is ON, so it will be ignored and not handled", "name", sd.ServiceName)
+					slog.Warn("service already registered, ignore_duplicate_service option is ON, so it will be ignored and not handled", "name", serviceName)
 					continue
 				}
 
-				return fmt.Errorf("service %s already registered", sd.ServiceName)
+				return fmt.Errorf("service %s already registered", serviceName)
+			}
+
+			sd, err := s.newServiceDesc(st, proto, service)
+			if err != nil {
+				return fmt.Errorf("construct service '%s' desc: %w", service.GetName(), err)
 			}
 
-			s.services[sd.ServiceName] = &ServiceDesc{
+			st.services[sd.ServiceName] = &ServiceDesc{
 				Service:           sd,
 				ServiceDescriptor: service,
 				FileDescriptor:    proto,
 			}
 
 			var methodNames []string
-			for _, method := range service.GetMethod() {
-				methodNames = append(methodNames, fmt.Sprintf("%s/%s", sd.ServiceName, method.GetName()))
+			for _, method := range sd.Methods {
+				fullMethodName := fmt.Sprintf("/%s/%s", sd.ServiceName, method.MethodName)
+				st.handlers[fullMethodName] = method.Handler
+				methodNames = append(methodNames, fullMethodName)
 			}
 			slog.Debug("registered service", "full_name", sd.ServiceName, "package", proto.GetPackage(), "file", proto.GetName(), "methods", methodNames)
 		}
 	}
 
-	for _, service := range s.services {
-		s.grpcServer.RegisterService(service.Service, MockServer(s))
-	}
-
 	return nil
 }
 
-// NewServiceDesc constructs the gRPC service desc, is needed to handle incoming requests.
-func (s *Server) NewServiceDesc(protoDescriptor *descriptorpb.FileDescriptorProto, descr *descriptorpb.ServiceDescriptorProto) (*grpc.ServiceDesc, error) {
+// newServiceDesc constructs the gRPC service desc, is needed to handle incoming requests.
+func (s *Server) newServiceDesc(st *descriptorState, protoDescriptor *descriptorpb.FileDescriptorProto, descr *descriptorpb.ServiceDescriptorProto) (*grpc.ServiceDesc, error) {
 	out := &grpc.ServiceDesc{
 		ServiceName: fmt.Sprintf("%s.%s", protoDescriptor.GetPackage(), descr.GetName()),
 		HandlerType: (*MockServer)(nil),
@@ -112,7 +164,7 @@ func (s *Server) NewServiceDesc(protoDescriptor *descriptorpb.FileDescriptorProt
 	}
 
 	for _, method := range descr.GetMethod() {
-		handler, err := s.NewMockHandler(protoDescriptor, descr, method)
+		handler, err := s.newMockHandler(st, protoDescriptor, descr, method)
 		if err != nil {
 			return nil, fmt.Errorf("construct method '%s/%s' handler: %w", out.ServiceName, method.GetName(), err)
 		}
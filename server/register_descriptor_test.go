@@ -0,0 +1,99 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/default23/protofake/mapper"
+)
+
+func TestServer_SetDescriptors(t *testing.T) {
+	base := new(descriptorpb.FileDescriptorProto)
+	if err := prototext.Unmarshal([]byte(testProto), base); err != nil {
+		t.Fatalf("unmarshal test proto: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		// change modifies the copy of the test proto.
+		change  func(fdp *descriptorpb.FileDescriptorProto)
+		wantErr string
+		// wantGoodbye is the expected code of the SayGoodbye call after the reload, the method has no mappings.
+		wantGoodbye codes.Code
+	}{
+		{
+			name: "removed field of the mapping",
+			change: func(fdp *descriptorpb.FileDescriptorProto) {
+				sender := fdp.GetMessageType()[2]
+				sender.Field = sender.GetField()[:1] // the age is removed
+			},
+			wantErr:     `unknown field "age"`,
+			wantGoodbye: codes.FailedPrecondition,
+		},
+		{
+			name: "removed method of the mapping",
+			change: func(fdp *descriptorpb.FileDescriptorProto) {
+				fdp.GetService()[0].Method = fdp.GetService()[0].GetMethod()[1:]
+			},
+			wantErr:     "SayHello",
+			wantGoodbye: codes.FailedPrecondition,
+		},
+		{
+			name: "removed method without mappings",
+			change: func(fdp *descriptorpb.FileDescriptorProto) {
+				fdp.GetService()[0].Method = fdp.GetService()[0].GetMethod()[:1]
+			},
+			wantGoodbye: codes.Unimplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, testConfig())
+			conn := dialTestServer(t, s)
+
+			m := replyMapping("hello", sayHelloMethod, "hi")
+			m.Response.Body["sender"] = map[string]any{"age": 42}
+			if err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{m}); err != nil {
+				t.Fatalf("SetMappings() error = %v", err)
+			}
+
+			fdp := proto.Clone(base).(*descriptorpb.FileDescriptorProto)
+			tt.change(fdp)
+			err := s.SetDescriptors([]*descriptorpb.FileDescriptorSet{{File: []*descriptorpb.FileDescriptorProto{fdp}}})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("SetDescriptors() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("SetDescriptors() error = %v, want the error about %s", err, tt.wantErr)
+			}
+
+			// the mapped method answers with the previous or the new descriptors
+			reply, err := invoke(t, s, conn, sayHelloMethod, `{}`)
+			if err != nil {
+				t.Fatalf("SayHello call error = %v", err)
+			}
+			if reply["message"] != "hi" || reply["sender"] == nil {
+				t.Errorf("SayHello reply = %v", reply)
+			}
+			if tt.wantErr != "" {
+				if _, findErr := s.Registry().Files().FindDescriptorByName("protofake.test.Sender.age"); findErr != nil {
+					t.Errorf("the previous descriptors are not kept: %v", findErr)
+				}
+				if got := s.Mappings(); len(got) != 1 || got[0] != m {
+					t.Errorf("Mappings() = %v, want the previous mapping", got)
+				}
+			}
+
+			if _, err = invoke(t, s, conn, sayGoodbyeMethod, `{}`); status.Code(err) != tt.wantGoodbye {
+				t.Errorf("SayGoodbye call error = %v, want %s", err, tt.wantGoodbye)
+			}
+		})
+	}
+}
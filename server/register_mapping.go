@@ -1,45 +1,288 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
-	"reflect"
+	"maps"
+	"slices"
 	"strings"
 
-	"github.com/tidwall/gjson"
-	"google.golang.org/protobuf/encoding/protojson"
-	"google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/reflect/protoreflect"
-
 	"github.com/default23/protofake/mapper"
 )
 
-// SetMappings replaces the current mappings with the provided ones.
-func (s *Server) SetMappings(mappings []*mapper.Mapping) error {
-	endpointMappings := make(map[string][]*mapper.Mapping)
+// binding is the registered mapping, bound to the methods it is applied to.
+type binding struct {
+	// methods are the mappings, bound to the input and output messages of the registered methods,
+	// by the full method name. The pattern mapping is bound to each matched method by its own copy.
+	methods map[string]*mapper.Mapping
+	// raw is the mapping, applied to the calls of the methods without descriptors, nil if it is not applicable.
+	raw *mapper.Mapping
+}
+
+// SetMappings replaces the current mappings of the origin with the provided ones,
+// the mappings of the other origins are kept.
+// All the mappings are validated, the returned error contains the problems of all the invalid mappings.
+func (s *Server) SetMappings(origin mapper.Origin, mappings []*mapper.Mapping) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	st := s.currentState()
+	bindings, err := s.bindMappings(st, origin, mappings)
+	if err != nil {
+		return err
+	}
+
+	origins := maps.Clone(s.origins)
+	origins[origin] = mappings
+	s.setMappings(st, origins, mergeBindings(s.bindings, bindings))
+
+	return nil
+}
+
+// ReloadMappings replaces the current mappings of the origin per source file, e.g. on the changes of the mapping files,
+// so the invalid file does not block the others. The previously registered mappings are kept for the sources,
+// which contain any invalid mapping, and for the keepSources, e.g. the files failed to parse.
+// The mappings of the other sources are replaced, the returned error contains the problems of all the invalid mappings.
+func (s *Server) ReloadMappings(origin mapper.Origin, mappings []*mapper.Mapping, keepSources []string) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	st := s.currentState()
+	kept := make(map[string]struct{}, len(keepSources))
+	for _, source := range keepSources {
+		kept[source] = struct{}{}
+	}
+
+	var errs []error
+	bindings := make(map[*mapper.Mapping]*binding, len(mappings))
 	for _, m := range mappings {
-		if err := s.isMappingApplicable(m); err != nil {
-			return fmt.Errorf("the mapping (id=%s enpoint=%s) is invalid: %w", m.ID, m.Endpoint, err)
+		m.Origin = origin
+		b, mappingErrs := s.bindMapping(st, m)
+		if len(mappingErrs) > 0 {
+			errs = append(errs, mappingErrs...)
+			kept[m.Source] = struct{}{}
+			continue
 		}
 
-		endpointMappings[m.Endpoint] = append(endpointMappings[m.Endpoint], m)
+		bindings[m] = b
 	}
-	for k := range endpointMappings {
-		if len(endpointMappings[k]) == 0 {
-			delete(endpointMappings, k)
+
+	var reloaded []*mapper.Mapping
+	for _, m := range s.origins[origin] {
+		if _, ok := kept[m.Source]; ok {
+			reloaded = append(reloaded, m)
+		}
+	}
+	for _, m := range mappings {
+		if _, ok := kept[m.Source]; !ok {
+			reloaded = append(reloaded, m)
+		}
+	}
+
+	origins := maps.Clone(s.origins)
+	origins[origin] = reloaded
+	s.setMappings(st, origins, mergeBindings(s.bindings, bindings))
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d problem(s) found in the mappings, the previous mappings of their files are kept:\n%w", len(errs), errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// AddMappings registers the mappings of the origin, the mappings of the same origin with the same ids are replaced.
+// The mappings are registered only if all of them are valid.
+func (s *Server) AddMappings(origin mapper.Origin, mappings []*mapper.Mapping) error {
+	return s.AddMappingsWith(origin, mappings, nil)
+}
+
+// AddMappingsWith registers the mappings the same way as AddMappings, the save function is called with the valid
+// mappings right before they are registered, e.g. to persist them. If the save fails, the mappings are not registered
+// and its error is returned.
+func (s *Server) AddMappingsWith(origin mapper.Origin, mappings []*mapper.Mapping, save func([]*mapper.Mapping) error) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	st := s.currentState()
+	bindings, err := s.bindMappings(st, origin, mappings)
+	if err != nil {
+		return err
+	}
+	if save != nil {
+		if err = save(mappings); err != nil {
+			return err
+		}
+	}
+
+	registered := slices.DeleteFunc(slices.Clone(s.origins[origin]), func(existing *mapper.Mapping) bool {
+		return slices.ContainsFunc(mappings, func(m *mapper.Mapping) bool { return m.ID == existing.ID })
+	})
+
+	origins := maps.Clone(s.origins)
+	origins[origin] = append(registered, mappings...)
+	s.setMappings(st, origins, mergeBindings(s.bindings, bindings))
+
+	return nil
+}
+
+// bindMappings validates the mappings of the origin against the state and binds them to the methods,
+// the returned error contains the problems of all the invalid mappings.
+func (s *Server) bindMappings(st *descriptorState, origin mapper.Origin, mappings []*mapper.Mapping) (map[*mapper.Mapping]*binding, error) {
+	var errs []error
+	bindings := make(map[*mapper.Mapping]*binding, len(mappings))
+	for _, m := range mappings {
+		m.Origin = origin
+		b, mappingErrs := s.bindMapping(st, m)
+		if len(mappingErrs) > 0 {
+			errs = append(errs, mappingErrs...)
 			continue
 		}
 
+		bindings[m] = b
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%d problem(s) found in the mappings:\n%w", len(errs), errors.Join(errs...))
+	}
+
+	return bindings, nil
+}
+
+// mergeBindings returns the current bindings with the added ones.
+func mergeBindings(current, added map[*mapper.Mapping]*binding) map[*mapper.Mapping]*binding {
+	bindings := maps.Clone(current)
+	if bindings == nil {
+		bindings = make(map[*mapper.Mapping]*binding, len(added))
+	}
+	maps.Copy(bindings, added)
+
+	return bindings
+}
+
+// DeleteMapping removes the mapping of the origin by id, reports whether the mapping is found.
+func (s *Server) DeleteMapping(origin mapper.Origin, id string) bool {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	mappings := slices.DeleteFunc(slices.Clone(s.origins[origin]), func(m *mapper.Mapping) bool { return m.ID == id })
+	if len(mappings) == len(s.origins[origin]) {
+		return false
+	}
+
+	origins := maps.Clone(s.origins)
+	origins[origin] = mappings
+	s.setMappings(s.currentState(), origins, s.bindings)
+
+	return true
+}
+
+// Mappings returns all the registered mappings, the mappings of the most preferred origin first.
+func (s *Server) Mappings() []*mapper.Mapping {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var mappings []*mapper.Mapping
+	for _, origin := range s.precedence {
+		mappings = append(mappings, s.origins[origin]...)
+	}
+
+	return mappings
+}
+
+// setMappings replaces the mappings of all the origins and the descriptors state, the bindings of all the mappings
+// should be built against the state. Must be called with the reloadMu held.
+func (s *Server) setMappings(st *descriptorState, origins map[mapper.Origin][]*mapper.Mapping, bindings map[*mapper.Mapping]*binding) {
+	// the matching goes backwards, so the mappings of the most preferred origin are placed last.
+	endpointMappings := make(map[string][]*mapper.Mapping)
+	registered := make(map[*mapper.Mapping]*binding)
+	var rawMappings []*mapper.Mapping
+	for _, origin := range slices.Backward(s.precedence) {
+		for _, m := range origins[origin] {
+			b := bindings[m]
+			registered[m] = b
+			for _, method := range slices.Sorted(maps.Keys(b.methods)) {
+				endpointMappings[method] = append(endpointMappings[method], b.methods[method])
+			}
+			if b.raw != nil {
+				rawMappings = append(rawMappings, b.raw)
+			}
+		}
+	}
+	for k := range endpointMappings {
 		slog.Debug("registered endpoint mappings", "endpoint", k, "mappings_count", len(endpointMappings[k]))
 	}
 
-	s.mappings = endpointMappings
-	return nil
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state, s.origins, s.bindings = st, origins, registered
+	s.mappings, s.rawMappings = endpointMappings, rawMappings
 }
 
-func (s *Server) isMappingApplicable(m *mapper.Mapping) error {
+// parsePrecedence parses the order of the mapping origins, the most preferred first.
+// The origins, which are not listed, are the least preferred in the default order.
+func parsePrecedence(values []string) ([]mapper.Origin, error) {
+	var precedence []mapper.Origin
+	for _, v := range values {
+		origin := mapper.Origin(strings.ToLower(strings.TrimSpace(v)))
+		if origin == "" {
+			continue
+		}
+		if !slices.Contains(mapper.Origins, origin) {
+			return nil, fmt.Errorf("unknown mapping origin '%s', expected one of %v", v, mapper.Origins)
+		}
+		if slices.Contains(precedence, origin) {
+			return nil, fmt.Errorf("mapping origin '%s' is listed more than once", v)
+		}
+
+		precedence = append(precedence, origin)
+	}
+	for _, origin := range mapper.Origins {
+		if !slices.Contains(precedence, origin) {
+			precedence = append(precedence, origin)
+		}
+	}
+
+	return precedence, nil
+}
+
+// endpointMappings returns the mappings of the endpoint, the full method name is expected.
+func (s *Server) endpointMappings(fullMethodName string) []*mapper.Mapping {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.mappings[fullMethodName]
+}
+
+// unknownMethodMappings returns the mappings, applied to the method without descriptor.
+func (s *Server) unknownMethodMappings(fullMethodName string) []*mapper.Mapping {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var mappings []*mapper.Mapping
+	for _, m := range s.rawMappings {
+		if m.EndpointMatches(fullMethodName) {
+			mappings = append(mappings, m)
+		}
+	}
+
+	return mappings
+}
+
+// ValidateMapping checks the mapping is applicable to the registered endpoint, returns all the found problems.
+func (s *Server) ValidateMapping(m *mapper.Mapping) []error {
+	_, errs := s.bindMapping(s.currentState(), m)
+	return errs
+}
+
+// bindMapping checks the mapping is applicable to the endpoint, registered in the state,
+// and binds it to the method, returns all the found problems.
+func (s *Server) bindMapping(st *descriptorState, m *mapper.Mapping) (*binding, []error) {
 	if err := m.IsValid(); err != nil {
-		return fmt.Errorf("invalid mapping '%s': %w", m.Endpoint, err)
+		return nil, []error{mappingError(m, "", "%v", err)}
+	}
+	if m.IsPattern() {
+		return s.bindPattern(st, m)
 	}
 
 	endpoint := strings.Trim(m.Endpoint, "/")
@@ -49,9 +292,13 @@ func (s *Server) isMappingApplicable(m *mapper.Mapping) error {
 
 	fullMethodName := fmt.Sprintf("/%s/%s", serviceName, methodName)
 
-	serviceDesc, ok := s.services[serviceName]
+	serviceDesc, ok := st.services[serviceName]
 	if !ok {
-		return fmt.Errorf("endpoint '%s' provided in mapping are not registered", m.Endpoint)
+		if s.config.HandleUnknownServices {
+			return s.bindRaw(m)
+		}
+
+		return nil, []error{mappingError(m, "endpoint", "endpoint '%s' provided in mapping are not registered", m.Endpoint)}
 	}
 
 	var found bool
@@ -62,109 +309,101 @@ func (s *Server) isMappingApplicable(m *mapper.Mapping) error {
 		}
 	}
 	if !found {
-		return fmt.Errorf("method '%s' not implemented by service '%s'", methodName, serviceName)
+		if s.config.HandleUnknownServices {
+			return s.bindRaw(m)
+		}
+
+		return nil, []error{mappingError(m, "endpoint", "method '%s' not implemented by service '%s'", methodName, serviceName)}
 	}
 
-	mf, ok := s.messageFactory[fullMethodName]
+	mf, ok := st.messageFactory[fullMethodName]
 	if !ok {
-		return fmt.Errorf("internal server error: message could not be constructed for this endpoint '%s'", fullMethodName)
+		return nil, []error{mappingError(m, "endpoint", "internal server error: message could not be constructed for this endpoint '%s'", fullMethodName)}
 	}
 
 	in, out := mf()
-
-	inJSONBytes, err := marshalProtoMessage(in)
-	if err != nil {
-		return fmt.Errorf("internal error: processing input message for method %q: %w", fullMethodName, err)
+	if errs := m.Validate(in.Descriptor(), out.Descriptor(), st.registry.Types()); len(errs) > 0 {
+		return nil, errs
 	}
 
-	outJSONBytes, err := marshalProtoMessage(out)
-	if err != nil {
-		return fmt.Errorf("internal error: processing input message for method %q: %w", fullMethodName, err)
-	}
-
-	for valuePath, matcher := range m.RequestBody {
-		ej := gjson.GetBytes(inJSONBytes, valuePath)
-		if !ej.Exists() {
-			return fmt.Errorf("the json path %q is provided, but not exists in INPUT message", valuePath)
-		}
+	return &binding{methods: map[string]*mapper.Mapping{fullMethodName: m}}, nil
+}
 
-		// TODO: it may not be working on other rules
-		matcherValueType := reflect.TypeOf(matcher.Value)
-		messageValueType := reflect.TypeOf(ej.Value())
-		if matcherValueType != messageValueType {
-			return fmt.Errorf("the json path %q is provided, but the value type is not equal to the expected type, should be of type: %s, got: %s", valuePath, messageValueType, matcherValueType)
-		}
+// bindRaw binds the mapping to the method without descriptor.
+func (s *Server) bindRaw(m *mapper.Mapping) (*binding, []error) {
+	if errs := m.ValidateRaw(); len(errs) > 0 {
+		return nil, errs
 	}
 
-	for valuePath, value := range m.Response.Body {
-		j := gjson.GetBytes(outJSONBytes, valuePath)
-		if !j.Exists() {
-			return fmt.Errorf("the json path %q is provided, but not exists in OUTPUT message", valuePath)
-		}
+	return &binding{raw: m}, nil
+}
 
-		valueType := reflect.TypeOf(value)
-		if valueType.Kind() == reflect.String && strings.HasPrefix(value.(string), "$") {
-			// TODO check the given path ($req.body.some_name) exists in request body
+// bindPattern binds the copy of the pattern mapping to each matched method of the state, all the matched methods
+// should accept the mapping. If the unknown services are handled, the pattern is applied to the methods
+// without descriptors as well, if it is possible.
+func (s *Server) bindPattern(st *descriptorState, m *mapper.Mapping) (*binding, []error) {
+	b := &binding{methods: make(map[string]*mapper.Mapping)}
+	var errs []error
+	for _, method := range slices.Sorted(maps.Keys(st.messageFactory)) {
+		if !m.EndpointMatches(method) {
 			continue
 		}
 
-		messageValueType := reflect.TypeOf(j.Value())
-		if valueType != messageValueType {
-			return fmt.Errorf("the json path %q is provided, but the value type is not equal to the expected type, should be of type: %s, got: %s", valuePath, messageValueType, valueType)
+		clone, err := m.Clone()
+		if err != nil {
+			return nil, []error{mappingError(m, "", "%v", err)}
 		}
 
-		// TODO check for the value types of response and provided response mapper
-		// TODO response property could be a slice of objects, check this out
-	}
-
-	return nil
-}
-
-func marshalProtoMessage(pm interface {
-	Interface() protoreflect.ProtoMessage
-}) ([]byte, error) {
-	if pm == nil { // emptypb.Empty for example
-		return []byte("{}"), nil
+		in, out := st.messageFactory[method]()
+		for _, err = range clone.Validate(in.Descriptor(), out.Descriptor(), st.registry.Types()) {
+			errs = append(errs, matchedMethodError(err, method))
+		}
+		b.methods[method] = clone
 	}
 
-	message := proto.Clone(pm.Interface()) // to avoid modifying the original message
-	initDefaults(message.ProtoReflect())
+	if s.config.HandleUnknownServices {
+		clone, err := m.Clone()
+		if err != nil {
+			return nil, []error{mappingError(m, "", "%v", err)}
+		}
 
-	mo := protojson.MarshalOptions{
-		UseProtoNames:     true,
-		EmitUnpopulated:   true,
-		EmitDefaultValues: true,
+		rawErrs := clone.ValidateRaw()
+		switch {
+		case len(rawErrs) == 0:
+			b.raw = clone
+		case len(b.methods) == 0:
+			errs = append(errs, rawErrs...)
+		}
+	} else if len(b.methods) == 0 {
+		errs = append(errs, mappingError(m, "endpoint", "endpoint pattern '%s' matches none of the registered methods", m.Endpoint))
 	}
-	outBytes, err := mo.Marshal(message)
-	if err != nil {
-		return nil, fmt.Errorf("failed to verify output message (convert to json bytes): %w", err)
+	if len(errs) > 0 {
+		return nil, errs
 	}
 
-	return outBytes, nil
+	return b, nil
 }
 
-func initDefaults(m protoreflect.Message) {
-	md := m.Descriptor()
-	for i := 0; i < md.Fields().Len(); i++ {
-		fd := md.Fields().Get(i)
+// matchedMethodError adds the method, matched by the endpoint pattern, to the problem of the mapping.
+func matchedMethodError(err error, method string) error {
+	var verr *mapper.ValidationError
+	if !errors.As(err, &verr) {
+		return fmt.Errorf("method %s: %w", method, err)
+	}
 
-		// is for "optional" primitive fields, which are have nil by default.
-		if !m.Has(fd) {
-			newVal := m.NewField(fd)
-			m.Set(fd, newVal)
-		}
+	withMethod := *verr
+	withMethod.Message = fmt.Sprintf("%s (matched method %s)", verr.Message, method)
 
-		// is for message fields, which are have nil by default.
-		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
-			if !m.Has(fd) {
-				newMsg := m.NewField(fd)
-				m.Set(fd, newMsg)
+	return &withMethod
+}
 
-				initDefaults(newMsg.Message())
-			} else {
-				childMsg := m.Get(fd).Message()
-				initDefaults(childMsg)
-			}
-		}
+func mappingError(m *mapper.Mapping, path, format string, args ...any) error {
+	return &mapper.ValidationError{
+		MappingID: m.ID,
+		Endpoint:  m.Endpoint,
+		Source:    m.Source,
+		Position:  m.PositionOf(path),
+		Path:      path,
+		Message:   fmt.Sprintf(format, args...),
 	}
 }
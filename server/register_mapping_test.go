@@ -0,0 +1,271 @@
+package server
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/default23/protofake/mapper"
+)
+
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    []mapper.Origin
+		wantErr bool
+	}{
+		{"default order", nil, []mapper.Origin{mapper.OriginFile, mapper.OriginAPI, mapper.OriginRecording}, false},
+		{"all origins", []string{"api", "recording", "file"}, []mapper.Origin{mapper.OriginAPI, mapper.OriginRecording, mapper.OriginFile}, false},
+		{"unlisted origins are appended", []string{" File "}, []mapper.Origin{mapper.OriginFile, mapper.OriginAPI, mapper.OriginRecording}, false},
+		{"empty values are skipped", []string{"", "recording"}, []mapper.Origin{mapper.OriginRecording, mapper.OriginFile, mapper.OriginAPI}, false},
+		{"unknown origin", []string{"api", "cache"}, nil, true},
+		{"duplicated origin", []string{"api", "file", "API"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePrecedence(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePrecedence() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parsePrecedence() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	conf := testConfig()
+	conf.MappingsPrecedence = []string{"file", "file"}
+	if _, err := New(conf); err == nil {
+		t.Errorf("New() with the duplicated precedence origin, expected error")
+	}
+}
+
+func TestServer_Mappings__Origins(t *testing.T) {
+	tests := []struct {
+		name       string
+		precedence []string
+		wantIDs    []string
+		wantReply  string
+	}{
+		{"api preferred", []string{"api", "recording", "file"}, []string{"api", "recording", "file"}, "from api"},
+		{"file preferred", []string{"file", "api"}, []string{"file", "api", "recording"}, "from file"},
+		{"recording preferred", []string{"recording"}, []string{"recording", "file", "api"}, "from recording"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testConfig()
+			conf.MappingsPrecedence = tt.precedence
+			s := newTestServer(t, conf)
+
+			// the registration order does not matter, the precedence of the origins does
+			if err := s.AddMappings(mapper.OriginAPI, []*mapper.Mapping{replyMapping("api", sayHelloMethod, "from api")}); err != nil {
+				t.Fatalf("AddMappings() error = %v", err)
+			}
+			if err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{replyMapping("file", sayHelloMethod, "from file")}); err != nil {
+				t.Fatalf("SetMappings() error = %v", err)
+			}
+			if err := s.AddMappings(mapper.OriginRecording, []*mapper.Mapping{replyMapping("recording", sayHelloMethod, "from recording")}); err != nil {
+				t.Fatalf("AddMappings() error = %v", err)
+			}
+
+			var ids []string
+			for _, m := range s.Mappings() {
+				if string(m.Origin) != m.ID {
+					t.Errorf("mapping %s has origin %s", m.ID, m.Origin)
+				}
+				ids = append(ids, m.ID)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("Mappings() ids = %v, want %v", ids, tt.wantIDs)
+			}
+
+			reply, err := invoke(t, s, dialTestServer(t, s), sayHelloMethod, `{}`)
+			if err != nil {
+				t.Fatalf("call error = %v", err)
+			}
+			if reply["message"] != tt.wantReply {
+				t.Errorf("reply message = %v, want %v", reply["message"], tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestServer_AddMappings__ReplacesSameID(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	conn := dialTestServer(t, s)
+
+	if err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{replyMapping("hello", sayHelloMethod, "from file")}); err != nil {
+		t.Fatalf("SetMappings() error = %v", err)
+	}
+	for _, message := range []string{"first", "second"} {
+		if err := s.AddMappings(mapper.OriginAPI, []*mapper.Mapping{replyMapping("hello", sayHelloMethod, message)}); err != nil {
+			t.Fatalf("AddMappings() error = %v", err)
+		}
+	}
+
+	// the mapping of the same origin is replaced, the file mapping with the same id is kept
+	mappings := s.Mappings()
+	if len(mappings) != 2 || mappings[0].Origin != mapper.OriginAPI || mappings[1].Origin != mapper.OriginFile {
+		t.Fatalf("Mappings() = %v, want the api and the file mappings", mappings)
+	}
+	if got := mappings[0].Response.Body["message"]; got != "second" {
+		t.Errorf("api mapping message = %v, want second", got)
+	}
+
+	reply, err := invoke(t, s, conn, sayHelloMethod, `{}`)
+	if err != nil {
+		t.Fatalf("call error = %v", err)
+	}
+	if reply["message"] != "second" {
+		t.Errorf("reply message = %v, want second", reply["message"])
+	}
+
+	// the invalid mapping is not registered, the replaced one is kept
+	invalid := replyMapping("hello", "/protofake.test.Greeter/Unknown", "third")
+	if err = s.AddMappings(mapper.OriginAPI, []*mapper.Mapping{invalid}); err == nil {
+		t.Fatalf("AddMappings() with the unknown endpoint, expected error")
+	}
+	if reply, err = invoke(t, s, conn, sayHelloMethod, `{}`); err != nil || reply["message"] != "second" {
+		t.Errorf("reply message = %v, error = %v, want second", reply["message"], err)
+	}
+
+	// the mappings are not registered, if they are not saved
+	saveErr := errors.New("disk is full")
+	err = s.AddMappingsWith(mapper.OriginAPI, []*mapper.Mapping{replyMapping("hello", sayHelloMethod, "unsaved")}, func([]*mapper.Mapping) error {
+		return saveErr
+	})
+	if !errors.Is(err, saveErr) {
+		t.Fatalf("AddMappingsWith() error = %v, want %v", err, saveErr)
+	}
+	if reply, err = invoke(t, s, conn, sayHelloMethod, `{}`); err != nil || reply["message"] != "second" {
+		t.Errorf("reply message = %v, error = %v, want second", reply["message"], err)
+	}
+}
+
+func TestServer_SetMappings__KeepsOtherOrigins(t *testing.T) {
+	conf := testConfig()
+	conf.MappingsPrecedence = []string{"file", "api"}
+	s := newTestServer(t, conf)
+	conn := dialTestServer(t, s)
+
+	if err := s.AddMappings(mapper.OriginAPI, []*mapper.Mapping{
+		replyMapping("hello", sayHelloMethod, "hello from api"),
+		replyMapping("goodbye", sayGoodbyeMethod, "goodbye from api"),
+	}); err != nil {
+		t.Fatalf("AddMappings() error = %v", err)
+	}
+	if err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{replyMapping("hello", sayHelloMethod, "hello from file")}); err != nil {
+		t.Fatalf("SetMappings() error = %v", err)
+	}
+
+	// the reload of the mapping files replaces the file mappings only
+	if err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{replyMapping("file-goodbye", sayGoodbyeMethod, "goodbye from file")}); err != nil {
+		t.Fatalf("SetMappings() error = %v", err)
+	}
+
+	var ids []string
+	for _, m := range s.Mappings() {
+		ids = append(ids, string(m.Origin)+":"+m.ID)
+	}
+	if want := []string{"file:file-goodbye", "api:hello", "api:goodbye"}; !slices.Equal(ids, want) {
+		t.Errorf("Mappings() = %v, want %v", ids, want)
+	}
+
+	calls := []struct {
+		method string
+		want   string
+	}{
+		{sayHelloMethod, "hello from api"},
+		{sayGoodbyeMethod, "goodbye from file"},
+	}
+	for _, c := range calls {
+		reply, err := invoke(t, s, conn, c.method, `{}`)
+		if err != nil {
+			t.Fatalf("call %s error = %v", c.method, err)
+		}
+		if reply["message"] != c.want {
+			t.Errorf("call %s reply message = %v, want %v", c.method, reply["message"], c.want)
+		}
+	}
+
+	// the failed reload keeps the previous file mappings
+	if err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{replyMapping("broken", "/protofake.test.Greeter/Unknown", "")}); err == nil {
+		t.Fatalf("SetMappings() with the unknown endpoint, expected error")
+	}
+	if got := len(s.Mappings()); got != 3 {
+		t.Errorf("Mappings() count after the failed reload = %d, want 3", got)
+	}
+}
+
+func TestServer_ReloadMappings(t *testing.T) {
+	s := newTestServer(t, testConfig())
+	conn := dialTestServer(t, s)
+
+	sourceMapping := func(id, source, endpoint, message string) *mapper.Mapping {
+		m := replyMapping(id, endpoint, message)
+		m.Source = source
+		return m
+	}
+	if err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{
+		sourceMapping("hello", "hello.json", sayHelloMethod, "hello v1"),
+		sourceMapping("goodbye", "goodbye.json", sayGoodbyeMethod, "goodbye v1"),
+		sourceMapping("removed", "removed.json", sayGoodbyeMethod, "removed"),
+	}); err != nil {
+		t.Fatalf("SetMappings() error = %v", err)
+	}
+
+	// the hello.json is fixed, the goodbye.json gets the invalid mapping, the removed.json is deleted
+	err := s.ReloadMappings(mapper.OriginFile, []*mapper.Mapping{
+		sourceMapping("hello", "hello.json", sayHelloMethod, "hello v2"),
+		sourceMapping("goodbye", "goodbye.json", sayGoodbyeMethod, "goodbye v2"),
+		sourceMapping("broken", "goodbye.json", "/protofake.test.Greeter/Unknown", ""),
+		sourceMapping("added", "added.json", sayGoodbyeMethod, "added"),
+	}, []string{"unparsed.json"})
+	if err == nil || !strings.Contains(err.Error(), "id=broken") {
+		t.Fatalf("ReloadMappings() error = %v, want the problem of the broken mapping", err)
+	}
+
+	var ids []string
+	for _, m := range s.Mappings() {
+		ids = append(ids, m.Source+":"+m.ID)
+	}
+	if want := []string{"goodbye.json:goodbye", "hello.json:hello", "added.json:added"}; !slices.Equal(ids, want) {
+		t.Errorf("Mappings() = %v, want %v", ids, want)
+	}
+
+	calls := []struct {
+		method string
+		want   string
+	}{
+		{sayHelloMethod, "hello v2"},
+		{sayGoodbyeMethod, "added"}, // the latest registered mapping wins
+	}
+	for _, c := range calls {
+		reply, callErr := invoke(t, s, conn, c.method, `{}`)
+		if callErr != nil {
+			t.Fatalf("call %s error = %v", c.method, callErr)
+		}
+		if reply["message"] != c.want {
+			t.Errorf("call %s reply message = %v, want %v", c.method, reply["message"], c.want)
+		}
+	}
+
+	// the file, failed to parse, keeps its previous mappings
+	if err = s.ReloadMappings(mapper.OriginFile, nil, []string{"hello.json"}); err != nil {
+		t.Fatalf("ReloadMappings() error = %v", err)
+	}
+	ids = ids[:0]
+	for _, m := range s.Mappings() {
+		ids = append(ids, m.Source+":"+m.ID)
+	}
+	if want := []string{"hello.json:hello"}; !slices.Equal(ids, want) {
+		t.Errorf("Mappings() = %v, want %v", ids, want)
+	}
+	if m := s.Mappings()[0]; m.Response.Body["message"] != "hello v2" {
+		t.Errorf("kept mapping reply = %v, want the previous one", m.Response.Body["message"])
+	}
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// wellKnownTypesPrefix is the path prefix of the well-known types files,
+// which are resolved from the protoregistry.GlobalFiles, if they are not provided by the descriptor set.
+const wellKnownTypesPrefix = "google/protobuf/"
+
+// Registry is the isolated set of the descriptors, registered by the Server.
+// It is not shared with the protoregistry.GlobalFiles, so the descriptors don't conflict with the generated code
+// of the process and with each other.
+type Registry struct {
+	files *protoregistry.Files
+	types *dynamicpb.Types
+}
+
+// NewRegistry creates the empty registry.
+func NewRegistry() *Registry {
+	files := new(protoregistry.Files)
+
+	return &Registry{
+		files: files,
+		types: dynamicpb.NewTypes(files),
+	}
+}
+
+// Files returns the registered file descriptors.
+func (r *Registry) Files() *protoregistry.Files {
+	return r.files
+}
+
+// Types returns the resolver of the message, enum and extension types of the registered files,
+// it is used to resolve the google.protobuf.Any messages.
+func (r *Registry) Types() *dynamicpb.Types {
+	return r.types
+}
+
+// FindFileByPath implements the protodesc.Resolver.
+func (r *Registry) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	return r.files.FindFileByPath(path)
+}
+
+// FindDescriptorByName implements the protodesc.Resolver.
+func (r *Registry) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	return r.files.FindDescriptorByName(name)
+}
+
+// RegisterFile registers the file, all its dependencies should be registered already,
+// except the well-known types files, which are registered from the protoregistry.GlobalFiles if missing.
+// The file, registered with the same path, is kept if the contents are equal, otherwise the error is returned.
+func (r *Registry) RegisterFile(fdp *descriptorpb.FileDescriptorProto) (protoreflect.FileDescriptor, error) {
+	if existing, err := r.files.FindFileByPath(fdp.GetName()); err == nil {
+		if strings.HasPrefix(fdp.GetName(), wellKnownTypesPrefix) || r.sameFile(existing, fdp) {
+			return existing, nil
+		}
+
+		return nil, fmt.Errorf("file %s is already registered with the different content", fdp.GetName())
+	}
+
+	for _, dep := range fdp.GetDependency() {
+		if err := r.registerWellKnownFile(dep); err != nil {
+			return nil, err
+		}
+	}
+
+	fd, err := protodesc.NewFile(fdp, r)
+	if err != nil {
+		return nil, fmt.Errorf("create %s descriptor file: %w", fdp.GetName(), err)
+	}
+	if err = r.files.RegisterFile(fd); err != nil {
+		return nil, fmt.Errorf("register %s descriptor file: %w", fdp.GetName(), err)
+	}
+
+	return fd, nil
+}
+
+// registerWellKnownFile registers the well-known types file with its imports, if it is not registered yet.
+func (r *Registry) registerWellKnownFile(path string) error {
+	if !isWellKnownFile(path) {
+		return nil
+	}
+	if _, err := r.files.FindFileByPath(path); err == nil {
+		return nil
+	}
+
+	fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+	if err != nil {
+		return fmt.Errorf("find well-known types file %s: %w", path, err)
+	}
+	imports := fd.Imports()
+	for i := range imports.Len() {
+		if err = r.registerWellKnownFile(imports.Get(i).Path()); err != nil {
+			return err
+		}
+	}
+	if err = r.files.RegisterFile(fd); err != nil {
+		return fmt.Errorf("register well-known types file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// isWellKnownFile reports whether the file is one of the well-known types files, available in the binary.
+func isWellKnownFile(path string) bool {
+	if !strings.HasPrefix(path, wellKnownTypesPrefix) {
+		return false
+	}
+	_, err := protoregistry.GlobalFiles.FindFileByPath(path)
+
+	return err == nil
+}
+
+// RangeExtensionsByMessage implements the reflection.ExtensionResolver.
+func (r *Registry) RangeExtensionsByMessage(message protoreflect.FullName, f func(protoreflect.ExtensionType) bool) {
+	var rangeExtensions func(xds protoreflect.ExtensionDescriptors, mds protoreflect.MessageDescriptors) bool
+	rangeExtensions = func(xds protoreflect.ExtensionDescriptors, mds protoreflect.MessageDescriptors) bool {
+		for i := range xds.Len() {
+			xd := xds.Get(i)
+			if xd.ContainingMessage().FullName() == message && !f(dynamicpb.NewExtensionType(xd)) {
+				return false
+			}
+		}
+		for i := range mds.Len() {
+			if !rangeExtensions(mds.Get(i).Extensions(), mds.Get(i).Messages()) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	r.files.RangeFiles(func(fd protoreflect.FileDescriptor) bool {
+		return rangeExtensions(fd.Extensions(), fd.Messages())
+	})
+}
+
+// FindExtensionByName implements the reflection.ExtensionResolver.
+func (r *Registry) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return r.types.FindExtensionByName(field)
+}
+
+// FindExtensionByNumber implements the reflection.ExtensionResolver.
+func (r *Registry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return r.types.FindExtensionByNumber(message, field)
+}
+
+// sameFile reports whether the registered file has the same content, the source code info is ignored.
+// Both files are compared in the normalized form, produced by protodesc.ToFileDescriptorProto.
+func (r *Registry) sameFile(fd protoreflect.FileDescriptor, fdp *descriptorpb.FileDescriptorProto) bool {
+	registered := protodesc.ToFileDescriptorProto(fd)
+	registered.SourceCodeInfo = nil
+
+	other := proto.Clone(fdp).(*descriptorpb.FileDescriptorProto)
+	other.SourceCodeInfo = nil
+	if ofd, err := protodesc.NewFile(other, r); err == nil {
+		other = protodesc.ToFileDescriptorProto(ofd)
+	}
+
+	return proto.Equal(registered, other)
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+
+	"github.com/default23/protofake/mapper"
+)
+
+// isolationProto is the file, registered by the servers in the different versions,
+// the version is the name of the Detail field.
+const isolationProto = `
+name: "isolation_test.proto"
+package: "protofake.isolation"
+syntax: "proto3"
+dependency: "google/protobuf/any.proto"
+message_type {
+  name: "Detail"
+  field { name: "%[1]s" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "%[1]s" }
+}
+message_type {
+  name: "Reply"
+  field { name: "detail" number: 1 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".google.protobuf.Any" json_name: "detail" }
+}
+service {
+  name: "Isolated"
+  method { name: "Get" input_type: ".protofake.isolation.Detail" output_type: ".protofake.isolation.Reply" }
+}
+`
+
+const isolatedGetMethod = "/protofake.isolation.Isolated/Get"
+
+func TestRegistry__Isolation(t *testing.T) {
+	versions := []string{"first", "second"}
+	servers := make([]*Server, len(versions))
+	for i, field := range versions {
+		s, err := New(testConfig())
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+
+		fdp := new(descriptorpb.FileDescriptorProto)
+		if err = prototext.Unmarshal([]byte(fmt.Sprintf(isolationProto, field)), fdp); err != nil {
+			t.Fatalf("unmarshal isolation proto: %v", err)
+		}
+		// the same path is registered by each server with the different content
+		if err = s.Register(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fdp}}); err != nil {
+			t.Fatalf("Register(%s) error = %v", field, err)
+		}
+		servers[i] = s
+	}
+
+	if _, err := protoregistry.GlobalFiles.FindFileByPath("isolation_test.proto"); err == nil {
+		t.Fatalf("isolation_test.proto is registered in the global registry")
+	}
+
+	for i, s := range servers {
+		field, other := versions[i], versions[1-i]
+
+		// the Any value is resolved with the types of the server, the field of the other version is unknown
+		otherMapping := detailMapping("other", other)
+		if err := s.AddMappings(mapper.OriginAPI, []*mapper.Mapping{otherMapping}); err == nil {
+			t.Errorf("server %s: AddMappings() with the field %s of the other version, expected error", field, other)
+		}
+		if err := s.AddMappings(mapper.OriginAPI, []*mapper.Mapping{detailMapping("own", field)}); err != nil {
+			t.Fatalf("server %s: AddMappings() error = %v", field, err)
+		}
+
+		types := s.Registry().Types()
+		inType, err := types.FindMessageByName("protofake.isolation.Detail")
+		if err != nil {
+			t.Fatalf("server %s: find Detail: %v", field, err)
+		}
+		outType, err := types.FindMessageByName("protofake.isolation.Reply")
+		if err != nil {
+			t.Fatalf("server %s: find Reply: %v", field, err)
+		}
+		if fd := inType.Descriptor().Fields().Get(0); string(fd.Name()) != field {
+			t.Errorf("server %s: Detail field = %s", field, fd.Name())
+		}
+
+		in, out := inType.New().Interface(), outType.New().Interface()
+		if err = dialTestServer(t, s).Invoke(context.Background(), isolatedGetMethod, in, out); err != nil {
+			t.Fatalf("server %s: call error = %v", field, err)
+		}
+
+		// the reply is the dynamic message, the detail is converted to the generated Any
+		content, err := proto.Marshal(out.ProtoReflect().Get(outType.Descriptor().Fields().ByName("detail")).Message().Interface())
+		if err != nil {
+			t.Fatalf("server %s: marshal detail: %v", field, err)
+		}
+		detail := new(anypb.Any)
+		if err = proto.Unmarshal(content, detail); err != nil {
+			t.Fatalf("server %s: unmarshal detail: %v", field, err)
+		}
+		got, err := detail.UnmarshalNew()
+		if err == nil {
+			t.Errorf("server %s: detail %v is resolved with the global registry", field, got)
+		}
+		detailMsg := inType.New().Interface()
+		if err = detail.UnmarshalTo(detailMsg); err != nil {
+			t.Fatalf("server %s: unmarshal detail: %v", field, err)
+		}
+		if value := detailMsg.ProtoReflect().Get(inType.Descriptor().Fields().Get(0)).String(); value != field+" value" {
+			t.Errorf("server %s: detail %s = %q", field, field, value)
+		}
+	}
+}
+
+// detailMapping returns the mapping, which replies with the Detail message, packed into Any, the field is set.
+func detailMapping(id, field string) *mapper.Mapping {
+	return &mapper.Mapping{
+		ID:       id,
+		Endpoint: isolatedGetMethod,
+		Response: mapper.Response{Body: map[string]any{
+			"detail": map[string]any{
+				"@type": "type.googleapis.com/protofake.isolation.Detail",
+				field:   field + " value",
+			},
+		}},
+	}
+}
+
+func TestRegistry_RegisterFile__SamePath(t *testing.T) {
+	r := NewRegistry()
+	for _, field := range []string{"first", "first", "second"} {
+		fdp := new(descriptorpb.FileDescriptorProto)
+		if err := prototext.Unmarshal([]byte(fmt.Sprintf(isolationProto, field)), fdp); err != nil {
+			t.Fatalf("unmarshal isolation proto: %v", err)
+		}
+
+		_, err := r.RegisterFile(fdp)
+		// the same content is kept, the other version of the path conflicts within the registry
+		if wantErr := field == "second"; (err != nil) != wantErr {
+			t.Errorf("RegisterFile(%s) error = %v, wantErr %v", field, err, wantErr)
+		}
+	}
+}
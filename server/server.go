@@ -1,13 +1,22 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"net/http"
+	"strings"
+	"sync"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 
 	"github.com/default23/protofake/config"
 	"github.com/default23/protofake/mapper"
@@ -18,37 +27,85 @@ type Server struct {
 	config     config.GRPC
 	grpcServer *grpc.Server
 	listener   net.Listener
-	services   map[string]*ServiceDesc
+	// webServer serves the mocks over the gRPC-Web and the Connect protocols.
+	webServer *http.Server
+	// tlsConfig is the TLS configuration of the listeners, nil if the TLS is not configured.
+	tlsConfig *tls.Config
 
-	// mappings is a map of mappings for each service.
+	// reloadMu serializes the replacement of the descriptors and the mappings.
+	reloadMu sync.Mutex
+	// mu guards the state and the mappings, which are read by the handlers.
+	mu    sync.RWMutex
+	state *descriptorState
+	// origins are the registered mappings by origin, in the registration order.
+	origins map[mapper.Origin][]*mapper.Mapping
+	// bindings are the methods, the registered mappings are applied to.
+	bindings map[*mapper.Mapping]*binding
+	// precedence is the order of the mapping origins, the most preferred first.
+	precedence []mapper.Origin
+	// mappings is a map of mappings for each service, ordered by the origins precedence.
 	// The key is the full method name (e.g., "/package.Service/Method").
 	mappings map[string][]*mapper.Mapping
-	// messageFactory is a map of message factories for each service.
-	// The key is the full method name (e.g., "/package.Service/Method").
-	messageFactory map[string]MessageFactory
+	// rawMappings are the mappings of the methods without descriptors, ordered by the origins precedence.
+	rawMappings []*mapper.Mapping
+	// fallbackCode is returned, when none of the mappings matches the request.
+	fallbackCode codes.Code
+	// unknownCalls is the journal of the calls of the methods, which are not found in the descriptors.
+	unknownCalls *callJournal
 }
 
 // New - creates a new gRPC mocking server.
+// The port is not bound until Run is called, so the server could be used to validate the mappings only.
 func New(conf config.GRPC) (*Server, error) {
-	srv := grpc.NewServer()
-
-	listener, err := net.Listen("tcp", net.JoinHostPort(conf.Host, conf.Port))
+	precedence, err := parsePrecedence(conf.MappingsPrecedence)
 	if err != nil {
-		return nil, fmt.Errorf("construct gRPC server: listen %s:%s: %w", conf.Host, conf.Port, err)
+		return nil, fmt.Errorf("parse mappings precedence: %w", err)
+	}
+
+	fallbackCode, ok := mapper.StrToCode[strings.ToUpper(conf.FallbackCode)]
+	if !ok {
+		return nil, fmt.Errorf("unknown fallback status code '%s'", conf.FallbackCode)
+	}
+
+	s := &Server{
+		config:       conf,
+		state:        newDescriptorState(),
+		origins:      make(map[mapper.Origin][]*mapper.Mapping),
+		precedence:   precedence,
+		fallbackCode: fallbackCode,
+		unknownCalls: &callJournal{size: conf.UnknownCallsJournalSize},
 	}
+	if s.tlsConfig, err = newTLSConfig(conf.TLS); err != nil {
+		return nil, fmt.Errorf("configure TLS: %w", err)
+	}
+
+	opts := []grpc.ServerOption{grpc.UnknownServiceHandler(s.dispatch)}
+	if s.tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsConfig)))
+	}
+	s.grpcServer = grpc.NewServer(opts...)
+	s.webServer = s.newWebServer()
+
+	return s, nil
+}
 
-	return &Server{
-		config:         conf,
-		grpcServer:     srv,
-		listener:       listener,
-		services:       make(map[string]*ServiceDesc),
-		messageFactory: make(map[string]MessageFactory),
-	}, nil
+// Registry returns the descriptors, registered by the server.
+func (s *Server) Registry() *Registry {
+	return s.currentState().registry
 }
 
-// Close - gracefully shuts down the gRPC server.
+// Close - gracefully shuts down the gRPC server and the gRPC-Web listener.
 func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), webShutdownTimeout)
+	defer cancel()
+	if err := s.webServer.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown gRPC-Web server: %w", err)
+	}
+
 	s.grpcServer.GracefulStop()
+	if s.listener == nil {
+		return nil
+	}
 	if err := s.listener.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 		return fmt.Errorf("close listener: %w", err)
 	}
@@ -57,14 +114,34 @@ func (s *Server) Close() error {
 }
 
 // Run - starts the gRPC server.
-func (s *Server) Run() {
-	slog.Info("starting gRPC server at " + s.config.Host + ":" + s.config.Port)
+func (s *Server) Run() error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.config.Host, s.config.Port))
+	if err != nil {
+		return fmt.Errorf("listen %s:%s: %w", s.config.Host, s.config.Port, err)
+	}
+	s.listener = listener
+
+	slog.Info("starting gRPC server at "+s.config.Host+":"+s.config.Port, "tls", s.config.TLS.Enabled(), "client_ca", s.config.TLS.ClientCAFile)
 	go func() {
 		if s.config.ServerReflection {
-			reflection.Register(s.grpcServer)
+			opts := reflection.ServerOptions{
+				Services:           s,
+				DescriptorResolver: currentRegistry{s: s},
+				ExtensionResolver:  currentRegistry{s: s},
+			}
+			reflectionv1.RegisterServerReflectionServer(s.grpcServer, reflection.NewServerV1(opts))
+			reflectionv1alpha.RegisterServerReflectionServer(s.grpcServer, reflection.NewServer(opts))
 		}
 		if err := s.grpcServer.Serve(s.listener); err != nil {
 			slog.Error("failed to start gRPC server", "error", err)
 		}
 	}()
+
+	if s.config.Web.Enabled {
+		if err = s.runWeb(); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/default23/protofake/config"
+	"github.com/default23/protofake/mapper"
+)
+
+const testProto = `
+name: "greeter_test.proto"
+package: "protofake.test"
+syntax: "proto3"
+message_type {
+  name: "HelloRequest"
+  field { name: "name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "name" }
+  field { name: "count" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 json_name: "count" }
+}
+message_type {
+  name: "HelloReply"
+  field { name: "message" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "message" }
+  field { name: "count" number: 2 label: LABEL_OPTIONAL type: TYPE_INT64 json_name: "count" }
+  field { name: "ok" number: 3 label: LABEL_OPTIONAL type: TYPE_BOOL json_name: "ok" }
+  field { name: "sender" number: 4 label: LABEL_OPTIONAL type: TYPE_MESSAGE type_name: ".protofake.test.Sender" json_name: "sender" }
+}
+message_type {
+  name: "Sender"
+  field { name: "display_name" number: 1 label: LABEL_OPTIONAL type: TYPE_STRING json_name: "displayName" }
+  field { name: "age" number: 2 label: LABEL_OPTIONAL type: TYPE_INT32 json_name: "age" }
+}
+service {
+  name: "Greeter"
+  method { name: "SayHello" input_type: ".protofake.test.HelloRequest" output_type: ".protofake.test.HelloReply" }
+  method { name: "SayGoodbye" input_type: ".protofake.test.HelloRequest" output_type: ".protofake.test.HelloReply" }
+}
+`
+
+const (
+	sayHelloMethod   = "/protofake.test.Greeter/SayHello"
+	sayGoodbyeMethod = "/protofake.test.Greeter/SayGoodbye"
+)
+
+// testConfig returns the default configuration of the server.
+func testConfig() config.GRPC {
+	return config.GRPC{
+		MappingsPrecedence:      []string{"api", "recording", "file"},
+		FallbackCode:            "FAILED_PRECONDITION",
+		UnknownCallsJournalSize: 100,
+		Web:                     config.Web{AllowedOrigins: []string{"*"}},
+	}
+}
+
+// newTestServer constructs the server with the test service registered.
+func newTestServer(t *testing.T, conf config.GRPC) *Server {
+	t.Helper()
+
+	s, err := New(conf)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	fdp := new(descriptorpb.FileDescriptorProto)
+	if err = prototext.Unmarshal([]byte(testProto), fdp); err != nil {
+		t.Fatalf("unmarshal test proto: %v", err)
+	}
+	if err = s.Register(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fdp}}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	return s
+}
+
+// dialTestServer serves the server on the in-memory listener and returns the client connection to it.
+func dialTestServer(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	go func() { _ = s.grpcServer.Serve(listener) }()
+	t.Cleanup(s.grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("dial test server: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+// newTestMessage returns the empty dynamic message of the test proto by the short name.
+func newTestMessage(t *testing.T, s *Server, name string) proto.Message {
+	t.Helper()
+
+	mt, err := s.Registry().Types().FindMessageByName(protoreflect.FullName("protofake.test." + name))
+	if err != nil {
+		t.Fatalf("find message %s: %v", name, err)
+	}
+
+	return mt.New().Interface()
+}
+
+// invoke calls the method of the test service with the JSON request, returns the JSON representation of the response.
+func invoke(t *testing.T, s *Server, conn *grpc.ClientConn, method, request string) (map[string]any, error) {
+	t.Helper()
+
+	in, out := newTestMessage(t, s, "HelloRequest"), newTestMessage(t, s, "HelloReply")
+	if err := protojson.Unmarshal([]byte(request), in); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+	if err := conn.Invoke(context.Background(), method, in, out); err != nil {
+		return nil, err
+	}
+
+	content, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(out)
+	if err != nil {
+		t.Fatalf("marshal response: %v", err)
+	}
+	reply := make(map[string]any)
+	if err = json.Unmarshal(content, &reply); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+
+	return reply, nil
+}
+
+// replyMapping returns the mapping of the method, which responds with the message.
+func replyMapping(id, endpoint, message string) *mapper.Mapping {
+	return &mapper.Mapping{
+		ID:       id,
+		Endpoint: endpoint,
+		Response: mapper.Response{Body: map[string]any{"message": message}},
+	}
+}
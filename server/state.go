@@ -0,0 +1,117 @@
+package server
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// descriptorState is the set of the registered descriptors and the services, constructed from them.
+// It is replaced as a whole, when the descriptors are reloaded at runtime.
+type descriptorState struct {
+	// registry keeps the registered descriptors, it is isolated from the protoregistry.GlobalFiles.
+	registry *Registry
+	services map[string]*ServiceDesc
+	// handlers is a map of the method handlers.
+	// The key is the full method name (e.g., "/package.Service/Method").
+	handlers map[string]grpc.MethodHandler
+	// messageFactory is a map of message factories for each service.
+	// The key is the full method name (e.g., "/package.Service/Method").
+	messageFactory map[string]MessageFactory
+}
+
+func newDescriptorState() *descriptorState {
+	return &descriptorState{
+		registry:       NewRegistry(),
+		services:       make(map[string]*ServiceDesc),
+		handlers:       make(map[string]grpc.MethodHandler),
+		messageFactory: make(map[string]MessageFactory),
+	}
+}
+
+// currentState returns the descriptors state, which handles the incoming calls.
+func (s *Server) currentState() *descriptorState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+// dispatch is the gRPC unknown service handler, which handles the calls of the registered services.
+// The method handler is resolved on each call, so the services could be added, replaced or removed at runtime,
+// without the re-registration on the gRPC server, which is not supported after it is started.
+func (s *Server) dispatch(srv any, stream grpc.ServerStream) error {
+	method, ok := grpc.MethodFromServerStream(stream)
+	if !ok {
+		return status.Error(codes.Internal, "failed to resolve the method of the call")
+	}
+
+	s.mu.RLock()
+	handler, ok := s.state.handlers[method]
+	s.mu.RUnlock()
+	if !ok {
+		if s.config.HandleUnknownServices {
+			return s.handleUnknownCall(method, stream)
+		}
+
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+
+	resp, err := handler(srv, stream.Context(), stream.RecvMsg, nil)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendMsg(resp)
+}
+
+// GetServiceInfo implements the reflection.ServiceInfoProvider.
+// Returns the services, registered on the gRPC server (e.g. the reflection) and the mocked services.
+func (s *Server) GetServiceInfo() map[string]grpc.ServiceInfo {
+	info := s.grpcServer.GetServiceInfo()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for name, service := range s.state.services {
+		methods := make([]grpc.MethodInfo, 0, len(service.ServiceDescriptor.GetMethod()))
+		for _, method := range service.ServiceDescriptor.GetMethod() {
+			methods = append(methods, grpc.MethodInfo{
+				Name:           method.GetName(),
+				IsClientStream: method.GetClientStreaming(),
+				IsServerStream: method.GetServerStreaming(),
+			})
+		}
+
+		info[name] = grpc.ServiceInfo{Methods: methods, Metadata: service.FileDescriptor.GetName()}
+	}
+
+	return info
+}
+
+// currentRegistry resolves the descriptors and the extensions from the registry of the current state,
+// it is used by the reflection service, which outlives the descriptors reloads.
+type currentRegistry struct {
+	s *Server
+}
+
+func (r currentRegistry) FindFileByPath(path string) (protoreflect.FileDescriptor, error) {
+	return r.s.Registry().FindFileByPath(path)
+}
+
+func (r currentRegistry) FindDescriptorByName(name protoreflect.FullName) (protoreflect.Descriptor, error) {
+	return r.s.Registry().FindDescriptorByName(name)
+}
+
+func (r currentRegistry) FindExtensionByName(field protoreflect.FullName) (protoreflect.ExtensionType, error) {
+	return r.s.Registry().FindExtensionByName(field)
+}
+
+func (r currentRegistry) FindExtensionByNumber(message protoreflect.FullName, field protoreflect.FieldNumber) (protoreflect.ExtensionType, error) {
+	return r.s.Registry().FindExtensionByNumber(message, field)
+}
+
+func (r currentRegistry) RangeExtensionsByMessage(message protoreflect.FullName, f func(protoreflect.ExtensionType) bool) {
+	r.s.Registry().RangeExtensionsByMessage(message, f)
+}
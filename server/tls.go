@@ -0,0 +1,199 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/default23/protofake/config"
+)
+
+const (
+	// generatedCAFile is the name of the generated CA certificate, the clients should trust.
+	generatedCAFile = "ca.pem"
+	// generatedCAKeyFile is the name of the generated CA key, it is kept to reuse the CA on the next start.
+	generatedCAKeyFile = "ca-key.pem"
+
+	generatedCAValidity     = 10 * 365 * 24 * time.Hour
+	generatedServerValidity = 365 * 24 * time.Hour
+)
+
+// newTLSConfig constructs the TLS configuration of the server listeners, nil is returned if the TLS is not configured.
+// The server certificate is loaded from the files or generated, the client certificates are verified
+// with the client CA, if it is configured.
+func newTLSConfig(conf config.TLS) (*tls.Config, error) {
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+	if !conf.Enabled() {
+		return nil, nil
+	}
+
+	var (
+		cert tls.Certificate
+		err  error
+	)
+	if conf.CertFile != "" {
+		if cert, err = tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile); err != nil {
+			return nil, fmt.Errorf("load server certificate: %w", err)
+		}
+	} else {
+		if cert, err = generateCertificate(conf.GenerateDir, conf.GenerateHosts); err != nil {
+			return nil, fmt.Errorf("generate server certificate: %w", err)
+		}
+	}
+
+	tlsConf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if conf.ClientCAFile != "" {
+		content, readErr := os.ReadFile(conf.ClientCAFile)
+		if readErr != nil {
+			return nil, fmt.Errorf("read client CA: %w", readErr)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", conf.ClientCAFile)
+		}
+		tlsConf.ClientCAs = pool
+
+		switch strings.ToLower(conf.ClientAuth) {
+		case "", "required":
+			tlsConf.ClientAuth = tls.RequireAndVerifyClientCert
+		case "optional":
+			tlsConf.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			return nil, fmt.Errorf("unknown client auth '%s', expected 'required' or 'optional'", conf.ClientAuth)
+		}
+	}
+
+	return tlsConf, nil
+}
+
+// generateCertificate issues the server certificate for the hosts, signed by the CA from the dir.
+// The CA is generated and written to the dir, if it is missing, so the clients could trust it.
+func generateCertificate(dir string, hosts []string) (tls.Certificate, error) {
+	ca, caKey, err := loadOrGenerateCA(dir)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("generate server key: %w", err)
+	}
+
+	template, err := certificateTemplate("protofake", generatedServerValidity)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("create server certificate: %w", err)
+	}
+
+	slog.Info("generated TLS server certificate, the clients should trust the CA", "ca_file", filepath.Join(dir, generatedCAFile), "hosts", hosts)
+	return tls.Certificate{Certificate: [][]byte{der, ca.Raw}, PrivateKey: key}, nil
+}
+
+// loadOrGenerateCA loads the CA from the dir, the new CA is generated and written, if it is missing.
+func loadOrGenerateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPath, keyPath := filepath.Join(dir, generatedCAFile), filepath.Join(dir, generatedCAKeyFile)
+
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	switch {
+	case err == nil:
+		key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("unsupported key type %T of the CA %s", pair.PrivateKey, keyPath)
+		}
+		ca, parseErr := x509.ParseCertificate(pair.Certificate[0])
+		if parseErr != nil {
+			return nil, nil, fmt.Errorf("parse CA %s: %w", certPath, parseErr)
+		}
+
+		return ca, key, nil
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, nil, fmt.Errorf("load CA: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate CA key: %w", err)
+	}
+
+	template, err := certificateTemplate("protofake CA", generatedCAValidity)
+	if err != nil {
+		return nil, nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create CA certificate: %w", err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse CA certificate: %w", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal CA key: %w", err)
+	}
+	if err = os.MkdirAll(dir, 0o755); err != nil {
+		return nil, nil, fmt.Errorf("create CA directory: %w", err)
+	}
+	if err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return nil, nil, fmt.Errorf("write CA key: %w", err)
+	}
+	if err = os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil { //nolint:gosec
+		return nil, nil, fmt.Errorf("write CA certificate: %w", err)
+	}
+
+	slog.Info("generated TLS CA", "ca_file", certPath)
+	return ca, key, nil
+}
+
+func certificateTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("generate certificate serial number: %w", err)
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"protofake"}},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(validity),
+	}, nil
+}
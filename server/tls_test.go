@@ -0,0 +1,209 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/default23/protofake/config"
+)
+
+func TestLoadOrGenerateCA(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+
+	if _, err := generateCertificate(dir, []string{"localhost"}); err != nil {
+		t.Fatalf("generateCertificate() error = %v", err)
+	}
+	for _, name := range []string{generatedCAFile, generatedCAKeyFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Fatalf("generated CA file %s: %v", name, err)
+		}
+	}
+
+	ca, key, err := loadOrGenerateCA(dir)
+	if err != nil {
+		t.Fatalf("loadOrGenerateCA() error = %v", err)
+	}
+	if !ca.IsCA {
+		t.Errorf("loaded certificate is not a CA")
+	}
+
+	// the CA is reused on the next start
+	again, againKey, err := loadOrGenerateCA(dir)
+	if err != nil {
+		t.Fatalf("loadOrGenerateCA() error = %v", err)
+	}
+	if !bytes.Equal(ca.Raw, again.Raw) || !key.Equal(againKey) {
+		t.Errorf("loadOrGenerateCA() generated the new CA, want the written one")
+	}
+
+	cert, err := generateCertificate(dir, []string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("generateCertificate() error = %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("parse server certificate: %v", err)
+	}
+	if err = leaf.CheckSignatureFrom(ca); err != nil {
+		t.Errorf("server certificate is not signed by the CA: %v", err)
+	}
+	if err = leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("server certificate hosts: %v", err)
+	}
+}
+
+func TestNewTLSConfig__MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey, err := loadOrGenerateCA(dir)
+	if err != nil {
+		t.Fatalf("loadOrGenerateCA() error = %v", err)
+	}
+	caFile := filepath.Join(dir, generatedCAFile)
+
+	serverConf, err := newTLSConfig(config.TLS{
+		Generate:      true,
+		GenerateHosts: []string{"localhost"},
+		GenerateDir:   dir,
+		ClientCAFile:  caFile,
+		ClientAuth:    "required",
+	})
+	if err != nil {
+		t.Fatalf("newTLSConfig() error = %v", err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	otherCA, otherKey, err := loadOrGenerateCA(t.TempDir())
+	if err != nil {
+		t.Fatalf("loadOrGenerateCA() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		certs   []tls.Certificate
+		wantErr bool
+	}{
+		{"client certificate signed by the CA", []tls.Certificate{clientCertificate(t, ca, caKey)}, false},
+		{"no client certificate", nil, true},
+		{"client certificate signed by the unknown CA", []tls.Certificate{clientCertificate(t, otherCA, otherKey)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverErr, clientErr := handshake(t, serverConf, &tls.Config{
+				RootCAs:      roots,
+				ServerName:   "localhost",
+				Certificates: tt.certs,
+				MinVersion:   tls.VersionTLS12,
+			})
+			if tt.wantErr {
+				if serverErr == nil {
+					t.Errorf("server handshake succeeded, expected the client to be rejected")
+				}
+				return
+			}
+			if serverErr != nil || clientErr != nil {
+				t.Errorf("handshake error: server = %v, client = %v", serverErr, clientErr)
+			}
+		})
+	}
+}
+
+func TestNewTLSConfig__ClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, err := loadOrGenerateCA(dir); err != nil {
+		t.Fatalf("loadOrGenerateCA() error = %v", err)
+	}
+
+	tests := []struct {
+		clientAuth string
+		want       tls.ClientAuthType
+		wantErr    bool
+	}{
+		{"required", tls.RequireAndVerifyClientCert, false},
+		{"Optional", tls.VerifyClientCertIfGiven, false},
+		{"sometimes", 0, true},
+		{"", tls.RequireAndVerifyClientCert, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.clientAuth, func(t *testing.T) {
+			conf, err := newTLSConfig(config.TLS{
+				Generate:     true,
+				GenerateDir:  dir,
+				ClientCAFile: filepath.Join(dir, generatedCAFile),
+				ClientAuth:   tt.clientAuth,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newTLSConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && conf.ClientAuth != tt.want {
+				t.Errorf("newTLSConfig() client auth = %v, want %v", conf.ClientAuth, tt.want)
+			}
+		})
+	}
+}
+
+// clientCertificate issues the client certificate, signed by the CA.
+func clientCertificate(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate client key: %v", err)
+	}
+	template, err := certificateTemplate("client", time.Hour)
+	if err != nil {
+		t.Fatalf("client certificate template: %v", err)
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create client certificate: %v", err)
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake runs the TLS handshake over the loopback connection, returns the errors of the both sides.
+func handshake(t *testing.T, serverConf, clientConf *tls.Config) (serverErr, clientErr error) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer lis.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		conn, acceptErr := lis.Accept()
+		if acceptErr != nil {
+			done <- acceptErr
+			return
+		}
+		defer conn.Close()
+		done <- tls.Server(conn, serverConf).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), clientConf)
+	if err == nil {
+		// the TLS 1.3 client completes the handshake before the server verifies the client certificate
+		_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _ = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+
+	return <-done, err
+}
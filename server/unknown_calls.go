@@ -0,0 +1,116 @@
+package server
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/default23/protofake/mapper"
+)
+
+// UnknownCall is the call of the method, which is not found in the registered descriptors.
+type UnknownCall struct {
+	Time     time.Time   `json:"time"`
+	Method   string      `json:"method"`
+	Metadata metadata.MD `json:"metadata"`
+	Peer     string      `json:"peer,omitempty"`
+	// Payload is the raw protobuf request message, base64-encoded in JSON.
+	Payload []byte `json:"payload"`
+	// MappingID is the mapping, the call is answered with, empty if none of the mappings matched.
+	MappingID string `json:"mapping_id,omitempty"`
+}
+
+// callJournal keeps the last unknown calls, the oldest calls are dropped, when the size is exceeded.
+type callJournal struct {
+	mu    sync.Mutex
+	size  int
+	calls []UnknownCall
+}
+
+func (j *callJournal) add(call UnknownCall) {
+	if j.size <= 0 {
+		return
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if len(j.calls) >= j.size {
+		j.calls = slices.Delete(j.calls, 0, len(j.calls)-j.size+1)
+	}
+	j.calls = append(j.calls, call)
+}
+
+// UnknownCalls returns the journaled calls of the unknown methods, the oldest first.
+func (s *Server) UnknownCalls() []UnknownCall {
+	s.unknownCalls.mu.Lock()
+	defer s.unknownCalls.mu.Unlock()
+
+	return slices.Clone(s.unknownCalls.calls)
+}
+
+// ClearUnknownCalls removes all the journaled calls of the unknown methods.
+func (s *Server) ClearUnknownCalls() {
+	s.unknownCalls.mu.Lock()
+	defer s.unknownCalls.mu.Unlock()
+
+	s.unknownCalls.calls = nil
+}
+
+// handleUnknownCall handles the call of the method, which is not found in the registered descriptors.
+// The request can't be decoded without descriptor, so it is received as the raw payload (the unknown fields of
+// the empty message) and matched by the metadata only. The matched mapping responds with the fixed status
+// or the raw payload.
+func (s *Server) handleUnknownCall(method string, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		md = metadata.MD{}
+	}
+
+	in := new(emptypb.Empty)
+	if err := stream.RecvMsg(in); err != nil {
+		return status.Errorf(codes.InvalidArgument, "failed to decode input message: %v", err)
+	}
+
+	call := UnknownCall{
+		Time:     time.Now(),
+		Method:   method,
+		Metadata: md,
+		Payload:  in.ProtoReflect().GetUnknown(),
+	}
+	req := &mapper.Request{Metadata: md, Body: map[string]any{}}
+	req.Peer, _ = peer.FromContext(ctx)
+	if req.Peer != nil && req.Peer.Addr != nil {
+		call.Peer = req.Peer.Addr.String()
+	}
+
+	mapping := matchMapping(s.unknownMethodMappings(method), req)
+	if mapping != nil {
+		call.MappingID = mapping.ID
+	}
+	s.unknownCalls.add(call)
+
+	logger := slog.With("method", method, "metadata", md, "payload_size", len(call.Payload), "peer", call.Peer)
+	if mapping == nil {
+		logger.Warn("call of the unknown method, no matching mapping found")
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+
+	logger.Warn("call of the unknown method, responding with mapping", "mapping_id", mapping.ID)
+	if err := responseStatus(mapping.Response); err != nil {
+		return err
+	}
+
+	out := new(emptypb.Empty)
+	out.ProtoReflect().SetUnknown(mapping.Response.Payload)
+	return stream.SendMsg(out)
+}
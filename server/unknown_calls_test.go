@@ -0,0 +1,123 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/default23/protofake/mapper"
+)
+
+func TestCallJournal_Add(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		calls int
+		want  []string
+	}{
+		{"below capacity", 3, 2, []string{"/m0", "/m1"}},
+		{"at capacity", 3, 3, []string{"/m0", "/m1", "/m2"}},
+		{"oldest are evicted", 3, 5, []string{"/m2", "/m3", "/m4"}},
+		{"single call", 1, 3, []string{"/m2"}},
+		{"disabled", 0, 3, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Server{unknownCalls: &callJournal{size: tt.size}}
+			for i := range tt.calls {
+				s.unknownCalls.add(UnknownCall{Method: "/m" + strconv.Itoa(i)})
+			}
+
+			var got []string
+			for _, call := range s.UnknownCalls() {
+				got = append(got, call.Method)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("UnknownCalls() = %v, want %v", got, tt.want)
+			}
+
+			s.ClearUnknownCalls()
+			if calls := s.UnknownCalls(); len(calls) != 0 {
+				t.Errorf("UnknownCalls() after clear = %v, want none", calls)
+			}
+		})
+	}
+}
+
+func TestServer_HandleUnknownCall(t *testing.T) {
+	const method = "/acme.legacy.v1.LegacyService/Ping"
+
+	conf := testConfig()
+	conf.HandleUnknownServices = true
+	s := newTestServer(t, conf)
+	conn := dialTestServer(t, s)
+
+	payload, err := proto.Marshal(wrapperspb.String("pong"))
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	err = s.SetMappings(mapper.OriginFile, []*mapper.Mapping{
+		{
+			ID:       "pong",
+			Endpoint: method,
+			Metadata: map[string]mapper.ValueMatcher{"x-scenario": {Rule: mapper.MatchingRuleEqual, Value: "pong"}},
+			Response: mapper.Response{Payload: payload},
+		},
+		{
+			ID:       "denied",
+			Endpoint: method,
+			Metadata: map[string]mapper.ValueMatcher{"x-scenario": {Rule: mapper.MatchingRuleEqual, Value: "denied"}},
+			Response: mapper.Response{Code: "PERMISSION_DENIED"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetMappings() error = %v", err)
+	}
+
+	call := func(scenario string) (*wrapperspb.StringValue, error) {
+		ctx := metadata.AppendToOutgoingContext(context.Background(), "x-scenario", scenario)
+		out := new(wrapperspb.StringValue)
+		return out, conn.Invoke(ctx, method, wrapperspb.String("ping"), out)
+	}
+
+	out, err := call("pong")
+	if err != nil {
+		t.Fatalf("call error = %v", err)
+	}
+	if out.GetValue() != "pong" {
+		t.Errorf("response = %q, want the raw payload of the mapping", out.GetValue())
+	}
+
+	_, err = call("denied")
+	if st := status.Convert(err); st.Code() != codes.PermissionDenied || st.Message() != defaultErrorMessage {
+		t.Errorf("call error = %v, want %s with the default message", err, codes.PermissionDenied)
+	}
+
+	_, err = call("unknown")
+	if st := status.Convert(err); st.Code() != codes.Unimplemented {
+		t.Errorf("call error = %v, want %s", err, codes.Unimplemented)
+	}
+
+	request, err := proto.Marshal(wrapperspb.String("ping"))
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+	calls := s.UnknownCalls()
+	if len(calls) != 3 {
+		t.Fatalf("UnknownCalls() count = %d, want 3", len(calls))
+	}
+	for i, wantID := range []string{"pong", "denied", ""} {
+		if calls[i].Method != method || calls[i].MappingID != wantID || !bytes.Equal(calls[i].Payload, request) {
+			t.Errorf("UnknownCalls()[%d] = %+v, want the call of %s answered by mapping %q", i, calls[i], method, wantID)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// maxWebMessageSize limits the size of the gRPC-Web and Connect request, the same as the gRPC default.
+	maxWebMessageSize = 4 << 20
+	// webShutdownTimeout is the time to complete the pending HTTP requests on Close.
+	webShutdownTimeout = 5 * time.Second
+)
+
+// webExposedHeaders are the response headers, which are readable by the browser clients.
+var webExposedHeaders = []string{"Grpc-Status", "Grpc-Message", "Grpc-Status-Details-Bin"}
+
+// newWebServer constructs the HTTP server, which serves the mocks over the gRPC-Web and the Connect protocols.
+// The HTTP/2 without TLS is accepted as well, so the Connect clients could use the h2c.
+func (s *Server) newWebServer() *http.Server {
+	protocols := new(http.Protocols)
+	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	srv := &http.Server{
+		Handler:           http.HandlerFunc(s.handleWeb),
+		ReadHeaderTimeout: 10 * time.Second,
+		Protocols:         protocols,
+	}
+	if s.tlsConfig != nil {
+		srv.TLSConfig = s.tlsConfig.Clone()
+	}
+
+	return srv
+}
+
+// runWeb starts the gRPC-Web and Connect listener.
+func (s *Server) runWeb() error {
+	conf := s.config.Web
+	listener, err := net.Listen("tcp", net.JoinHostPort(conf.Host, conf.Port))
+	if err != nil {
+		return fmt.Errorf("listen %s:%s: %w", conf.Host, conf.Port, err)
+	}
+
+	slog.Info("starting gRPC-Web and Connect server at "+conf.Host+":"+conf.Port, "tls", s.tlsConfig != nil)
+	go func() {
+		var serveErr error
+		if s.tlsConfig != nil {
+			serveErr = s.webServer.ServeTLS(listener, "", "")
+		} else {
+			serveErr = s.webServer.Serve(listener)
+		}
+		if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+			slog.Error("failed to start gRPC-Web and Connect server", "error", serveErr)
+		}
+	}()
+
+	return nil
+}
+
+// handleWeb handles the unary call over the gRPC-Web or the Connect protocol. The call is dispatched
+// to the same method handlers as the native gRPC call, with the HTTP headers as the incoming metadata.
+func (s *Server) handleWeb(w http.ResponseWriter, r *http.Request) {
+	if !s.allowWebOrigin(w, r) {
+		http.Error(w, "origin is not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", r.Header.Get("Access-Control-Request-Headers"))
+		w.Header().Set("Access-Control-Max-Age", "7200")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		http.Error(w, "method is not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	protocol, ok := s.webProtocolOf(r)
+	if !ok {
+		http.Error(w, "unsupported content type "+r.Header.Get("Content-Type"), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebMessageSize))
+	if err != nil {
+		protocol.writeResponse(w, nil, status.Errorf(codes.ResourceExhausted, "failed to read request: %v", err))
+		return
+	}
+	payload, err := protocol.decodeRequest(body)
+	if err != nil {
+		protocol.writeResponse(w, nil, status.Errorf(codes.InvalidArgument, "failed to decode request: %v", err))
+		return
+	}
+
+	ctx := metadata.NewIncomingContext(r.Context(), webMetadata(r.Header))
+	ctx = peer.NewContext(ctx, webPeer(r))
+	stream := &webStream{ctx: ctx, codec: protocol.codec(), payload: payload, header: metadata.MD{}, trailer: metadata.MD{}}
+	stream.ctx = grpc.NewContextWithServerTransportStream(ctx, &webTransportStream{method: r.URL.Path, stream: stream})
+
+	slog.Debug("handling gRPC-Web or Connect call", "method", r.URL.Path, "content_type", r.Header.Get("Content-Type"))
+	err = s.dispatch(nil, stream)
+	if err == nil && !stream.sent {
+		err = status.Error(codes.Internal, "no response message is sent")
+	}
+
+	protocol.writeResponse(w, stream, err)
+}
+
+// allowWebOrigin sets the CORS headers of the browser call, reports whether the origin of the call is allowed.
+// The calls without the Origin header are always allowed. Any origin is allowed by the "*" without the credentials,
+// the credentials are allowed for the listed origins only.
+func (s *Server) allowWebOrigin(w http.ResponseWriter, r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	switch {
+	case slices.Contains(s.config.Web.AllowedOrigins, "*"):
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+	case slices.Contains(s.config.Web.AllowedOrigins, origin):
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Add("Vary", "Origin")
+	default:
+		return false
+	}
+	w.Header().Set("Access-Control-Expose-Headers", strings.Join(webExposedHeaders, ", "))
+
+	return true
+}
+
+// webProtocolOf returns the protocol of the call by the content type.
+func (s *Server) webProtocolOf(r *http.Request) (webProtocol, bool) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, false
+	}
+
+	switch contentType {
+	case "application/grpc-web", "application/grpc-web+proto":
+		return grpcWebProtocol{}, true
+	case "application/grpc-web-text", "application/grpc-web-text+proto":
+		return grpcWebProtocol{text: true}, true
+	case "application/proto":
+		return connectProtocol{contentType: contentType, messageCodec: protoCodec{}}, true
+	case "application/json":
+		return connectProtocol{contentType: contentType, messageCodec: jsonCodec{resolver: s.Registry().Types()}}, true
+	default:
+		return nil, false
+	}
+}
+
+// webMetadata converts the HTTP headers into the incoming metadata, the binary headers are base64-decoded.
+func webMetadata(h http.Header) metadata.MD {
+	md := make(metadata.MD, len(h))
+	for k, values := range h {
+		key := strings.ToLower(k)
+		if !strings.HasSuffix(key, "-bin") {
+			md.Append(key, values...)
+			continue
+		}
+
+		for _, v := range values {
+			decoded, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(v, "="))
+			if err != nil {
+				continue
+			}
+			md.Append(key, string(decoded))
+		}
+	}
+
+	return md
+}
+
+// webPeer returns the client of the HTTP call, the client certificate is available, if the TLS is used.
+func webPeer(r *http.Request) *peer.Peer {
+	p := new(peer.Peer)
+	if addr, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		p.Addr = net.TCPAddrFromAddrPort(addr)
+	}
+	if r.TLS != nil {
+		p.AuthInfo = credentials.TLSInfo{
+			State:          *r.TLS,
+			CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+		}
+	}
+
+	return p
+}
+
+// webStream is the grpc.ServerStream of the unary HTTP call, it receives the request payload
+// and keeps the response message with the metadata, sent by the handler.
+type webStream struct {
+	ctx     context.Context
+	codec   webCodec
+	payload []byte
+	// received is true, when the request message is received by the handler.
+	received bool
+
+	header  metadata.MD
+	trailer metadata.MD
+	// out is the encoded response message, it is set, if sent is true.
+	out  []byte
+	sent bool
+}
+
+func (s *webStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *webStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *webStream) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *webStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *webStream) SendMsg(m any) error {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected response message type %T", m)
+	}
+	if s.sent {
+		return status.Error(codes.Internal, "the response message is already sent")
+	}
+
+	out, err := s.codec.marshal(msg)
+	if err != nil {
+		return status.Errorf(codes.Internal, "failed to encode response message: %v", err)
+	}
+	s.out, s.sent = out, true
+
+	return nil
+}
+
+func (s *webStream) RecvMsg(m any) error {
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return status.Errorf(codes.Internal, "unexpected request message type %T", m)
+	}
+	if s.received {
+		return io.EOF
+	}
+	s.received = true
+
+	return s.codec.unmarshal(s.payload, msg)
+}
+
+// webTransportStream is the grpc.ServerTransportStream of the HTTP call,
+// which provides the called method and the response metadata to the handler.
+type webTransportStream struct {
+	method string
+	stream *webStream
+}
+
+func (t *webTransportStream) Method() string {
+	return t.method
+}
+
+func (t *webTransportStream) SetHeader(md metadata.MD) error {
+	return t.stream.SetHeader(md)
+}
+
+func (t *webTransportStream) SendHeader(md metadata.MD) error {
+	return t.stream.SendHeader(md)
+}
+
+func (t *webTransportStream) SetTrailer(md metadata.MD) error {
+	t.stream.SetTrailer(md)
+	return nil
+}
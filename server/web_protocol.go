@@ -0,0 +1,305 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+const (
+	// grpcWebFrameHeaderSize is the size of the gRPC-Web frame header: the flags byte and the payload length.
+	grpcWebFrameHeaderSize = 5
+	// grpcWebCompressedFlag marks the frame with the compressed payload.
+	grpcWebCompressedFlag = 0x01
+	// grpcWebTrailerFlag marks the frame with the trailers.
+	grpcWebTrailerFlag = 0x80
+)
+
+// webProtocol is the HTTP protocol of the unary call, it decodes the request payload and writes the response.
+type webProtocol interface {
+	// codec returns the encoding of the messages.
+	codec() webCodec
+	// decodeRequest returns the encoded request message from the request body.
+	decodeRequest(body []byte) ([]byte, error)
+	// writeResponse writes the response message or the error of the call, the stream is nil, if the call is not handled.
+	writeResponse(w http.ResponseWriter, stream *webStream, err error)
+}
+
+// webCodec is the encoding of the request and response messages.
+type webCodec interface {
+	marshal(msg proto.Message) ([]byte, error)
+	unmarshal(data []byte, msg proto.Message) error
+}
+
+type protoCodec struct{}
+
+func (protoCodec) marshal(msg proto.Message) ([]byte, error) {
+	return proto.Marshal(msg)
+}
+
+func (protoCodec) unmarshal(data []byte, msg proto.Message) error {
+	return proto.Unmarshal(data, msg)
+}
+
+// jsonCodec is the protobuf JSON encoding, the google.protobuf.Any values are resolved with the resolver.
+type jsonCodec struct {
+	resolver interface {
+		protoregistry.MessageTypeResolver
+		protoregistry.ExtensionTypeResolver
+	}
+}
+
+func (c jsonCodec) marshal(msg proto.Message) ([]byte, error) {
+	return protojson.MarshalOptions{Resolver: c.resolver}.Marshal(msg)
+}
+
+func (c jsonCodec) unmarshal(data []byte, msg proto.Message) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	return protojson.UnmarshalOptions{Resolver: c.resolver}.Unmarshal(data, msg)
+}
+
+// grpcWebProtocol is the gRPC-Web protocol with the binary protobuf messages, the text mode is base64-encoded.
+// The request and the response are the length-prefixed frames, the status is sent in the trailers frame.
+type grpcWebProtocol struct {
+	text bool
+}
+
+func (p grpcWebProtocol) codec() webCodec {
+	return protoCodec{}
+}
+
+func (p grpcWebProtocol) decodeRequest(body []byte) ([]byte, error) {
+	if p.text {
+		decoded, err := decodeBase64Chunks(body)
+		if err != nil {
+			return nil, fmt.Errorf("decode base64 body: %w", err)
+		}
+		body = decoded
+	}
+
+	for len(body) > 0 {
+		if len(body) < grpcWebFrameHeaderSize {
+			return nil, errors.New("truncated frame header")
+		}
+
+		flags := body[0]
+		size := binary.BigEndian.Uint32(body[1:grpcWebFrameHeaderSize])
+		if uint64(len(body)-grpcWebFrameHeaderSize) < uint64(size) {
+			return nil, errors.New("truncated frame payload")
+		}
+		payload := body[grpcWebFrameHeaderSize : grpcWebFrameHeaderSize+int(size)]
+		body = body[grpcWebFrameHeaderSize+int(size):]
+
+		switch {
+		case flags&grpcWebTrailerFlag != 0:
+			continue
+		case flags&grpcWebCompressedFlag != 0:
+			return nil, errors.New("compressed messages are not supported")
+		default:
+			return payload, nil
+		}
+	}
+
+	return nil, errors.New("request message is not found")
+}
+
+func (p grpcWebProtocol) writeResponse(w http.ResponseWriter, stream *webStream, err error) {
+	contentType := "application/grpc-web+proto"
+	if p.text {
+		contentType = "application/grpc-web-text+proto"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	var body bytes.Buffer
+	trailer := metadata.MD{}
+	if stream != nil {
+		setMetadataHeaders(w.Header(), "", stream.header)
+		if err == nil {
+			writeGRPCWebFrame(&body, 0, stream.out)
+		}
+		trailer = stream.trailer.Copy()
+	}
+
+	st := status.Convert(err)
+	trailer.Set("grpc-status", strconv.Itoa(int(st.Code())))
+	if st.Message() != "" {
+		trailer.Set("grpc-message", encodeGRPCMessage(st.Message()))
+	}
+	if len(st.Proto().GetDetails()) > 0 {
+		if details, marshalErr := proto.Marshal(st.Proto()); marshalErr == nil {
+			trailer.Set("grpc-status-details-bin", string(details))
+		}
+	}
+
+	var trailerBlock bytes.Buffer
+	for k, values := range trailer {
+		for _, v := range values {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.RawStdEncoding.EncodeToString([]byte(v))
+			}
+			trailerBlock.WriteString(k + ": " + v + "\r\n")
+		}
+	}
+	writeGRPCWebFrame(&body, grpcWebTrailerFlag, trailerBlock.Bytes())
+
+	content := body.Bytes()
+	if p.text {
+		content = []byte(base64.StdEncoding.EncodeToString(content))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, writeErr := w.Write(content); writeErr != nil {
+		slog.Debug("failed to write gRPC-Web response", "error", writeErr)
+	}
+}
+
+func writeGRPCWebFrame(buf *bytes.Buffer, flags byte, payload []byte) {
+	var header [grpcWebFrameHeaderSize]byte
+	header[0] = flags
+	binary.BigEndian.PutUint32(header[1:], uint32(len(payload))) //nolint:gosec
+	buf.Write(header[:])
+	buf.Write(payload)
+}
+
+// decodeBase64Chunks decodes the base64 body, which could be the concatenation of the padded chunks,
+// e.g. the separately encoded frames.
+func decodeBase64Chunks(body []byte) ([]byte, error) {
+	text := strings.Join(strings.Fields(string(body)), "")
+
+	var decoded []byte
+	for text != "" {
+		chunk := text
+		if i := strings.IndexByte(text, '='); i >= 0 {
+			end := i
+			for end < len(text) && text[end] == '=' {
+				end++
+			}
+			chunk = text[:end]
+		}
+		text = text[len(chunk):]
+
+		part, err := base64.StdEncoding.DecodeString(chunk)
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, part...)
+	}
+
+	return decoded, nil
+}
+
+// encodeGRPCMessage percent-encodes the status message, as it is required for the grpc-message trailer.
+func encodeGRPCMessage(msg string) string {
+	var sb strings.Builder
+	for i := range len(msg) {
+		c := msg[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			sb.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", c)
+	}
+
+	return sb.String()
+}
+
+// connectProtocol is the unary Connect protocol: the request and the response bodies are the messages
+// in the protobuf or JSON encoding, the failed call responds with the JSON error and the HTTP status of the code.
+type connectProtocol struct {
+	contentType  string
+	messageCodec webCodec
+}
+
+// connectCodes are the Connect names and the HTTP statuses of the gRPC codes.
+var connectCodes = map[codes.Code]struct {
+	name       string
+	httpStatus int
+}{
+	codes.Canceled:           {"canceled", 499},
+	codes.Unknown:            {"unknown", http.StatusInternalServerError},
+	codes.InvalidArgument:    {"invalid_argument", http.StatusBadRequest},
+	codes.DeadlineExceeded:   {"deadline_exceeded", http.StatusGatewayTimeout},
+	codes.NotFound:           {"not_found", http.StatusNotFound},
+	codes.AlreadyExists:      {"already_exists", http.StatusConflict},
+	codes.PermissionDenied:   {"permission_denied", http.StatusForbidden},
+	codes.ResourceExhausted:  {"resource_exhausted", http.StatusTooManyRequests},
+	codes.FailedPrecondition: {"failed_precondition", http.StatusBadRequest},
+	codes.Aborted:            {"aborted", http.StatusConflict},
+	codes.OutOfRange:         {"out_of_range", http.StatusBadRequest},
+	codes.Unimplemented:      {"unimplemented", http.StatusNotImplemented},
+	codes.Internal:           {"internal", http.StatusInternalServerError},
+	codes.Unavailable:        {"unavailable", http.StatusServiceUnavailable},
+	codes.DataLoss:           {"data_loss", http.StatusInternalServerError},
+	codes.Unauthenticated:    {"unauthenticated", http.StatusUnauthorized},
+}
+
+// connectError is the body of the failed Connect call.
+type connectError struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+func (p connectProtocol) codec() webCodec {
+	return p.messageCodec
+}
+
+func (p connectProtocol) decodeRequest(body []byte) ([]byte, error) {
+	return body, nil
+}
+
+func (p connectProtocol) writeResponse(w http.ResponseWriter, stream *webStream, err error) {
+	if stream != nil {
+		setMetadataHeaders(w.Header(), "", stream.header)
+		setMetadataHeaders(w.Header(), "Trailer-", stream.trailer)
+	}
+
+	if err != nil {
+		st := status.Convert(err)
+		code, ok := connectCodes[st.Code()]
+		if !ok {
+			code = connectCodes[codes.Unknown]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code.httpStatus)
+		if encodeErr := json.NewEncoder(w).Encode(connectError{Code: code.name, Message: st.Message()}); encodeErr != nil {
+			slog.Debug("failed to write Connect response", "error", encodeErr)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", p.contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, writeErr := w.Write(stream.out); writeErr != nil {
+		slog.Debug("failed to write Connect response", "error", writeErr)
+	}
+}
+
+// setMetadataHeaders sets the response metadata as the HTTP headers with the prefix, the binary values are base64-encoded.
+func setMetadataHeaders(h http.Header, prefix string, md metadata.MD) {
+	for k, values := range md {
+		for _, v := range values {
+			if strings.HasSuffix(k, "-bin") {
+				v = base64.RawStdEncoding.EncodeToString([]byte(v))
+			}
+			h.Add(prefix+k, v)
+		}
+	}
+}
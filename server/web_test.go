@@ -0,0 +1,287 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/default23/protofake/mapper"
+)
+
+// newWebTestServer constructs the test server with the SayHello mappings: the denied one for the "denied" scenario
+// and the "hi" reply for any other call.
+func newWebTestServer(t *testing.T, origins ...string) *Server {
+	t.Helper()
+
+	conf := testConfig()
+	if len(origins) > 0 {
+		conf.Web.AllowedOrigins = origins
+	}
+	s := newTestServer(t, conf)
+	err := s.SetMappings(mapper.OriginFile, []*mapper.Mapping{
+		replyMapping("hello", sayHelloMethod, "hi"),
+		{
+			ID:       "denied",
+			Endpoint: sayHelloMethod,
+			Metadata: map[string]mapper.ValueMatcher{"x-scenario": {Rule: mapper.MatchingRuleEqual, Value: "denied"}},
+			Response: mapper.Response{Code: "PERMISSION_DENIED"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("SetMappings() error = %v", err)
+	}
+
+	return s
+}
+
+// serveWeb calls the web handler of the server, returns the recorded response.
+func serveWeb(s *Server, method, path string, header http.Header, body []byte) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, bytes.NewReader(body))
+	for k, values := range header {
+		r.Header[k] = values
+	}
+	w := httptest.NewRecorder()
+	s.handleWeb(w, r)
+
+	return w
+}
+
+// marshalHelloRequest returns the protobuf encoding of the HelloRequest with the name.
+func marshalHelloRequest(t *testing.T, s *Server, name string) []byte {
+	t.Helper()
+
+	in := newTestMessage(t, s, "HelloRequest")
+	if err := protojson.Unmarshal([]byte(`{"name": "`+name+`"}`), in); err != nil {
+		t.Fatalf("unmarshal request: %v", err)
+	}
+	payload, err := proto.Marshal(in)
+	if err != nil {
+		t.Fatalf("marshal request: %v", err)
+	}
+
+	return payload
+}
+
+// unmarshalHelloReply returns the message of the HelloReply from the protobuf encoding.
+func unmarshalHelloReply(t *testing.T, s *Server, payload []byte) string {
+	t.Helper()
+
+	out := newTestMessage(t, s, "HelloReply")
+	if err := proto.Unmarshal(payload, out); err != nil {
+		t.Fatalf("unmarshal response: %v", err)
+	}
+
+	return out.ProtoReflect().Get(out.ProtoReflect().Descriptor().Fields().ByName("message")).String()
+}
+
+func TestServer_HandleWeb__GRPCWeb(t *testing.T) {
+	s := newWebTestServer(t)
+
+	tests := []struct {
+		name        string
+		contentType string
+		scenario    string
+		wantMessage string
+		wantStatus  codes.Code
+	}{
+		{"binary", "application/grpc-web+proto", "", "hi", codes.OK},
+		{"binary error", "application/grpc-web", "denied", "", codes.PermissionDenied},
+		{"text", "application/grpc-web-text", "", "hi", codes.OK},
+		{"text error", "application/grpc-web-text+proto", "denied", "", codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text := strings.HasPrefix(tt.contentType, "application/grpc-web-text")
+
+			var body bytes.Buffer
+			writeGRPCWebFrame(&body, 0, marshalHelloRequest(t, s, "john"))
+			content := body.Bytes()
+			if text {
+				content = []byte(base64.StdEncoding.EncodeToString(content))
+			}
+
+			header := http.Header{"Content-Type": {tt.contentType}, "X-Scenario": {tt.scenario}}
+			w := serveWeb(s, http.MethodPost, sayHelloMethod, header, content)
+			if w.Code != http.StatusOK {
+				t.Fatalf("response status = %d, want %d", w.Code, http.StatusOK)
+			}
+
+			content = w.Body.Bytes()
+			if text {
+				if w.Header().Get("Content-Type") != "application/grpc-web-text+proto" {
+					t.Errorf("response content type = %s", w.Header().Get("Content-Type"))
+				}
+				decoded, err := base64.StdEncoding.DecodeString(string(content))
+				if err != nil {
+					t.Fatalf("decode base64 response: %v", err)
+				}
+				content = decoded
+			}
+
+			var (
+				messages [][]byte
+				trailer  = map[string]string{}
+			)
+			for len(content) > 0 {
+				if len(content) < grpcWebFrameHeaderSize {
+					t.Fatalf("truncated response frame header")
+				}
+				flags, size := content[0], binary.BigEndian.Uint32(content[1:grpcWebFrameHeaderSize])
+				payload := content[grpcWebFrameHeaderSize : grpcWebFrameHeaderSize+int(size)]
+				content = content[grpcWebFrameHeaderSize+int(size):]
+
+				if flags&grpcWebTrailerFlag == 0 {
+					messages = append(messages, payload)
+					continue
+				}
+				if len(content) > 0 {
+					t.Errorf("frames after the trailer frame")
+				}
+				for _, line := range strings.Split(strings.TrimSpace(string(payload)), "\r\n") {
+					k, v, _ := strings.Cut(line, ": ")
+					trailer[k] = v
+				}
+			}
+
+			if trailer["grpc-status"] != strconv.Itoa(int(tt.wantStatus)) {
+				t.Fatalf("grpc-status = %q, want %d (trailer %v)", trailer["grpc-status"], tt.wantStatus, trailer)
+			}
+			if tt.wantStatus != codes.OK {
+				if len(messages) != 0 {
+					t.Errorf("response messages = %d, want none", len(messages))
+				}
+				if trailer["grpc-message"] != encodeGRPCMessage(defaultErrorMessage) {
+					t.Errorf("grpc-message = %q, want %q", trailer["grpc-message"], defaultErrorMessage)
+				}
+				return
+			}
+			if len(messages) != 1 {
+				t.Fatalf("response messages = %d, want 1", len(messages))
+			}
+			if got := unmarshalHelloReply(t, s, messages[0]); got != tt.wantMessage {
+				t.Errorf("response message = %q, want %q", got, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestServer_HandleWeb__Connect(t *testing.T) {
+	s := newWebTestServer(t)
+
+	t.Run("proto", func(t *testing.T) {
+		header := http.Header{"Content-Type": {"application/proto"}}
+		w := serveWeb(s, http.MethodPost, sayHelloMethod, header, marshalHelloRequest(t, s, "john"))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/proto" {
+			t.Fatalf("response status = %d, content type = %s", w.Code, w.Header().Get("Content-Type"))
+		}
+		if got := unmarshalHelloReply(t, s, w.Body.Bytes()); got != "hi" {
+			t.Errorf("response message = %q, want hi", got)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		header := http.Header{"Content-Type": {"application/json; charset=utf-8"}}
+		w := serveWeb(s, http.MethodPost, sayHelloMethod, header, []byte(`{"name": "john"}`))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+			t.Fatalf("response status = %d, content type = %s", w.Code, w.Header().Get("Content-Type"))
+		}
+
+		var reply map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &reply); err != nil {
+			t.Fatalf("unmarshal response: %v", err)
+		}
+		if reply["message"] != "hi" {
+			t.Errorf("response message = %v, want hi", reply["message"])
+		}
+	})
+
+	errorTests := []struct {
+		name       string
+		path       string
+		scenario   string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantMsg    string
+	}{
+		{"mapping error", sayHelloMethod, "denied", `{}`, http.StatusForbidden, "permission_denied", defaultErrorMessage},
+		{"unknown method", "/protofake.test.Greeter/Unknown", "", `{}`, http.StatusNotImplemented, "unimplemented", "unknown method /protofake.test.Greeter/Unknown"},
+		{"invalid request", sayHelloMethod, "", `{"name": 1}`, http.StatusBadRequest, "invalid_argument", ""},
+	}
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{"Content-Type": {"application/json"}, "X-Scenario": {tt.scenario}}
+			w := serveWeb(s, http.MethodPost, tt.path, header, []byte(tt.body))
+			if w.Code != tt.wantStatus || w.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("response status = %d, content type = %s, want %d", w.Code, w.Header().Get("Content-Type"), tt.wantStatus)
+			}
+
+			var got connectError
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("unmarshal error body %s: %v", w.Body.String(), err)
+			}
+			if got.Code != tt.wantCode || (tt.wantMsg != "" && got.Message != tt.wantMsg) {
+				t.Errorf("error body = %+v, want code %s, message %q", got, tt.wantCode, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestServer_HandleWeb__CORS(t *testing.T) {
+	const origin = "https://app.example.com"
+
+	tests := []struct {
+		name            string
+		allowed         []string
+		origin          string
+		wantStatus      int
+		wantOrigin      string
+		wantCredentials string
+	}{
+		{"any origin", []string{"*"}, origin, http.StatusNoContent, "*", ""},
+		{"listed origin", []string{"https://other.example.com", origin}, origin, http.StatusNoContent, origin, "true"},
+		{"listed and any origin", []string{origin, "*"}, origin, http.StatusNoContent, "*", ""},
+		{"not listed origin", []string{"https://other.example.com"}, origin, http.StatusForbidden, "", ""},
+		{"no origin", []string{"https://other.example.com"}, "", http.StatusNoContent, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newWebTestServer(t, tt.allowed...)
+			header := http.Header{"Access-Control-Request-Method": {"POST"}, "Access-Control-Request-Headers": {"content-type,x-scenario"}}
+			if tt.origin != "" {
+				header.Set("Origin", tt.origin)
+			}
+
+			w := serveWeb(s, http.MethodOptions, sayHelloMethod, header, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("preflight status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials"); got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, tt.wantCredentials)
+			}
+			if tt.wantStatus == http.StatusNoContent && tt.origin != "" {
+				if got := w.Header().Get("Access-Control-Allow-Headers"); got != "content-type,x-scenario" {
+					t.Errorf("Access-Control-Allow-Headers = %q", got)
+				}
+				if got := w.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(got, "Grpc-Status") {
+					t.Errorf("Access-Control-Expose-Headers = %q, want the gRPC status headers", got)
+				}
+			}
+		})
+	}
+}
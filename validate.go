@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+
+	"github.com/default23/protofake/config"
+	"github.com/default23/protofake/mapper"
+	"github.com/default23/protofake/server"
+)
+
+const (
+	outputFormatText   = "text"
+	outputFormatJSON   = "json"
+	outputFormatGitHub = "github"
+)
+
+// diagnostic is the single problem, found by the validate command.
+type diagnostic struct {
+	File      string `json:"file,omitempty"`
+	Line      int    `json:"line,omitempty"`
+	Column    int    `json:"column,omitempty"`
+	MappingID string `json:"mapping_id,omitempty"`
+	Endpoint  string `json:"endpoint,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Message   string `json:"message"`
+}
+
+// runValidate loads the descriptors and the mappings from the data directory and validates the mappings
+// without starting the server. Returns the process exit code: 0 if the mappings are valid,
+// 1 if problems are found and 2 on invalid command usage.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	conf, err := config.Parse()
+	if err != nil {
+		fmt.Fprintf(stderr, "failed to parse configuration: %v\n", err)
+		return 2
+	}
+
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: protofake validate [flags]")
+		fmt.Fprintln(stderr, "Validates the mappings against the descriptors in the data directory without starting the server.")
+		fs.PrintDefaults()
+	}
+	dataDir := fs.String("data-dir", conf.DataDir, "the directory with the descriptors and mappings subdirectories")
+	format := fs.String("format", outputFormatText, "the output format: text, json or github (GitHub Actions annotations)")
+	if err = fs.Parse(args); err != nil {
+		return 2
+	}
+
+	switch *format {
+	case outputFormatText, outputFormatJSON, outputFormatGitHub:
+	default:
+		fmt.Fprintf(stderr, "unknown output format %q, expected one of: text, json, github\n", *format)
+		return 2
+	}
+
+	// the diagnostics are written to stdout, so the logs should not be mixed with them
+	slog.SetDefault(slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: conf.Logger.Level})))
+
+	diagnostics := validateDataDir(conf, *dataDir)
+	if err = writeDiagnostics(stdout, *format, diagnostics); err != nil {
+		fmt.Fprintf(stderr, "failed to write the validation result: %v\n", err)
+		return 1
+	}
+	if len(diagnostics) > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// validateDataDir returns the problems of the descriptors and the mappings from the data directory.
+func validateDataDir(conf *config.Config, dataDir string) []diagnostic {
+	descriptors, err := loadDescriptors(context.Background(), conf, dataDir)
+	if err != nil {
+		return toDiagnostics(err)
+	}
+
+	mappings, err := parseMappingFiles(filepath.Join(dataDir, "mappings"))
+	if err != nil {
+		return toDiagnostics(err)
+	}
+
+	// the listener is not started, so the TLS certificates are not loaded or generated.
+	conf.GRPC.TLS = config.TLS{}
+	srv, err := server.New(conf.GRPC)
+	if err != nil {
+		return toDiagnostics(fmt.Errorf("failed to create gRPC server: %w", err))
+	}
+	for _, d := range descriptors {
+		if err = srv.Register(d); err != nil {
+			return toDiagnostics(fmt.Errorf("failed to register gRPC services: %w", err))
+		}
+	}
+
+	var diagnostics []diagnostic
+	for _, m := range mappings {
+		for _, mappingErr := range srv.ValidateMapping(m) {
+			diagnostics = append(diagnostics, toDiagnostics(mappingErr)...)
+		}
+	}
+
+	return diagnostics
+}
+
+// toDiagnostics converts the error into the diagnostics, the joined errors are split,
+// even if they are wrapped, each of them contains the file it relates to.
+func toDiagnostics(err error) []diagnostic {
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		joined, ok := e.(interface{ Unwrap() []error }) //nolint:errorlint
+		if !ok {
+			continue
+		}
+
+		var diagnostics []diagnostic
+		for _, je := range joined.Unwrap() {
+			diagnostics = append(diagnostics, toDiagnostics(je)...)
+		}
+
+		return diagnostics
+	}
+
+	var verr *mapper.ValidationError
+	if errors.As(err, &verr) {
+		return []diagnostic{{
+			File:      verr.Source,
+			Line:      verr.Position.Line,
+			Column:    verr.Position.Column,
+			MappingID: verr.MappingID,
+			Endpoint:  verr.Endpoint,
+			Path:      verr.Path,
+			Message:   verr.Message,
+		}}
+	}
+
+	var ferr *sourceFileError
+	if errors.As(err, &ferr) {
+		return []diagnostic{{
+			File:    ferr.Path,
+			Line:    ferr.Position.Line,
+			Column:  ferr.Position.Column,
+			Message: ferr.Err.Error(),
+		}}
+	}
+
+	return []diagnostic{{Message: err.Error()}}
+}
+
+func writeDiagnostics(w io.Writer, format string, diagnostics []diagnostic) error {
+	switch format {
+	case outputFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(struct {
+			Valid    bool         `json:"valid"`
+			Problems []diagnostic `json:"problems"`
+		}{
+			Valid:    len(diagnostics) == 0,
+			Problems: append([]diagnostic{}, diagnostics...),
+		})
+	case outputFormatGitHub:
+		for _, d := range diagnostics {
+			var props []string
+			if d.File != "" {
+				props = append(props, "file="+escapeAnnotationProperty(d.File))
+			}
+			if d.Line > 0 {
+				props = append(props, fmt.Sprintf("line=%d", d.Line))
+			}
+			if d.Column > 0 {
+				props = append(props, fmt.Sprintf("col=%d", d.Column))
+			}
+			props = append(props, "title="+escapeAnnotationProperty(d.title()))
+
+			if _, err := fmt.Fprintf(w, "::error %s::%s\n", strings.Join(props, ","), escapeAnnotationData(d.text())); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, d := range diagnostics {
+			location := d.File
+			if location != "" && d.Line > 0 {
+				location = d.File + ":" + mapper.Position{Line: d.Line, Column: d.Column}.String()
+			}
+			if location != "" {
+				location += ": "
+			}
+
+			if _, err := fmt.Fprintf(w, "%s%s\n", location, d.text()); err != nil {
+				return err
+			}
+		}
+		if len(diagnostics) > 0 {
+			_, err := fmt.Fprintf(w, "%d problem(s) found\n", len(diagnostics))
+			return err
+		}
+	}
+
+	return nil
+}
+
+// title is the short description of the problem source.
+func (d diagnostic) title() string {
+	if d.MappingID == "" {
+		return "protofake"
+	}
+
+	return fmt.Sprintf("protofake: mapping %s", d.MappingID)
+}
+
+// text is the problem description with the mapping and the path inside the mapping.
+func (d diagnostic) text() string {
+	var sb strings.Builder
+	if d.MappingID != "" {
+		fmt.Fprintf(&sb, "mapping (id=%s endpoint=%s) ", d.MappingID, d.Endpoint)
+	}
+	if d.Path != "" {
+		sb.WriteString(d.Path + ": ")
+	}
+	sb.WriteString(d.Message)
+
+	return sb.String()
+}
+
+// escapeAnnotationData escapes the message of the GitHub Actions workflow command.
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeAnnotationProperty escapes the property value of the GitHub Actions workflow command.
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
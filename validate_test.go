@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the tests")
+
+// invalidMappings are the mappings with the problems of each kind, the id of the second mapping
+// has the characters, escaped in the GitHub annotation properties.
+const invalidMappings = `[
+  {
+    "id": "hello",
+    "endpoint": "/protofake.test.Greeter/SayHello",
+    "request_body": {
+      "nmae": {"rule": "equal", "value": "john"}
+    },
+    "response": {
+      "body": {"sendr.age": 1, "sender.age": "$req.body.name"}
+    }
+  },
+  {
+    "id": "50%,off:now",
+    "endpoint": "/protofake.test.Greeter/Unknown"
+  }
+]
+`
+
+const validMappings = `{
+  "id": "hello",
+  "endpoint": "/protofake.test.Greeter/SayHello",
+  "request_body": {"tenant.id": {"rule": "equal", "value": "acme"}},
+  "response": {"body": {"message": "hi", "sender.display_name": "$req.body.name"}}
+}
+`
+
+// newTestDataDir creates the data directory with the test .proto files as the descriptors and the given mapping files.
+// The imports of the .proto files are resolved from the testdata/proto_imports by the PROTO_IMPORT_PATHS.
+func newTestDataDir(t *testing.T, mappings map[string]string) string {
+	t.Helper()
+
+	importPath, err := filepath.Abs(filepath.Join("testdata", "proto_imports"))
+	if err != nil {
+		t.Fatalf("resolve import path: %v", err)
+	}
+	t.Setenv("PROTO_IMPORT_PATHS", importPath)
+
+	dir := t.TempDir()
+	files := make(map[string]string, len(mappings)+2)
+	for _, name := range []string{"greeter.proto", "sender.proto"} {
+		content, readErr := os.ReadFile(filepath.Join("testdata", "proto", name))
+		if readErr != nil {
+			t.Fatalf("read test proto: %v", readErr)
+		}
+		files[filepath.Join("descriptors", name)] = string(content)
+	}
+	for name, content := range mappings {
+		files[filepath.Join("mappings", name)] = content
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("create dir: %v", err)
+		}
+		if err = os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	return dir
+}
+
+func TestRunValidate(t *testing.T) {
+	prevLogger := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(prevLogger) })
+
+	invalidDir := newTestDataDir(t, map[string]string{"hello.json": invalidMappings})
+	validDir := newTestDataDir(t, map[string]string{"hello.json": validMappings})
+
+	tests := []struct {
+		name     string
+		args     []string
+		wantCode int
+		golden   string
+	}{
+		{"text", []string{"--data-dir", invalidDir}, 1, "invalid.text.golden"},
+		{"json", []string{"--data-dir", invalidDir, "--format", "json"}, 1, "invalid.json.golden"},
+		{"github", []string{"--data-dir", invalidDir, "--format", "github"}, 1, "invalid.github.golden"},
+		{"valid text", []string{"--data-dir", validDir}, 0, "valid.text.golden"},
+		{"valid json", []string{"--data-dir", validDir, "--format", "json"}, 0, "valid.json.golden"},
+		{"unknown format", []string{"--data-dir", validDir, "--format", "xml"}, 2, ""},
+		{"unknown flag", []string{"--data-dir", validDir, "--verbose"}, 2, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if code := runValidate(tt.args, &stdout, &stderr); code != tt.wantCode {
+				t.Fatalf("runValidate() = %d, want %d, stderr: %s", code, tt.wantCode, stderr.String())
+			}
+			if tt.golden == "" {
+				if stdout.Len() > 0 {
+					t.Errorf("runValidate() output = %q, want none on usage error", stdout.String())
+				}
+				return
+			}
+
+			// the data directory is temporary, so it is replaced in the output
+			got := stdout.String()
+			got = strings.ReplaceAll(got, invalidDir, "DATA_DIR")
+			got = strings.ReplaceAll(got, validDir, "DATA_DIR")
+			assertGolden(t, filepath.Join("testdata", "validate", tt.golden), got)
+		})
+	}
+}
+
+func TestEscapeAnnotation(t *testing.T) {
+	const s = "50% off:\r\nnow, later"
+
+	if got, want := escapeAnnotationData(s), "50%25 off:%0D%0Anow, later"; got != want {
+		t.Errorf("escapeAnnotationData() = %q, want %q", got, want)
+	}
+	if got, want := escapeAnnotationProperty(s), "50%25 off%3A%0D%0Anow%2C later"; got != want {
+		t.Errorf("escapeAnnotationProperty() = %q, want %q", got, want)
+	}
+}
+
+// assertGolden compares the content with the golden file, the file is rewritten with the -update flag.
+func assertGolden(t *testing.T, path, got string) {
+	t.Helper()
+
+	if *updateGolden {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatalf("update golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read golden file: %v", err)
+	}
+	if got != string(want) {
+		t.Errorf("output does not match the golden file %s\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
@@ -3,23 +3,49 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
+
+	"github.com/default23/protofake/admin"
 )
 
-func watchChanges(ctx context.Context, dir string, callback func()) error {
+// watchChanges watches the directory with all its subdirectories and calls the reload after the changes.
+// The events are debounced, so the burst of changes causes the single reload, after no events for the debounce delay.
+// The created, written, removed and renamed files are tracked, so the atomic saves of the editors
+// (write into the temporary file and rename it) are handled as well.
+// The changes inside the excluded subdirectories are ignored.
+// The result of each reload is logged and recorded in the status.
+func watchChanges(
+	ctx context.Context, dir string, excludedDirs []string, debounce time.Duration, status *admin.ReloadStatus, reload func() error,
+) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
 	}
 
+	logger := slog.With("watched_dir", dir)
+	if err = watchDirs(watcher, dir, excludedDirs); err != nil {
+		_ = watcher.Close()
+		return fmt.Errorf("failed to add directory to watcher: %w", err)
+	}
+
 	go func() {
+		timer := time.NewTimer(debounce)
+		timer.Stop()
+		defer timer.Stop()
+
 		for {
 			select {
 			case <-ctx.Done():
-				if err = watcher.Close(); err != nil {
-					slog.Error("unable to close the fs watcher", "error", err)
+				if err := watcher.Close(); err != nil {
+					logger.Error("unable to close the fs watcher", "error", err)
 				}
 
 				return
@@ -28,26 +54,72 @@ func watchChanges(ctx context.Context, dir string, callback func()) error {
 					return
 				}
 
-				slog.Debug("fs event", "event", event)
+				logger.Debug("fs event", "event", event)
+				if isExcludedPath(event.Name, excludedDirs) {
+					continue
+				}
+				if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) && !event.Has(fsnotify.Remove) && !event.Has(fsnotify.Rename) {
+					continue // chmod only
+				}
+
+				if event.Has(fsnotify.Create) {
+					// the subdirectories, created after the start, are watched as well,
+					// the removed ones are dropped by the watcher itself.
+					if info, statErr := os.Stat(event.Name); statErr == nil && info.IsDir() {
+						if err := watchDirs(watcher, event.Name, excludedDirs); err != nil {
+							logger.Warn("unable to watch the created directory", "path", event.Name, "error", err)
+						}
+					}
+				}
 
-				if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
-					slog.Debug("file modified", "file", event.Name)
-					callback()
+				timer.Reset(debounce)
+			case <-timer.C:
+				if err := reload(); err != nil {
+					logger.Error("reload failed, the previous state is kept", "error", err)
+					status.Failed(err)
+					continue
 				}
 
+				status.Succeeded()
 			case watchErr, ok := <-watcher.Errors:
 				if !ok {
 					return
 				}
-				slog.Debug("fs watch error:", "error", watchErr)
+				logger.Warn("fs watch error", "error", watchErr)
 			}
 		}
 	}()
 
-	err = watcher.Add(dir)
-	if err != nil {
-		return fmt.Errorf("failed to add directory to watcher: %w", err)
+	return nil
+}
+
+// watchDirs adds the directory and all its subdirectories, except the excluded ones, to the watcher.
+func watchDirs(watcher *fsnotify.Watcher, root string, excludedDirs []string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if slices.Contains(excludedDirs, path) {
+			return filepath.SkipDir
+		}
+		if err = watcher.Add(path); err != nil {
+			return fmt.Errorf("watch %s: %w", path, err)
+		}
+
+		return nil
+	})
+}
+
+// isExcludedPath reports whether the path is one of the excluded directories or is inside of them.
+func isExcludedPath(path string, excludedDirs []string) bool {
+	for _, dir := range excludedDirs {
+		if rel, err := filepath.Rel(dir, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
 	}
 
-	return nil
+	return false
 }
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/default23/protofake/admin"
+)
+
+func TestWatchChanges(t *testing.T) {
+	const debounce = 200 * time.Millisecond
+
+	dir := t.TempDir()
+	excluded := filepath.Join(dir, "api")
+	if err := os.Mkdir(excluded, 0o755); err != nil {
+		t.Fatalf("create excluded dir: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloads := make(chan struct{}, 10)
+	reloadErr := errors.New("broken.json: invalid JSON")
+	var failNext atomic.Bool
+	status := new(admin.ReloadStatus)
+	err := watchChanges(ctx, dir, []string{excluded}, debounce, status, func() error {
+		reloads <- struct{}{}
+		if failNext.Load() {
+			return reloadErr
+		}
+
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("watchChanges() error = %v", err)
+	}
+
+	// the nested directories, created after the start, are watched, the burst of writes causes the single reload
+	nested := filepath.Join(dir, "a", "b")
+	if err = os.MkdirAll(nested, 0o755); err != nil {
+		t.Fatalf("create nested dir: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	for i := range 5 {
+		if err = os.WriteFile(filepath.Join(nested, "hello.json"), []byte{'[', byte('0' + i), ']'}, 0o644); err != nil {
+			t.Fatalf("write mapping: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	waitReloads(t, reloads, 1, debounce)
+	if state := status.State(); state.Reloads != 1 || state.LastSuccessAt == nil || state.LastError != "" {
+		t.Errorf("status after the reload = %+v", state)
+	}
+
+	// the changes inside the nested directory are tracked after the reload as well, the failure is recorded
+	failNext.Store(true)
+	if err = os.Remove(filepath.Join(nested, "hello.json")); err != nil {
+		t.Fatalf("remove mapping: %v", err)
+	}
+	waitReloads(t, reloads, 1, debounce)
+	if state := status.State(); state.Reloads != 2 || state.LastError != reloadErr.Error() || state.LastErrorAt == nil {
+		t.Errorf("status after the failed reload = %+v", state)
+	}
+
+	// the changes of the excluded directory are ignored
+	if err = os.WriteFile(filepath.Join(excluded, "hello.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatalf("write excluded file: %v", err)
+	}
+	if err = os.MkdirAll(filepath.Join(excluded, "nested"), 0o755); err != nil {
+		t.Fatalf("create excluded nested dir: %v", err)
+	}
+	waitReloads(t, reloads, 0, debounce)
+}
+
+// waitReloads waits for the count of the reloads, no more reloads are expected after them.
+func waitReloads(t *testing.T, reloads <-chan struct{}, want int, debounce time.Duration) {
+	t.Helper()
+
+	timeout := time.After(5 * debounce)
+	for got := 0; got < want; got++ {
+		select {
+		case <-reloads:
+		case <-timeout:
+			t.Fatalf("reloads = %d, want %d", got, want)
+		}
+	}
+
+	select {
+	case <-reloads:
+		t.Fatalf("unexpected reload, want %d", want)
+	case <-time.After(3 * debounce):
+	}
+}
+
+func TestIsExcludedPath(t *testing.T) {
+	excluded := []string{filepath.Join("data", "mappings", "api")}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{filepath.Join("data", "mappings", "api"), true},
+		{filepath.Join("data", "mappings", "api", "hello.json"), true},
+		{filepath.Join("data", "mappings", "api", "nested", ".hello.json.tmp-1"), true},
+		{filepath.Join("data", "mappings", "apis", "hello.json"), false},
+		{filepath.Join("data", "mappings", "hello.json"), false},
+		{filepath.Join("data", "mappings"), false},
+		{filepath.Join("data", "mappings", "..api"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isExcludedPath(tt.path, excluded); got != tt.want {
+			t.Errorf("isExcludedPath(%s) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}